@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	annotationExtraArgs     = "tailscale.com/extra-args"
+	annotationExtraArgsJSON = "tailscale.com/extra-args-json"
+)
+
+// splitArgs splits a string into arguments using shell quoting rules:
+// whitespace separates arguments, single quotes preserve everything, double
+// quotes preserve everything but backslash escapes, and a backslash outside
+// quotes escapes the next character.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// quoteArg quotes an argument so that splitArgs returns it unchanged.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// joinArgs is the inverse of splitArgs.
+func joinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// getPodExtraArgs returns the extra tailscale arguments requested by the pod.
+// tailscale.com/extra-args-json takes a JSON array of arguments and is the
+// robust choice for arguments containing spaces or quotes. The plain
+// tailscale.com/extra-args string is checked with shell splitting: a string
+// that does not split cleanly is denied, and one whose meaning depends on
+// quoting is logged (or denied with TS_EXTRA_ARGS_VALIDATION=strict) since it
+// is easy to get wrong.
+func getPodExtraArgs(pod *corev1.Pod) ([]string, error) {
+	if value, ok := pod.Annotations[annotationExtraArgsJSON]; ok {
+		var args []string
+		if err := json.Unmarshal([]byte(value), &args); err != nil {
+			return nil, field.Invalid(annotationPath(annotationExtraArgsJSON), value, "must be a JSON array of strings")
+		}
+		return args, checkAllowedFlags(annotationExtraArgsJSON, args)
+	}
+
+	value, ok := pod.Annotations[annotationExtraArgs]
+	if !ok {
+		return nil, nil
+	}
+	args, err := splitArgs(value)
+	if err != nil {
+		return nil, field.Invalid(annotationPath(annotationExtraArgs), value, err.Error())
+	}
+
+	if strings.Join(args, " ") != strings.Join(strings.Fields(value), " ") {
+		msg := fmt.Sprintf("arguments rely on shell quoting and may be split differently than intended, use %s instead", annotationExtraArgsJSON)
+		if getEnv("TS_EXTRA_ARGS_VALIDATION", "warn") == "strict" {
+			return nil, field.Invalid(annotationPath(annotationExtraArgs), value, msg)
+		}
+		log.Printf("Warning: pod %s/%s %s: %s", pod.Namespace, pod.Name, annotationExtraArgs, msg)
+	}
+	return args, checkAllowedFlags(annotationExtraArgs, args)
+}
+
+// getAllowedFlags returns the flag names from ALLOWED_EXTRA_FLAGS, e.g.
+// "accept-routes,advertise-tags", or nil when every flag is allowed.
+func getAllowedFlags() map[string]bool {
+	var allowed map[string]bool
+	for _, name := range strings.Split(getEnv("ALLOWED_EXTRA_FLAGS", ""), ",") {
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		if name == "" {
+			continue
+		}
+		if allowed == nil {
+			allowed = map[string]bool{}
+		}
+		allowed[name] = true
+	}
+	return allowed
+}
+
+// checkAllowedFlags denies pod extra args passing a flag missing from
+// ALLOWED_EXTRA_FLAGS. Arguments not starting with a dash are flag values
+// and are not checked.
+func checkAllowedFlags(annotation string, args []string) error {
+	allowed := getAllowedFlags()
+	if allowed == nil {
+		return nil
+	}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !allowed[name] {
+			return field.Forbidden(annotationPath(annotation), fmt.Sprintf("flag --%s is not allowed, allowed flags are set by ALLOWED_EXTRA_FLAGS", name))
+		}
+	}
+	return nil
+}
+
+// deniedFlag is an entry of DENIED_EXTRA_FLAGS: a flag name, optionally with
+// a value prefix so that only some uses of the flag are denied.
+type deniedFlag struct {
+	name        string
+	valuePrefix string
+	matchValue  bool
+}
+
+// getDeniedFlags parses DENIED_EXTRA_FLAGS, a comma separated list of flag
+// names that must not reach tailscaled, e.g. "state=mem:,tun". An entry with
+// "=value" only denies the flag when its value starts with value.
+func getDeniedFlags() []deniedFlag {
+	var denied []deniedFlag
+	for _, entry := range strings.Split(getEnv("DENIED_EXTRA_FLAGS", ""), ",") {
+		entry = strings.TrimLeft(strings.TrimSpace(entry), "-")
+		if entry == "" {
+			continue
+		}
+		name, value, matchValue := strings.Cut(entry, "=")
+		denied = append(denied, deniedFlag{name: name, valuePrefix: value, matchValue: matchValue})
+	}
+	return denied
+}
+
+// findDeniedFlag returns the first argument in args matching denied, or ""
+// when none does. Flag values are taken from "--flag=value" or from the next
+// argument when it is not itself a flag.
+func findDeniedFlag(args []string, denied []deniedFlag) string {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !hasValue && i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+			value = args[i+1]
+			arg += " " + args[i+1]
+		}
+		for _, d := range denied {
+			if d.name == name && (!d.matchValue || strings.HasPrefix(value, d.valuePrefix)) {
+				return arg
+			}
+		}
+	}
+	return ""
+}
+
+// effectiveExtraArgs returns the tailscaled arguments of the pod and the
+// field they come from. Once the sidecar is injected that is its
+// TS_EXTRA_ARGS, which combines the global, profile and pod arguments;
+// otherwise it is the pod's extra args annotation.
+func effectiveExtraArgs(pod *corev1.Pod) ([]string, *field.Path, error) {
+	for _, group := range []struct {
+		path       *field.Path
+		containers []corev1.Container
+	}{
+		{field.NewPath("spec", "initContainers"), pod.Spec.InitContainers},
+		{field.NewPath("spec", "containers"), pod.Spec.Containers},
+	} {
+		for i, container := range group.containers {
+			if !isInjectedContainer(container.Name) || container.Name == configReloaderName {
+				continue
+			}
+			for j, env := range container.Env {
+				if env.Name != "TS_EXTRA_ARGS" {
+					continue
+				}
+				path := group.path.Index(i).Child("env").Index(j).Child("value")
+				args, err := splitArgs(env.Value)
+				if err != nil {
+					return nil, path, field.Invalid(path, env.Value, err.Error())
+				}
+				return args, path, nil
+			}
+		}
+	}
+
+	path := annotationPath(annotationExtraArgs)
+	if _, ok := pod.Annotations[annotationExtraArgsJSON]; ok {
+		path = annotationPath(annotationExtraArgsJSON)
+	}
+	args, err := getPodExtraArgs(pod)
+	return args, path, err
+}
+
+// checkDeniedFlags denies pods whose effective tailscaled arguments contain
+// a flag from DENIED_EXTRA_FLAGS.
+func checkDeniedFlags(pod *corev1.Pod) error {
+	denied := getDeniedFlags()
+	if len(denied) == 0 {
+		return nil
+	}
+	args, path, err := effectiveExtraArgs(pod)
+	if err != nil {
+		return err
+	}
+	if arg := findDeniedFlag(args, denied); arg != "" {
+		return field.Forbidden(path, fmt.Sprintf("flag %s is denied by DENIED_EXTRA_FLAGS", arg))
+	}
+	return nil
+}
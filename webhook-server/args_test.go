@@ -0,0 +1,197 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", in: ""},
+		{name: "whitespace", in: " \t\n"},
+		{name: "plain", in: "--accept-routes --hostname=web", want: []string{"--accept-routes", "--hostname=web"}},
+		{name: "single quotes", in: `--hostname 'a "b" c'`, want: []string{"--hostname", `a "b" c`}},
+		{name: "double quotes", in: `--hostname "a \"b\" c"`, want: []string{"--hostname", `a "b" c`}},
+		{name: "escaped space", in: `a\ b c`, want: []string{"a b", "c"}},
+		{name: "empty quoted", in: `'' ""`, want: []string{"", ""}},
+		{name: "trailing backslash", in: `a\`, wantErr: true},
+		{name: "unterminated single", in: `'a`, wantErr: true},
+		{name: "unterminated double", in: `"a`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitArgs(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitArgs(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinArgsRoundTrip(t *testing.T) {
+	tests := [][]string{
+		{"--accept-routes"},
+		{"--hostname", "a b"},
+		{"it's", `"quoted"`, `back\slash`},
+		{"", "tab\there"},
+	}
+	for _, args := range tests {
+		joined := joinArgs(args)
+		got, err := splitArgs(joined)
+		if err != nil {
+			t.Fatalf("splitArgs(%q) error = %v", joined, err)
+		}
+		if !reflect.DeepEqual(got, args) {
+			t.Errorf("splitArgs(joinArgs(%q)) = %q", args, got)
+		}
+	}
+}
+
+func TestGetPodExtraArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		validation  string
+		want        []string
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "plain", annotations: map[string]string{annotationExtraArgs: "--accept-routes"}, want: []string{"--accept-routes"}},
+		{name: "json", annotations: map[string]string{annotationExtraArgsJSON: `["--hostname", "a b"]`}, want: []string{"--hostname", "a b"}},
+		{name: "json wins", annotations: map[string]string{annotationExtraArgsJSON: `["--a"]`, annotationExtraArgs: "--b"}, want: []string{"--a"}},
+		{name: "invalid json", annotations: map[string]string{annotationExtraArgsJSON: `--a`}, wantErr: true},
+		{name: "bad quoting", annotations: map[string]string{annotationExtraArgs: `--hostname 'web`}, wantErr: true},
+		{name: "quoting warns", annotations: map[string]string{annotationExtraArgs: `--hostname 'a b'`}, want: []string{"--hostname", "a b"}},
+		{name: "quoting strict", annotations: map[string]string{annotationExtraArgs: `--hostname 'a b'`}, validation: "strict", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_EXTRA_ARGS_VALIDATION", tt.validation)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getPodExtraArgs(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPodExtraArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getPodExtraArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAllowedFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		args    []string
+		wantErr bool
+	}{
+		{name: "unset allows all", args: []string{"--ssh"}},
+		{name: "allowed", allowed: "accept-routes, --advertise-tags", args: []string{"--accept-routes=true", "--advertise-tags", "tag:web"}},
+		{name: "values are not checked", allowed: "hostname", args: []string{"--hostname", "ssh"}},
+		{name: "denied", allowed: "accept-routes", args: []string{"--accept-routes", "--ssh"}, wantErr: true},
+		{name: "single dash", allowed: "accept-routes", args: []string{"-ssh"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ALLOWED_EXTRA_FLAGS", tt.allowed)
+			if err := checkAllowedFlags(annotationExtraArgs, tt.args); (err != nil) != tt.wantErr {
+				t.Errorf("checkAllowedFlags(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetPodExtraArgsAllowedFlags(t *testing.T) {
+	t.Setenv("ALLOWED_EXTRA_FLAGS", "accept-routes")
+	for _, key := range []string{annotationExtraArgs, annotationExtraArgsJSON} {
+		value := "--ssh"
+		if key == annotationExtraArgsJSON {
+			value = `["--ssh"]`
+		}
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{key: value}}}
+		if _, err := getPodExtraArgs(pod); err == nil {
+			t.Errorf("getPodExtraArgs() with %s = %s, want error", key, value)
+		}
+	}
+}
+
+func TestFindDeniedFlag(t *testing.T) {
+	tests := []struct {
+		name   string
+		denied string
+		args   []string
+		want   string
+	}{
+		{name: "none denied", args: []string{"--tun=userspace-networking"}},
+		{name: "name", denied: "tun", args: []string{"--accept-routes", "--tun=userspace-networking"}, want: "--tun=userspace-networking"},
+		{name: "separate value", denied: "state=mem:", args: []string{"--state", "mem:"}, want: "--state mem:"},
+		{name: "other value", denied: "state=mem:", args: []string{"--state=kube:secret"}},
+		{name: "value is not a flag", denied: "tun", args: []string{"--hostname", "tun"}},
+		{name: "single dash", denied: "-tun", args: []string{"-tun", "userspace-networking"}, want: "-tun userspace-networking"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DENIED_EXTRA_FLAGS", tt.denied)
+			if got := findDeniedFlag(tt.args, getDeniedFlags()); got != tt.want {
+				t.Errorf("findDeniedFlag(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDeniedFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		pod     *corev1.Pod
+		wantErr bool
+	}{
+		{
+			name: "annotation",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				annotationExtraArgs: "--state=mem:",
+			}}},
+			wantErr: true,
+		},
+		{
+			name: "allowed annotation",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+				annotationExtraArgs: "--accept-routes",
+			}}},
+		},
+		{
+			name: "injected sidecar",
+			pod: &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "ts-sidecar",
+				Env:  []corev1.EnvVar{{Name: "TS_EXTRA_ARGS", Value: "--state=mem:"}},
+			}}}},
+			wantErr: true,
+		},
+		{
+			name: "application container",
+			pod: &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "app",
+				Env:  []corev1.EnvVar{{Name: "TS_EXTRA_ARGS", Value: "--state=mem:"}},
+			}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DENIED_EXTRA_FLAGS", "state=mem:")
+			if err := checkDeniedFlags(tt.pod); (err != nil) != tt.wantErr {
+				t.Errorf("checkDeniedFlags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
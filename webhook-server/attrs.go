@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	annotationPostureID = "tailscale.com/posture-id"
+	// annotationNodeAttrs records the node attributes for the pod as a JSON
+	// object of attribute key to value. tailscaled cannot set attributes
+	// itself, they are set through the Tailscale API, so an external
+	// controller is expected to apply them to the pod's device.
+	annotationNodeAttrs = "tailscale.com/node-attrs"
+
+	// postureAttrKey is the custom node attribute carrying the posture ID.
+	postureAttrKey = "custom:postureId"
+)
+
+var (
+	postureIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+	attrKeyInvalid   = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	attrValueInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// nodeAttr is a custom node attribute for the pod's device.
+type nodeAttr struct {
+	key   string
+	value string
+}
+
+// attrArgs renders the attributes as tailscale flags named by TS_ATTR_FLAG,
+// for custom images accepting them. Stock tailscale has no such flag and
+// exits on it, so without TS_ATTR_FLAG no flags are rendered and the
+// attributes are only recorded by nodeAttrsAnnotation.
+func attrArgs(attrs []nodeAttr) []string {
+	flag := getEnv("TS_ATTR_FLAG", "")
+	if flag == "" {
+		return nil
+	}
+	args := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		args = append(args, fmt.Sprintf("%s=%s=%s", flag, attr.key, attr.value))
+	}
+	return args
+}
+
+// nodeAttrsAnnotation returns the tailscale.com/node-attrs record of attrs,
+// or nil when there are none.
+func nodeAttrsAnnotation(attrs []nodeAttr) map[string]string {
+	if len(attrs) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		values[attr.key] = attr.value
+	}
+	// Marshaling a map of strings cannot fail, and sorts the keys
+	raw, _ := json.Marshal(values)
+	return map[string]string{annotationNodeAttrs: string(raw)}
+}
+
+// getNodeAttrs returns the posture ID attribute followed by the label
+// attributes of the pod.
+func getNodeAttrs(pod *corev1.Pod) ([]nodeAttr, error) {
+	postureID, err := getPostureID(pod)
+	if err != nil {
+		return nil, err
+	}
+	var attrs []nodeAttr
+	if postureID != "" {
+		attrs = append(attrs, nodeAttr{postureAttrKey, postureID})
+	}
+	return append(attrs, getLabelAttrs(pod)...), nil
+}
+
+// getPostureID resolves the posture identifier for the pod. The
+// tailscale.com/posture-id annotation wins over the TS_POSTURE_ID default,
+// which may use the {{NAMESPACE}} and {{SERVICE_ACCOUNT}} tokens, e.g.
+// "{{NAMESPACE}}.{{SERVICE_ACCOUNT}}". An empty result disables the attribute.
+func getPostureID(pod *corev1.Pod) (string, error) {
+	postureID := getEnv("TS_POSTURE_ID", "")
+	if value, ok := pod.Annotations[annotationPostureID]; ok {
+		postureID = value
+	}
+	if postureID == "" {
+		return "", nil
+	}
+
+	serviceAccount := pod.Spec.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+	postureID = strings.ReplaceAll(postureID, "{{NAMESPACE}}", pod.Namespace)
+	postureID = strings.ReplaceAll(postureID, "{{SERVICE_ACCOUNT}}", serviceAccount)
+
+	if !postureIDPattern.MatchString(postureID) {
+		return "", settingError(pod, annotationPostureID, "TS_POSTURE_ID", postureID, "must be 1-63 alphanumeric, '.', '_' or '-' characters starting with an alphanumeric")
+	}
+	return postureID, nil
+}
+
+// getLabelAttrs returns a custom node attribute for each label listed in the
+// comma separated TS_LABEL_ANNOTATIONS, in the configured order. Label keys
+// and values are sanitized to characters accepted in attributes, e.g.
+// app.kubernetes.io/name=web becomes custom:app_kubernetes_io_name=web.
+// Labels missing from the pod are skipped.
+func getLabelAttrs(pod *corev1.Pod) []nodeAttr {
+	var attrs []nodeAttr
+	for _, key := range strings.Split(getEnv("TS_LABEL_ANNOTATIONS", ""), ",") {
+		key = strings.TrimSpace(key)
+		value, ok := pod.Labels[key]
+		if key == "" || !ok {
+			continue
+		}
+		attrKey := "custom:" + attrKeyInvalid.ReplaceAllString(key, "_")
+		attrs = append(attrs, nodeAttr{attrKey, attrValueInvalid.ReplaceAllString(value, "_")})
+	}
+	return attrs
+}
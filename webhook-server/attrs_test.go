@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPostureID(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "default", env: "{{NAMESPACE}}.{{SERVICE_ACCOUNT}}", want: "prod.default"},
+		{name: "annotation wins", env: "fleet", annotations: map[string]string{annotationPostureID: "web"}, want: "web"},
+		{name: "empty annotation disables", env: "fleet", annotations: map[string]string{annotationPostureID: ""}},
+		{name: "invalid", annotations: map[string]string{annotationPostureID: "a b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_POSTURE_ID", tt.env)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Annotations: tt.annotations}}
+			got, err := getPostureID(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPostureID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPostureID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeAttrsRendering(t *testing.T) {
+	attrs := []nodeAttr{{postureAttrKey, "web"}, {"custom:team", "infra"}}
+	tests := []struct {
+		name string
+		flag string
+		want []string
+	}{
+		{name: "no flag by default"},
+		{name: "explicit flag", flag: "--set-attr", want: []string{"--set-attr=custom:postureId=web", "--set-attr=custom:team=infra"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_ATTR_FLAG", tt.flag)
+			if got := attrArgs(attrs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("attrArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	want := map[string]string{annotationNodeAttrs: `{"custom:postureId":"web","custom:team":"infra"}`}
+	if got := nodeAttrsAnnotation(attrs); !reflect.DeepEqual(got, want) {
+		t.Errorf("nodeAttrsAnnotation() = %v, want %v", got, want)
+	}
+	if got := nodeAttrsAnnotation(nil); got != nil {
+		t.Errorf("nodeAttrsAnnotation(nil) = %v, want nil", got)
+	}
+}
+
+func TestGetLabelAttrs(t *testing.T) {
+	labels := map[string]string{
+		"app.kubernetes.io/name": "web",
+		"team":                   "infra/core",
+	}
+	tests := []struct {
+		name string
+		env  string
+		want []nodeAttr
+	}{
+		{name: "unset"},
+		{name: "sanitized key", env: "app.kubernetes.io/name", want: []nodeAttr{{"custom:app_kubernetes_io_name", "web"}}},
+		{name: "sanitized value", env: "team", want: []nodeAttr{{"custom:team", "infra_core"}}},
+		{name: "configured order, missing skipped", env: " team, missing ,app.kubernetes.io/name", want: []nodeAttr{{"custom:team", "infra_core"}, {"custom:app_kubernetes_io_name", "web"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_LABEL_ANNOTATIONS", tt.env)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+			if got := getLabelAttrs(pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getLabelAttrs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelAttrsNotPassedAsFlags(t *testing.T) {
+	t.Setenv("TS_LABEL_ANNOTATIONS", "app")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Labels: map[string]string{"app": "web"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}},
+	}
+	patches, _, err := generateSidecarPatch(context.Background(), pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "--set-attr") {
+		t.Errorf("patch passes node attributes as flags: %s", raw)
+	}
+	if !strings.Contains(string(raw), `{\"custom:app\":\"web\"}`) {
+		t.Errorf("patch does not record the node attributes: %s", raw)
+	}
+}
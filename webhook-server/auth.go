@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	annotationAuthKeySecret = "tailscale.com/authkey-secret"
+
+	// annotationAuthKeySecretUsed records the auth key source the sidecar
+	// was injected with, never the key itself.
+	annotationAuthKeySecretUsed = "tailscale.com/authkey-secret-used"
+
+	// annotationKeyReuse selects between a reusable auth key, e.g. for
+	// long-lived StatefulSet pods, and a single-use one, e.g. for Jobs.
+	annotationKeyReuse = "tailscale.com/key-reuse"
+	keyReuseReusable   = "reusable"
+	keyReuseSingle     = "single"
+)
+
+// secretExists reports whether the secret exists in the namespace. Without a
+// Kubernetes client, or when the lookup fails for another reason than the
+// secret missing, the secret is assumed to exist.
+func secretExists(ctx context.Context, namespace, name string) bool {
+	if kubeClient == nil {
+		return true
+	}
+	_, err := kubeClient.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error looking up secret %s/%s, assuming it exists: %v", namespace, name, err)
+	}
+	return true
+}
+
+// authKeySecretRef references the auth key in a secret. The reference is
+// optional unless TS_AUTHKEY_OPTIONAL=false, in which case the kubelet fails
+// the pod when the secret or key is missing instead of starting an
+// unauthenticated sidecar.
+func authKeySecretRef(name, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: "TS_AUTHKEY",
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: name,
+				},
+				Key:      key,
+				Optional: boolPtr(getEnv("TS_AUTHKEY_OPTIONAL", "true") != "false"),
+			},
+		},
+	}
+}
+
+// getAuthKeySecretKey returns the key of the auth key secret to use: by
+// default TS_AUTHKEY_SECRET_KEY, or with the tailscale.com/key-reuse
+// annotation TS_AUTHKEY_REUSABLE_KEY (default TS_AUTHKEY_REUSABLE) or
+// TS_AUTHKEY_SINGLE_KEY (default TS_AUTHKEY_SINGLE), so one secret can hold
+// both kinds of keys.
+func getAuthKeySecretKey(pod *corev1.Pod) (string, error) {
+	env, defaultKey := "TS_AUTHKEY_SECRET_KEY", "TS_AUTHKEY"
+	if value, ok := pod.Annotations[annotationKeyReuse]; ok {
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case keyReuseReusable:
+			env, defaultKey = "TS_AUTHKEY_REUSABLE_KEY", "TS_AUTHKEY_REUSABLE"
+		case keyReuseSingle:
+			env, defaultKey = "TS_AUTHKEY_SINGLE_KEY", "TS_AUTHKEY_SINGLE"
+		default:
+			return "", field.NotSupported(annotationPath(annotationKeyReuse), value, []string{keyReuseReusable, keyReuseSingle})
+		}
+	}
+	key := getEnv(env, defaultKey)
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return "", fmt.Errorf("invalid %s %q: %s", env, key, strings.Join(errs, "; "))
+	}
+	return key, nil
+}
+
+// resolveAuthSource returns the TS_AUTHKEY env var for the sidecar, reading
+// the key from getAuthKeySecretKey and trying in order:
+//
+//  1. the secret named by the tailscale.com/authkey-secret annotation
+//  2. the auth key secret of the pod's tailnet, if it selects one, or else
+//     the global TS_AUTHKEY_SECRET secret (default tailscale-auth)
+//  3. the auth key file at TS_AUTHKEY_FILE, which must be mounted into the
+//     sidecar, e.g. with TS_EXTRA_VOLUMES
+//
+// Secrets are only skipped when they are known to be missing. When nothing
+// resolves the global secret is referenced anyway, unless
+// TS_REQUIRE_AUTHKEY=true in which case the pod is denied.
+func resolveAuthSource(ctx context.Context, pod *corev1.Pod, tailnet *tailnetConfig) (corev1.EnvVar, error) {
+	key, err := getAuthKeySecretKey(pod)
+	if err != nil {
+		return corev1.EnvVar{}, err
+	}
+
+	if name, ok := pod.Annotations[annotationAuthKeySecret]; ok {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return corev1.EnvVar{}, field.Invalid(annotationPath(annotationAuthKeySecret), name, strings.Join(errs, "; "))
+		}
+		if secretExists(ctx, pod.Namespace, name) {
+			return authKeySecretRef(name, key), nil
+		}
+		log.Printf("Auth key secret %s/%s from annotation not found", pod.Namespace, name)
+	}
+
+	globalSecret := getEnv("TS_AUTHKEY_SECRET", "tailscale-auth")
+	if tailnet != nil {
+		globalSecret = tailnet.AuthKeySecret
+	}
+	if secretExists(ctx, pod.Namespace, globalSecret) {
+		return authKeySecretRef(globalSecret, key), nil
+	}
+
+	if path := getEnv("TS_AUTHKEY_FILE", ""); path != "" {
+		return corev1.EnvVar{Name: "TS_AUTHKEY", Value: "file:" + path}, nil
+	}
+
+	if getEnv("TS_REQUIRE_AUTHKEY", "false") == "true" {
+		return corev1.EnvVar{}, fmt.Errorf("no Tailscale auth key found for namespace %s: create the %s secret, set the %s annotation, or configure TS_AUTHKEY_FILE", pod.Namespace, globalSecret, annotationAuthKeySecret)
+	}
+	return authKeySecretRef(globalSecret, key), nil
+}
+
+// authSourceName describes the auth key source of a TS_AUTHKEY env var from
+// resolveAuthSource: the secret name, or file:<path> for an auth key file.
+func authSourceName(env corev1.EnvVar) string {
+	if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+		return env.ValueFrom.SecretKeyRef.Name
+	}
+	return env.Value
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// withKubeClient replaces kubeClient with a fake holding objects for the
+// duration of the test.
+func withKubeClient(t *testing.T, objects ...runtime.Object) {
+	t.Helper()
+	previous := kubeClient
+	kubeClient = fake.NewSimpleClientset(objects...)
+	t.Cleanup(func() { kubeClient = previous })
+}
+
+func testSecret(namespace, name string) *corev1.Secret {
+	return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+func TestResolveAuthSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		secrets     []runtime.Object
+		annotations map[string]string
+		tailnet     *tailnetConfig
+		env         map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:        "annotation secret",
+			secrets:     []runtime.Object{testSecret("prod", "team-auth"), testSecret("prod", "tailscale-auth")},
+			annotations: map[string]string{annotationAuthKeySecret: "team-auth"},
+			want:        "team-auth",
+		},
+		{
+			name:        "missing annotation secret falls back to global secret",
+			secrets:     []runtime.Object{testSecret("prod", "tailscale-auth")},
+			annotations: map[string]string{annotationAuthKeySecret: "team-auth"},
+			want:        "tailscale-auth",
+		},
+		{
+			name:        "invalid annotation secret",
+			annotations: map[string]string{annotationAuthKeySecret: "Team_Auth"},
+			wantErr:     true,
+		},
+		{
+			name:    "global secret",
+			secrets: []runtime.Object{testSecret("prod", "custom-auth")},
+			env:     map[string]string{"TS_AUTHKEY_SECRET": "custom-auth"},
+			want:    "custom-auth",
+		},
+		{
+			name:    "tailnet secret replaces global secret",
+			secrets: []runtime.Object{testSecret("prod", "tailscale-auth"), testSecret("prod", "lab-auth")},
+			tailnet: &tailnetConfig{LoginServer: "https://lab.example.com", AuthKeySecret: "lab-auth"},
+			want:    "lab-auth",
+		},
+		{
+			name: "auth key file",
+			env:  map[string]string{"TS_AUTHKEY_FILE": "/etc/tailscale/authkey"},
+			want: "file:/etc/tailscale/authkey",
+		},
+		{
+			name: "none found references global secret",
+			want: "tailscale-auth",
+		},
+		{
+			name:    "none found with auth key required",
+			env:     map[string]string{"TS_REQUIRE_AUTHKEY": "true"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"TS_AUTHKEY_SECRET", "TS_AUTHKEY_FILE", "TS_REQUIRE_AUTHKEY", "TS_AUTHKEY_SECRET_KEY"} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			withKubeClient(t, tt.secrets...)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Annotations: tt.annotations}}
+			env, err := resolveAuthSource(context.Background(), pod, tt.tailnet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAuthSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := authSourceName(env); got != tt.want {
+				t.Errorf("auth source = %q, want %q", got, tt.want)
+			}
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef.Key != "TS_AUTHKEY" {
+				t.Errorf("secret key = %q, want TS_AUTHKEY", env.ValueFrom.SecretKeyRef.Key)
+			}
+		})
+	}
+}
+
+func TestAuthKeySecretUsedAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		secrets     []string
+		annotations map[string]string
+		file        string
+		want        string
+	}{
+		{name: "global secret", secrets: []string{"tailscale-auth"}, want: "tailscale-auth"},
+		{name: "annotation secret", secrets: []string{"tailscale-auth", "web-auth"}, annotations: map[string]string{annotationAuthKeySecret: "web-auth"}, want: "web-auth"},
+		{name: "missing annotation secret", secrets: []string{"tailscale-auth"}, annotations: map[string]string{annotationAuthKeySecret: "web-auth"}, want: "tailscale-auth"},
+		{name: "tailnet secret", secrets: []string{"tailscale-auth", "corp-auth"}, annotations: map[string]string{annotationTailnet: "corp"}, want: "corp-auth"},
+		{name: "auth key file", file: "/var/run/tailscale/authkey", want: "file:/var/run/tailscale/authkey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_TAILNETS", `{"corp": {"loginServer": "https://login.corp.example", "authKeySecret": "corp-auth"}}`)
+			t.Setenv("TS_AUTHKEY_FILE", tt.file)
+			var objects []runtime.Object
+			for _, name := range tt.secrets {
+				objects = append(objects, testSecret("prod", name))
+			}
+			withKubeClient(t, objects...)
+			pod := testInjectedPod()
+			for key, value := range tt.annotations {
+				pod.Annotations[key] = value
+			}
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("generateSidecarPatch() error = %v", err)
+			}
+			patched := applyTestPatches(t, pod, patches)
+			if got := patched.Annotations[annotationAuthKeySecretUsed]; got != tt.want {
+				t.Errorf("%s = %q, want %q", annotationAuthKeySecretUsed, got, tt.want)
+			}
+			sidecar, _ := sidecarFromPatch(patches)
+			for _, env := range sidecar.Env {
+				if env.Name == "TS_AUTHKEY" && authSourceName(env) != tt.want {
+					t.Errorf("TS_AUTHKEY source = %q, want %q", authSourceName(env), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthKeySecretRefOptional(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{value: "", want: true},
+		{value: "true", want: true},
+		{value: "false", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TS_AUTHKEY_OPTIONAL", tt.value)
+			env := authKeySecretRef("tailscale-auth", "TS_AUTHKEY")
+			ref := env.ValueFrom.SecretKeyRef
+			if ref.Name != "tailscale-auth" || ref.Key != "TS_AUTHKEY" {
+				t.Errorf("authKeySecretRef() = %s/%s, want tailscale-auth/TS_AUTHKEY", ref.Name, ref.Key)
+			}
+			if ref.Optional == nil || *ref.Optional != tt.want {
+				t.Errorf("authKeySecretRef().Optional = %v, want %v", ref.Optional, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAuthKeySecretKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation *string
+		env        map[string]string
+		want       string
+		wantErr    bool
+	}{
+		{name: "default", want: "TS_AUTHKEY"},
+		{name: "configured default", env: map[string]string{"TS_AUTHKEY_SECRET_KEY": "authkey"}, want: "authkey"},
+		{name: "reusable", annotation: stringPtr("reusable"), want: "TS_AUTHKEY_REUSABLE"},
+		{name: "reusable configured", annotation: stringPtr(" Reusable "), env: map[string]string{"TS_AUTHKEY_REUSABLE_KEY": "reusable-key"}, want: "reusable-key"},
+		{name: "single", annotation: stringPtr("single"), want: "TS_AUTHKEY_SINGLE"},
+		{name: "single configured", annotation: stringPtr("SINGLE"), env: map[string]string{"TS_AUTHKEY_SINGLE_KEY": "single-key"}, want: "single-key"},
+		{name: "invalid annotation", annotation: stringPtr("ephemeral"), wantErr: true},
+		{name: "empty annotation", annotation: stringPtr(""), wantErr: true},
+		{name: "invalid key", env: map[string]string{"TS_AUTHKEY_SECRET_KEY": "auth key"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{"TS_AUTHKEY_SECRET_KEY", "TS_AUTHKEY_REUSABLE_KEY", "TS_AUTHKEY_SINGLE_KEY"} {
+				t.Setenv(env, tt.env[env])
+			}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tt.annotation != nil {
+				pod.Annotations[annotationKeyReuse] = *tt.annotation
+			}
+			got, err := getAuthKeySecretKey(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAuthKeySecretKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getAuthKeySecretKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyReuseDenied(t *testing.T) {
+	pod := testInjectedPod()
+	pod.Annotations[annotationKeyReuse] = "ephemeral"
+	response := reviewPod(t, mutateHandler, pod)
+	if response.Allowed {
+		t.Fatal("response allowed, want an invalid key-reuse value denied")
+	}
+	causes := response.Result.Details
+	if causes == nil || len(causes.Causes) != 1 || causes.Causes[0].Field != "metadata.annotations[tailscale.com/key-reuse]" {
+		t.Errorf("response details = %+v, want the key-reuse annotation", causes)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// getCertReloadInterval returns TLS_RELOAD_INTERVAL, how often the serving
+// certificate files are checked for changes (default: 1m, 0 disables).
+func getCertReloadInterval() (time.Duration, error) {
+	value := getEnv("TLS_RELOAD_INTERVAL", "1m")
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid TLS_RELOAD_INTERVAL %q: must be a non-negative duration", value)
+	}
+	return interval, nil
+}
+
+// certReloader serves the certificate and key from disk, reloading them when
+// they change, e.g. after cert-manager rotated the secret mounted into the
+// webhook. Connections established with the old certificate are kept; only
+// new handshakes get the new one.
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	cert atomic.Pointer[tls.Certificate]
+	// modTimes are the modification times of the loaded certificate and key
+	modTimes [2]time.Time
+}
+
+// newCertReloader loads the certificate and key, failing when they cannot be
+// loaded.
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the certificate and key when either file changed since the
+// last load, reporting whether a new certificate is served. On error the
+// current certificate is kept.
+func (r *certReloader) reload() (bool, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certPath, r.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	if r.cert.Load() != nil && modTimes == r.modTimes {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return false, err
+	}
+	r.cert.Store(&cert)
+	r.modTimes = modTimes
+	return true, nil
+}
+
+// getCertificate is the tls.Config GetCertificate callback.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// watch reloads the certificate every interval. Files are compared by
+// modification time rather than watched, which also covers the atomic
+// symlink swap the kubelet uses to update secret volumes.
+func (r *certReloader) watch(interval time.Duration) {
+	if interval == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			changed, err := r.reload()
+			if err != nil {
+				log.Printf("Error reloading certificate %s, serving the previous one: %v", r.certPath, err)
+				continue
+			}
+			if changed {
+				log.Printf("Reloaded certificate %s", r.certPath)
+			}
+		}
+	}()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed certificate for commonName and its key
+// to certPath and keyPath, stamping both with modTime.
+func writeTestCert(t *testing.T, certPath, keyPath, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, block := range map[string]*pem.Block{
+		certPath: {Type: "CERTIFICATE", Bytes: der},
+		keyPath:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// servedCommonName connects to addr and returns the common name of the
+// certificate the server presents.
+func servedCommonName(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReloaderSwap(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	start := time.Now().Add(-time.Minute)
+	writeTestCert(t, certPath, keyPath, "old", start)
+
+	reloader, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Served like main does, with GetCertificate and no static certificate
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: reloader.getCertificate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.NotFoundHandler()}
+	go server.Serve(listener)
+	defer server.Close()
+	addr := listener.Addr().String()
+
+	if got := servedCommonName(t, addr); got != "old" {
+		t.Fatalf("served %q before rotation, want old", got)
+	}
+
+	tests := []struct {
+		name        string
+		rotate      func()
+		wantChanged bool
+		wantErr     bool
+		wantServed  string
+	}{
+		{
+			name:       "unchanged",
+			rotate:     func() {},
+			wantServed: "old",
+		},
+		{
+			name:        "rotated",
+			rotate:      func() { writeTestCert(t, certPath, keyPath, "new", start.Add(time.Second)) },
+			wantChanged: true,
+			wantServed:  "new",
+		},
+		{
+			name: "broken rotation keeps serving",
+			rotate: func() {
+				if err := os.WriteFile(certPath, []byte("garbage"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr:    true,
+			wantServed: "new",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rotate()
+			changed, err := reloader.reload()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("reload() changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if got := servedCommonName(t, addr); got != tt.wantServed {
+				t.Errorf("served %q, want %q", got, tt.wantServed)
+			}
+		})
+	}
+}
+
+func TestNewCertReloaderMissing(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Error("newCertReloader() succeeded without certificate files")
+	}
+}
+
+func TestGetCertReloadInterval(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "", want: time.Minute},
+		{value: "0", want: 0},
+		{value: "30s", want: 30 * time.Second},
+		{value: "-1s", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TLS_RELOAD_INTERVAL", tt.value)
+			got, err := getCertReloadInterval()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getCertReloadInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getCertReloadInterval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
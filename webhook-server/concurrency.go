@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// mutationSlots bounds the number of admissions doing API lookups and patch
+// generation at once. It is nil unless MAX_CONCURRENT_MUTATIONS is set.
+var mutationSlots chan struct{}
+
+// getMaxConcurrentMutations returns MAX_CONCURRENT_MUTATIONS (0 for
+// unlimited) and MUTATION_QUEUE_TIMEOUT, how long a request waits for a free
+// slot (default: 2s).
+func getMaxConcurrentMutations() (int, time.Duration, error) {
+	value := getEnv("MAX_CONCURRENT_MUTATIONS", "0")
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, 0, fmt.Errorf("invalid MAX_CONCURRENT_MUTATIONS %q: must be a non-negative integer", value)
+	}
+	value = getEnv("MUTATION_QUEUE_TIMEOUT", "2s")
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, 0, fmt.Errorf("invalid MUTATION_QUEUE_TIMEOUT %q: must be a non-negative duration", value)
+	}
+	return limit, timeout, nil
+}
+
+func initMutationSlots() {
+	limit, _, err := getMaxConcurrentMutations()
+	if err != nil || limit == 0 {
+		return
+	}
+	mutationSlots = make(chan struct{}, limit)
+	log.Printf("Limiting concurrent mutations to %d", limit)
+}
+
+// acquireMutationSlot waits up to MUTATION_QUEUE_TIMEOUT for a free slot. It
+// returns a function releasing the slot, or false when the webhook stayed
+// saturated or the request was cancelled.
+func acquireMutationSlot(ctx context.Context, slots chan struct{}) (func(), bool) {
+	if slots == nil {
+		return func() {}, true
+	}
+	release := func() { <-slots }
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	_, timeout, _ := getMaxConcurrentMutations()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil, false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetMaxConcurrentMutations(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       string
+		timeout     string
+		wantLimit   int
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{name: "defaults", wantTimeout: 2 * time.Second},
+		{name: "set", limit: "4", timeout: "500ms", wantLimit: 4, wantTimeout: 500 * time.Millisecond},
+		{name: "invalid limit", limit: "four", wantErr: true},
+		{name: "negative limit", limit: "-1", wantErr: true},
+		{name: "invalid timeout", timeout: "soon", wantErr: true},
+		{name: "negative timeout", timeout: "-1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_CONCURRENT_MUTATIONS", tt.limit)
+			t.Setenv("MUTATION_QUEUE_TIMEOUT", tt.timeout)
+			limit, timeout, err := getMaxConcurrentMutations()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMaxConcurrentMutations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if limit != tt.wantLimit || timeout != tt.wantTimeout {
+				t.Errorf("getMaxConcurrentMutations() = %d, %v, want %d, %v", limit, timeout, tt.wantLimit, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestAcquireMutationSlot(t *testing.T) {
+	t.Setenv("MUTATION_QUEUE_TIMEOUT", "20ms")
+
+	if _, ok := acquireMutationSlot(context.Background(), nil); !ok {
+		t.Fatal("acquireMutationSlot(nil) = false, want unlimited")
+	}
+
+	slots := make(chan struct{}, 1)
+	release, ok := acquireMutationSlot(context.Background(), slots)
+	if !ok {
+		t.Fatal("acquireMutationSlot() on a free slot = false")
+	}
+	if _, ok := acquireMutationSlot(context.Background(), slots); ok {
+		t.Fatal("acquireMutationSlot() while saturated = true, want timeout")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	t.Setenv("MUTATION_QUEUE_TIMEOUT", "1m")
+	if _, ok := acquireMutationSlot(ctx, slots); ok {
+		t.Fatal("acquireMutationSlot() with a cancelled request = true")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	if _, ok := acquireMutationSlot(context.Background(), slots); !ok {
+		t.Fatal("acquireMutationSlot() after release = false, want the freed slot")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// containerValidationEnabled reports whether TS_VALIDATE_CONTAINER is set,
+// checking the generated sidecar before it is returned instead of leaving
+// mistakes to the API server.
+func containerValidationEnabled() bool {
+	return getEnv("TS_VALIDATE_CONTAINER", "false") == "true"
+}
+
+// validateSidecarContainer checks the generated sidecar and the volumes added
+// for it with the same rules the API server applies to those fields, so that
+// a bad configuration is reported with its field path instead of as an
+// opaque rejection of the patched pod. volumes are the volumes added by the
+// webhook; mounts may also refer to the pod's own volumes.
+func validateSidecarContainer(pod *corev1.Pod, container corev1.Container, volumes []corev1.Volume, path *field.Path) error {
+	var errs field.ErrorList
+
+	for _, msg := range validation.IsDNS1123Label(container.Name) {
+		errs = append(errs, field.Invalid(path.Child("name"), container.Name, msg))
+	}
+	if strings.TrimSpace(container.Image) == "" {
+		errs = append(errs, field.Required(path.Child("image"), ""))
+	}
+
+	for i, env := range container.Env {
+		envPath := path.Child("env").Index(i)
+		for _, msg := range validation.IsEnvVarName(env.Name) {
+			errs = append(errs, field.Invalid(envPath.Child("name"), env.Name, msg))
+		}
+		if env.Value != "" && env.ValueFrom != nil {
+			errs = append(errs, field.Invalid(envPath.Child("valueFrom"), "", "may not be specified when `value` is not empty"))
+		}
+	}
+
+	portNames := sets.New[string]()
+	for i, port := range container.Ports {
+		portPath := path.Child("ports").Index(i)
+		for _, msg := range validation.IsValidPortNum(int(port.ContainerPort)) {
+			errs = append(errs, field.Invalid(portPath.Child("containerPort"), port.ContainerPort, msg))
+		}
+		if port.Name != "" {
+			for _, msg := range validation.IsValidPortName(port.Name) {
+				errs = append(errs, field.Invalid(portPath.Child("name"), port.Name, msg))
+			}
+			if portNames.Has(port.Name) {
+				errs = append(errs, field.Duplicate(portPath.Child("name"), port.Name))
+			}
+			portNames.Insert(port.Name)
+		}
+		switch port.Protocol {
+		case "", corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+		default:
+			errs = append(errs, field.NotSupported(portPath.Child("protocol"), port.Protocol, []string{string(corev1.ProtocolTCP), string(corev1.ProtocolUDP), string(corev1.ProtocolSCTP)}))
+		}
+	}
+
+	resourcesPath := path.Child("resources")
+	for name, request := range container.Resources.Requests {
+		if request.Sign() < 0 {
+			errs = append(errs, field.Invalid(resourcesPath.Child("requests").Key(string(name)), request.String(), "must be greater than or equal to 0"))
+		}
+		if limit, ok := container.Resources.Limits[name]; ok && request.Cmp(limit) > 0 {
+			errs = append(errs, field.Invalid(resourcesPath.Child("requests").Key(string(name)), request.String(), "must be less than or equal to "+string(name)+" limit of "+limit.String()))
+		}
+	}
+	for name, limit := range container.Resources.Limits {
+		if limit.Sign() < 0 {
+			errs = append(errs, field.Invalid(resourcesPath.Child("limits").Key(string(name)), limit.String(), "must be greater than or equal to 0"))
+		}
+	}
+
+	volumeNames := sets.New[string]()
+	for i, volume := range volumes {
+		for _, msg := range validation.IsDNS1123Label(volume.Name) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "volumes").Index(i).Child("name"), volume.Name, msg))
+		}
+		volumeNames.Insert(volume.Name)
+	}
+	mountPaths := sets.New[string]()
+	for i, mount := range container.VolumeMounts {
+		mountPath := path.Child("volumeMounts").Index(i)
+		if !volumeNames.Has(mount.Name) && !hasVolume(pod.Spec.Volumes, mount.Name) {
+			errs = append(errs, field.NotFound(mountPath.Child("name"), mount.Name))
+		}
+		if mount.MountPath == "" {
+			errs = append(errs, field.Required(mountPath.Child("mountPath"), ""))
+		} else if mountPaths.Has(mount.MountPath) {
+			errs = append(errs, field.Invalid(mountPath.Child("mountPath"), mount.MountPath, "must be unique"))
+		}
+		mountPaths.Insert(mount.MountPath)
+	}
+
+	return errs.ToAggregate()
+}
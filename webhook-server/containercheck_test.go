@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestValidateSidecarContainer(t *testing.T) {
+	valid := func() corev1.Container {
+		return corev1.Container{
+			Name:         "ts-sidecar",
+			Image:        "tailscale/tailscale:stable",
+			Env:          []corev1.EnvVar{{Name: "TS_USERSPACE", Value: "true"}},
+			Ports:        []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9002}},
+			VolumeMounts: []corev1.VolumeMount{{Name: "ts-state", MountPath: "/var/lib/tailscale"}},
+		}
+	}
+	volumes := []corev1.Volume{{Name: "ts-state"}}
+	tests := []struct {
+		name     string
+		mutate   func(*corev1.Container)
+		podVols  []corev1.Volume
+		volumes  []corev1.Volume
+		wantPath string
+	}{
+		{name: "valid", volumes: volumes},
+		{name: "pod volume", podVols: volumes},
+		{name: "bad name", mutate: func(c *corev1.Container) { c.Name = "TS_Sidecar" }, volumes: volumes, wantPath: "spec.containers[0].name"},
+		{name: "no image", mutate: func(c *corev1.Container) { c.Image = " " }, volumes: volumes, wantPath: "spec.containers[0].image"},
+		{name: "bad env name", mutate: func(c *corev1.Container) { c.Env[0].Name = "1BAD=" }, volumes: volumes, wantPath: "spec.containers[0].env[0].name"},
+		{
+			name: "value and valueFrom",
+			mutate: func(c *corev1.Container) {
+				c.Env[0].ValueFrom = &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}
+			},
+			volumes:  volumes,
+			wantPath: "spec.containers[0].env[0].valueFrom",
+		},
+		{name: "bad port", mutate: func(c *corev1.Container) { c.Ports[0].ContainerPort = 70000 }, volumes: volumes, wantPath: "spec.containers[0].ports[0].containerPort"},
+		{
+			name: "duplicate port name",
+			mutate: func(c *corev1.Container) {
+				c.Ports = append(c.Ports, corev1.ContainerPort{Name: "metrics", ContainerPort: 9003})
+			},
+			volumes:  volumes,
+			wantPath: "spec.containers[0].ports[1].name",
+		},
+		{name: "bad protocol", mutate: func(c *corev1.Container) { c.Ports[0].Protocol = "ICMP" }, volumes: volumes, wantPath: "spec.containers[0].ports[0].protocol"},
+		{
+			name: "request above limit",
+			mutate: func(c *corev1.Container) {
+				c.Resources.Requests = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")}
+				c.Resources.Limits = corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("100m")}
+			},
+			volumes:  volumes,
+			wantPath: "spec.containers[0].resources.requests[cpu]",
+		},
+		{name: "missing volume", wantPath: "spec.containers[0].volumeMounts[0].name"},
+		{name: "bad volume name", volumes: []corev1.Volume{{Name: "ts-state"}, {Name: "TS_State"}}, wantPath: "spec.volumes[1].name"},
+		{
+			name:     "duplicate mount path",
+			mutate:   func(c *corev1.Container) { c.VolumeMounts = append(c.VolumeMounts, c.VolumeMounts[0]) },
+			volumes:  volumes,
+			wantPath: "spec.containers[0].volumeMounts[1].mountPath",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := valid()
+			if tt.mutate != nil {
+				tt.mutate(&container)
+			}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: tt.podVols}}
+			err := validateSidecarContainer(pod, container, tt.volumes, field.NewPath("spec", "containers").Index(0))
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Fatalf("validateSidecarContainer() error = %v", err)
+				}
+				return
+			}
+			var aggregate utilerrors.Aggregate
+			if !errors.As(err, &aggregate) {
+				t.Fatalf("validateSidecarContainer() error = %v, want an error at %s", err, tt.wantPath)
+			}
+			for _, e := range aggregate.Errors() {
+				var fieldErr *field.Error
+				if errors.As(e, &fieldErr) && fieldErr.Field == tt.wantPath {
+					return
+				}
+			}
+			t.Errorf("validateSidecarContainer() error = %v, want an error at %s", err, tt.wantPath)
+		})
+	}
+}
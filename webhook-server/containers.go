@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const annotationPrimaryContainer = "tailscale.com/primary-container"
+
+// isInjectedContainer reports whether a container was added by the webhook.
+func isInjectedContainer(name string) bool {
+	return name == "ts-sidecar" || strings.HasPrefix(name, "ts-sidecar-") || name == configReloaderName
+}
+
+// getPrimaryContainer returns the index in pod.Spec.Containers of the app
+// container that features patching the app (proxy env, shared volumes)
+// apply to. It is named by the tailscale.com/primary-container annotation,
+// or else the first container not injected by the webhook. It returns -1
+// when the pod has no app container.
+func getPrimaryContainer(pod *corev1.Pod) (int, error) {
+	if name, ok := pod.Annotations[annotationPrimaryContainer]; ok {
+		for i, container := range pod.Spec.Containers {
+			if container.Name == name {
+				return i, nil
+			}
+		}
+		return -1, field.NotFound(annotationPath(annotationPrimaryContainer), name)
+	}
+	for i, container := range pod.Spec.Containers {
+		if !isInjectedContainer(container.Name) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPrimaryContainer(t *testing.T) {
+	containers := []corev1.Container{{Name: "ts-sidecar"}, {Name: "app"}, {Name: "worker"}}
+	tests := []struct {
+		name        string
+		containers  []corev1.Container
+		annotations map[string]string
+		want        int
+		wantErr     bool
+	}{
+		{name: "first app container", containers: containers, want: 1},
+		{name: "annotation", containers: containers, annotations: map[string]string{annotationPrimaryContainer: "worker"}, want: 2},
+		{name: "annotation not found", containers: containers, annotations: map[string]string{annotationPrimaryContainer: "db"}, want: -1, wantErr: true},
+		{name: "only injected", containers: []corev1.Container{{Name: "ts-sidecar"}, {Name: configReloaderName}}, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: tt.containers},
+			}
+			got, err := getPrimaryContainer(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPrimaryContainer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPrimaryContainer() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsInjectedContainer(t *testing.T) {
+	for name, want := range map[string]bool{
+		"ts-sidecar":        true,
+		"ts-sidecar-egress": true,
+		configReloaderName:  true,
+		"app":               false,
+		"ts-sidecarx":       false,
+	} {
+		if got := isInjectedContainer(name); got != want {
+			t.Errorf("isInjectedContainer(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
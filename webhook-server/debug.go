@@ -0,0 +1,40 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	debugHeader      = "X-TS-Debug"
+	debugTokenHeader = "X-TS-Debug-Token"
+)
+
+// debugRequested reports whether the request asked for verbose logging of its
+// own injection decision. The X-TS-Debug header is only honored together
+// with an X-TS-Debug-Token header matching DEBUG_TOKEN, so per-request debug
+// logging is disabled unless a token is configured.
+func debugRequested(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(debugHeader), "true") && debugTokenValid(r)
+}
+
+// debugTokenValid reports whether the request carries the configured
+// DEBUG_TOKEN. It is always false when no token is configured.
+func debugTokenValid(r *http.Request) bool {
+	token := getEnv("DEBUG_TOKEN", "")
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(debugTokenHeader)), []byte(token)) == 1
+}
+
+// debugf logs a debug message when LOG_LEVEL=debug. Unlike per-request debug
+// logging it applies to all requests, for messages that are only needed to
+// audit decisions.
+func debugf(format string, args ...interface{}) {
+	if getEnv("LOG_LEVEL", "info") == "debug" {
+		log.Printf("[debug] "+format, args...)
+	}
+}
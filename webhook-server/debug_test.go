@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugRequested(t *testing.T) {
+	tests := []struct {
+		name          string
+		configured    string
+		debug         string
+		token         string
+		want          bool
+		wantTokenOnly bool
+	}{
+		{name: "no token configured", debug: "true", token: "secret"},
+		{name: "valid", configured: "secret", debug: "TRUE", token: "secret", want: true, wantTokenOnly: true},
+		{name: "wrong token", configured: "secret", debug: "true", token: "guess"},
+		{name: "missing token", configured: "secret", debug: "true"},
+		{name: "header off", configured: "secret", debug: "false", token: "secret", wantTokenOnly: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DEBUG_TOKEN", tt.configured)
+			r := httptest.NewRequest("POST", "/mutate", nil)
+			if tt.debug != "" {
+				r.Header.Set(debugHeader, tt.debug)
+			}
+			if tt.token != "" {
+				r.Header.Set(debugTokenHeader, tt.token)
+			}
+			if got := debugRequested(r); got != tt.want {
+				t.Errorf("debugRequested() = %v, want %v", got, tt.want)
+			}
+			if got := debugTokenValid(r); got != tt.wantTokenOnly {
+				t.Errorf("debugTokenValid() = %v, want %v", got, tt.wantTokenOnly)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// annotationAcceptDNS set to false stops tailscaled from taking over DNS
+	// with MagicDNS, e.g. when it conflicts with cluster DNS.
+	annotationAcceptDNS = "tailscale.com/accept-dns"
+	// annotationDNSResolvers adds comma separated nameservers to the pod's
+	// dnsConfig.
+	annotationDNSResolvers = "tailscale.com/dns-resolvers"
+
+	// maxNameservers is the most nameservers a pod's dnsConfig may list.
+	maxNameservers = 3
+)
+
+// getAcceptDNS returns the tailscale.com/accept-dns annotation, or nil when
+// unset, leaving the image default.
+func getAcceptDNS(pod *corev1.Pod) (*bool, error) {
+	value, ok := pod.Annotations[annotationAcceptDNS]
+	if !ok {
+		return nil, nil
+	}
+	accept, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return nil, field.Invalid(annotationPath(annotationAcceptDNS), value, "must be true or false")
+	}
+	return &accept, nil
+}
+
+// getDNSResolvers returns the nameservers from tailscale.com/dns-resolvers
+// that the pod's dnsConfig does not list yet. Together they must stay within
+// the Kubernetes limit of maxNameservers.
+func getDNSResolvers(pod *corev1.Pod) ([]string, error) {
+	value, ok := pod.Annotations[annotationDNSResolvers]
+	if !ok {
+		return nil, nil
+	}
+	path := annotationPath(annotationDNSResolvers)
+	var existing []string
+	if pod.Spec.DNSConfig != nil {
+		existing = pod.Spec.DNSConfig.Nameservers
+	}
+
+	var resolvers []string
+	for _, resolver := range strings.Split(value, ",") {
+		resolver = strings.TrimSpace(resolver)
+		if resolver == "" {
+			continue
+		}
+		if net.ParseIP(resolver) == nil {
+			return nil, field.Invalid(path, value, fmt.Sprintf("%q is not an IP address", resolver))
+		}
+		if !containsString(existing, resolver) && !containsString(resolvers, resolver) {
+			resolvers = append(resolvers, resolver)
+		}
+	}
+	if len(resolvers) == 0 && len(existing) == 0 {
+		return nil, field.Invalid(path, value, "must list at least one IP address")
+	}
+	if len(existing)+len(resolvers) > maxNameservers {
+		return nil, field.TooMany(path, len(existing)+len(resolvers), maxNameservers)
+	}
+	return resolvers, nil
+}
+
+// addDNSResolversPatch appends resolvers to the pod's dnsConfig nameservers,
+// keeping its other dnsConfig settings.
+func addDNSResolversPatch(pod *corev1.Pod, resolvers []string) []patchOperation {
+	if len(resolvers) == 0 {
+		return nil
+	}
+	if pod.Spec.DNSConfig == nil {
+		return []patchOperation{{
+			Op:    "add",
+			Path:  "/spec/dnsConfig",
+			Value: corev1.PodDNSConfig{Nameservers: resolvers},
+		}}
+	}
+	if len(pod.Spec.DNSConfig.Nameservers) == 0 {
+		return []patchOperation{{
+			Op:    "add",
+			Path:  "/spec/dnsConfig/nameservers",
+			Value: resolvers,
+		}}
+	}
+	patches := make([]patchOperation, 0, len(resolvers))
+	for _, resolver := range resolvers {
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  "/spec/dnsConfig/nameservers/-",
+			Value: resolver,
+		})
+	}
+	return patches
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetAcceptDNS(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "unset", want: "<nil>"},
+		{name: "false", value: "false", want: "false"},
+		{name: "true", value: " true ", want: "true"},
+		{name: "invalid", value: "off", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			if tt.value != "" {
+				pod.Annotations = map[string]string{annotationAcceptDNS: tt.value}
+			}
+			got, err := getAcceptDNS(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAcceptDNS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			gotValue := "<nil>"
+			if got != nil {
+				gotValue = strconv.FormatBool(*got)
+			}
+			if gotValue != tt.want {
+				t.Errorf("getAcceptDNS() = %s, want %s", gotValue, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSResolvers(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		dnsConfig *corev1.PodDNSConfig
+		want      []string
+		wantErr   bool
+	}{
+		{name: "no dnsConfig", value: "100.100.100.100, 8.8.8.8", want: []string{"100.100.100.100", "8.8.8.8"}},
+		{name: "empty nameservers", value: "100.100.100.100", dnsConfig: &corev1.PodDNSConfig{Searches: []string{"ts.net"}}, want: []string{"100.100.100.100"}},
+		{name: "append", value: "100.100.100.100,1.1.1.1", dnsConfig: &corev1.PodDNSConfig{Nameservers: []string{"1.1.1.1"}}, want: []string{"1.1.1.1", "100.100.100.100"}},
+		{name: "duplicates", value: "100.100.100.100,100.100.100.100", want: []string{"100.100.100.100"}},
+		{name: "not an IP", value: "dns.example.com", wantErr: true},
+		{name: "empty", value: " , ", wantErr: true},
+		{name: "too many", value: "1.1.1.1,8.8.8.8", dnsConfig: &corev1.PodDNSConfig{Nameservers: []string{"9.9.9.9", "8.8.4.4"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annotationDNSResolvers: tt.value}},
+				Spec:       corev1.PodSpec{DNSConfig: tt.dnsConfig},
+			}
+			resolvers, err := getDNSResolvers(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getDNSResolvers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// Apply the patch and check the resulting nameservers, keeping
+			// the rest of the pod's dnsConfig.
+			raw, err := json.Marshal(pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc interface{}
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				t.Fatal(err)
+			}
+			for _, patch := range addDNSResolversPatch(pod, resolvers) {
+				if doc, err = applyAddPatch(doc, patch); err != nil {
+					t.Fatalf("applying %s: %v", patch.Path, err)
+				}
+			}
+			if raw, err = json.Marshal(doc); err != nil {
+				t.Fatal(err)
+			}
+			patched := &corev1.Pod{}
+			if err := json.Unmarshal(raw, patched); err != nil {
+				t.Fatal(err)
+			}
+			if got := patched.Spec.DNSConfig.Nameservers; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patched nameservers = %q, want %q", got, tt.want)
+			}
+			if tt.dnsConfig != nil && !reflect.DeepEqual(patched.Spec.DNSConfig.Searches, tt.dnsConfig.Searches) {
+				t.Errorf("patched searches = %q, want %q", patched.Spec.DNSConfig.Searches, tt.dnsConfig.Searches)
+			}
+		})
+	}
+}
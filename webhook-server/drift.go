@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// checkSidecarDrift compares an already injected sidecar against the sidecar
+// the current config would inject, and returns a warning describing the
+// differences, or "" when they match. Drift usually means the pod was
+// injected by an older webhook version or config. TS_DRIFT_CHECK=false
+// disables the check.
+func checkSidecarDrift(ctx context.Context, pod *corev1.Pod, existing corev1.Container) string {
+	if getEnv("TS_DRIFT_CHECK", "true") == "false" {
+		return ""
+	}
+
+	// Generate against the pod as it was before injection
+	original := pod.DeepCopy()
+	original.Spec.Containers = withoutInjectedContainers(original.Spec.Containers)
+	original.Spec.InitContainers = withoutInjectedContainers(original.Spec.InitContainers)
+	patches, _, err := generateSidecarPatch(ctx, original)
+	if err != nil {
+		log.Printf("Cannot check sidecar drift for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return ""
+	}
+	expected, ok := sidecarFromPatch(patches)
+	if !ok {
+		return ""
+	}
+
+	var drift []string
+	if existing.Image != expected.Image {
+		drift = append(drift, fmt.Sprintf("image %s, expected %s", existing.Image, expected.Image))
+	}
+	if fields := envDrift(existing.Env, expected.Env); len(fields) > 0 {
+		drift = append(drift, "env "+strings.Join(fields, ", "))
+	}
+	if injected := pod.Annotations[annotationWebhookVersion]; injected != version {
+		drift = append(drift, fmt.Sprintf("injected by webhook version %q, running %s", injected, version))
+	}
+	if len(drift) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("existing Tailscale sidecar %s differs from the current config: %s", existing.Name, strings.Join(drift, "; "))
+}
+
+func withoutInjectedContainers(containers []corev1.Container) []corev1.Container {
+	var kept []corev1.Container
+	for _, container := range containers {
+		if !isInjectedContainer(container.Name) {
+			kept = append(kept, container)
+		}
+	}
+	return kept
+}
+
+// sidecarFromPatch returns the sidecar container added by patches.
+func sidecarFromPatch(patches []patchOperation) (corev1.Container, bool) {
+	for _, patch := range patches {
+		switch value := patch.Value.(type) {
+		case corev1.Container:
+			if strings.HasPrefix(value.Name, "ts-sidecar") {
+				return value, true
+			}
+		case []corev1.Container:
+			for _, container := range value {
+				if strings.HasPrefix(container.Name, "ts-sidecar") {
+					return container, true
+				}
+			}
+		}
+	}
+	return corev1.Container{}, false
+}
+
+// envDrift returns the names of env vars that differ between the existing
+// and the expected sidecar. Fields defaulted by the API server, such as the
+// field ref API version, are ignored.
+func envDrift(existing, expected []corev1.EnvVar) []string {
+	values := map[string]string{}
+	for _, env := range existing {
+		values[env.Name] = envSignature(env)
+	}
+	var names []string
+	for _, env := range expected {
+		value, ok := values[env.Name]
+		if !ok || value != envSignature(env) {
+			names = append(names, env.Name)
+		}
+		delete(values, env.Name)
+	}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func envSignature(env corev1.EnvVar) string {
+	source := env.ValueFrom
+	switch {
+	case source == nil:
+		return "value:" + env.Value
+	case source.FieldRef != nil:
+		return "field:" + source.FieldRef.FieldPath
+	case source.SecretKeyRef != nil:
+		return "secret:" + source.SecretKeyRef.Name + "/" + source.SecretKeyRef.Key
+	case source.ConfigMapKeyRef != nil:
+		return "configmap:" + source.ConfigMapKeyRef.Name + "/" + source.ConfigMapKeyRef.Key
+	case source.ResourceFieldRef != nil:
+		return "resource:" + source.ResourceFieldRef.Resource
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestEnvDrift(t *testing.T) {
+	secretRef := func(name string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  "authkey",
+		}}
+	}
+	fieldRef := func(apiVersion string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{APIVersion: apiVersion, FieldPath: "metadata.name"}}
+	}
+	tests := []struct {
+		name     string
+		existing []corev1.EnvVar
+		expected []corev1.EnvVar
+		want     []string
+	}{
+		{name: "equal", existing: []corev1.EnvVar{{Name: "A", Value: "1"}}, expected: []corev1.EnvVar{{Name: "A", Value: "1"}}},
+		{name: "changed value", existing: []corev1.EnvVar{{Name: "A", Value: "1"}}, expected: []corev1.EnvVar{{Name: "A", Value: "2"}}, want: []string{"A"}},
+		{name: "added and removed", existing: []corev1.EnvVar{{Name: "B", Value: "1"}}, expected: []corev1.EnvVar{{Name: "A", Value: "1"}}, want: []string{"A", "B"}},
+		{name: "changed secret", existing: []corev1.EnvVar{{Name: "TS_AUTHKEY", ValueFrom: secretRef("old")}}, expected: []corev1.EnvVar{{Name: "TS_AUTHKEY", ValueFrom: secretRef("new")}}, want: []string{"TS_AUTHKEY"}},
+		{name: "defaulted field ref", existing: []corev1.EnvVar{{Name: "POD_NAME", ValueFrom: fieldRef("v1")}}, expected: []corev1.EnvVar{{Name: "POD_NAME", ValueFrom: fieldRef("")}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := envDrift(tt.existing, tt.expected); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("envDrift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSidecarDrift(t *testing.T) {
+	pod := testInjectedPod()
+	patches, _, err := generateSidecarPatch(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("generateSidecarPatch() error = %v", err)
+	}
+	expected, ok := sidecarFromPatch(patches)
+	if !ok {
+		t.Fatal("generateSidecarPatch() added no sidecar")
+	}
+	pod.Annotations[annotationWebhookVersion] = version
+
+	tests := []struct {
+		name    string
+		disable bool
+		mutate  func(*corev1.Container)
+		want    string
+	}{
+		{name: "unchanged"},
+		{name: "image", mutate: func(c *corev1.Container) { c.Image = "tailscale/tailscale:v1.0.0" }, want: "image tailscale/tailscale:v1.0.0"},
+		{name: "env", mutate: func(c *corev1.Container) { c.Env = append(c.Env, corev1.EnvVar{Name: "TS_DEBUG", Value: "1"}) }, want: "env TS_DEBUG"},
+		{name: "disabled", disable: true, mutate: func(c *corev1.Container) { c.Image = "tailscale/tailscale:v1.0.0" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.disable {
+				t.Setenv("TS_DRIFT_CHECK", "false")
+			}
+			existing := *expected.DeepCopy()
+			if tt.mutate != nil {
+				tt.mutate(&existing)
+			}
+			injected := pod.DeepCopy()
+			injected.Spec.Containers = append(injected.Spec.Containers, existing)
+			got := checkSidecarDrift(context.Background(), injected, existing)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("checkSidecarDrift() = %q, want no drift", got)
+				}
+			} else if !strings.Contains(got, tt.want) {
+				t.Errorf("checkSidecarDrift() = %q, want it to mention %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// annotationEgressOnly lets a pod reach the tailnet without being
+	// reachable from it.
+	annotationEgressOnly = "tailscale.com/egress-only"
+
+	// annotationEgressTarget makes the sidecar an egress proxy: traffic
+	// arriving at the pod IP is forwarded to this tailnet IP or MagicDNS
+	// name.
+	annotationEgressTarget = "tailscale.com/egress-target"
+	// annotationEgressListen exposes the port clients of the egress proxy
+	// connect to as the sidecar's egress container port.
+	annotationEgressListen = "tailscale.com/egress-listen"
+	egressPortName         = "egress"
+)
+
+// egressTarget is a tailnet destination for the egress proxy, either an IP
+// or a fully qualified MagicDNS name.
+type egressTarget struct {
+	IP   string
+	FQDN string
+	Port int32
+}
+
+// getEgressOnly reports whether the pod asks for egress-only mode, which
+// runs tailscale with --shields-up to block inbound connections. Serving
+// ports or a serve certificate contradicts that, so it is rejected together
+// with tailscale.com/forward and tailscale.com/serve-cert-secret.
+func getEgressOnly(pod *corev1.Pod) (bool, error) {
+	value, ok := pod.Annotations[annotationEgressOnly]
+	if !ok {
+		return false, nil
+	}
+	egressOnly, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, field.Invalid(annotationPath(annotationEgressOnly), value, "must be true or false")
+	}
+	if !egressOnly {
+		return false, nil
+	}
+	for _, ingress := range []string{annotationForward, annotationServeCertSecret} {
+		if _, ok := pod.Annotations[ingress]; ok {
+			return false, field.Forbidden(annotationPath(annotationEgressOnly), "cannot be combined with "+ingress+", egress-only pods do not accept inbound tailnet connections")
+		}
+	}
+	return true, nil
+}
+
+// getEgressTarget returns the egress proxy target of the
+// tailscale.com/egress-target annotation, or nil when unset. containerboot
+// forwards with netfilter DNAT rules, so the target needs kernel networking.
+func getEgressTarget(pod *corev1.Pod, userspace bool) (*egressTarget, error) {
+	value, ok := pod.Annotations[annotationEgressTarget]
+	if !ok {
+		if listen, ok := pod.Annotations[annotationEgressListen]; ok {
+			return nil, field.Invalid(annotationPath(annotationEgressListen), listen, "requires "+annotationEgressTarget)
+		}
+		return nil, nil
+	}
+	path := annotationPath(annotationEgressTarget)
+	target := &egressTarget{}
+	host := strings.TrimSpace(value)
+	if ip := net.ParseIP(host); ip != nil {
+		target.IP = ip.String()
+	} else {
+		fqdn := strings.TrimSuffix(host, ".")
+		if errs := validation.IsDNS1123Subdomain(fqdn); len(errs) > 0 {
+			return nil, field.Invalid(path, value, "must be a tailnet IP or MagicDNS name: "+strings.Join(errs, "; "))
+		}
+		if !strings.Contains(fqdn, ".") {
+			return nil, field.Invalid(path, value, "MagicDNS names must be fully qualified, e.g. db.example.ts.net")
+		}
+		target.FQDN = fqdn
+	}
+	if userspace {
+		return nil, field.Invalid(path, value, "egress proxying needs kernel networking mode")
+	}
+
+	if listen, ok := pod.Annotations[annotationEgressListen]; ok {
+		port, err := parsePort(listen)
+		if err != nil {
+			return nil, field.Invalid(annotationPath(annotationEgressListen), listen, err.Error())
+		}
+		target.Port = int32(port)
+	}
+	return target, nil
+}
+
+// applyEgressTarget points containerboot at the egress target and exposes the
+// listen port, if any, so that a Service can route to it.
+func applyEgressTarget(container *corev1.Container, target *egressTarget) {
+	if target.IP != "" {
+		setEnvVar(container, "TS_TAILNET_TARGET_IP", target.IP)
+	} else {
+		setEnvVar(container, "TS_TAILNET_TARGET_FQDN", target.FQDN)
+	}
+	if target.Port != 0 {
+		container.Ports = setContainerPort(container.Ports, corev1.ContainerPort{
+			Name:          egressPortName,
+			ContainerPort: target.Port,
+			Protocol:      corev1.ProtocolTCP,
+		})
+	}
+}
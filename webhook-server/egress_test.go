@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetEgressOnly(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        bool
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "enabled", annotations: map[string]string{annotationEgressOnly: "true"}, want: true},
+		{name: "disabled", annotations: map[string]string{annotationEgressOnly: "false", annotationForward: "8080"}},
+		{name: "invalid", annotations: map[string]string{annotationEgressOnly: "maybe"}, wantErr: true},
+		{name: "with forward", annotations: map[string]string{annotationEgressOnly: "true", annotationForward: "8080"}, wantErr: true},
+		{name: "with serve cert", annotations: map[string]string{annotationEgressOnly: "true", annotationServeCertSecret: "web-tls"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getEgressOnly(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getEgressOnly() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getEgressOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetEgressTarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		userspace   bool
+		want        *egressTarget
+		wantField   string
+	}{
+		{name: "unset"},
+		{name: "ipv4", annotations: map[string]string{annotationEgressTarget: " 100.64.0.1 "}, want: &egressTarget{IP: "100.64.0.1"}},
+		{name: "ipv6", annotations: map[string]string{annotationEgressTarget: "fd7a:115c:a1e0::1"}, want: &egressTarget{IP: "fd7a:115c:a1e0::1"}},
+		{name: "fqdn", annotations: map[string]string{annotationEgressTarget: "db.example.ts.net."}, want: &egressTarget{FQDN: "db.example.ts.net"}},
+		{
+			name:        "listen port",
+			annotations: map[string]string{annotationEgressTarget: "db.example.ts.net", annotationEgressListen: "5432"},
+			want:        &egressTarget{FQDN: "db.example.ts.net", Port: 5432},
+		},
+		{name: "unqualified name", annotations: map[string]string{annotationEgressTarget: "db"}, wantField: annotationEgressTarget},
+		{name: "invalid name", annotations: map[string]string{annotationEgressTarget: "db_1.example.ts.net"}, wantField: annotationEgressTarget},
+		{name: "userspace", annotations: map[string]string{annotationEgressTarget: "100.64.0.1"}, userspace: true, wantField: annotationEgressTarget},
+		{name: "invalid listen port", annotations: map[string]string{annotationEgressTarget: "100.64.0.1", annotationEgressListen: "70000"}, wantField: annotationEgressListen},
+		{name: "listen without target", annotations: map[string]string{annotationEgressListen: "5432"}, wantField: annotationEgressListen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getEgressTarget(pod, tt.userspace)
+			if (err != nil) != (tt.wantField != "") {
+				t.Fatalf("getEgressTarget() error = %v, want error on %q", err, tt.wantField)
+			}
+			if causes := statusCauses(err); tt.wantField != "" && (len(causes) != 1 || causes[0].Field != "metadata.annotations["+tt.wantField+"]") {
+				t.Errorf("statusCauses() = %+v, want %s", causes, tt.wantField)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getEgressTarget() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEgressTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    egressTarget
+		wantEnv   corev1.EnvVar
+		wantPorts []corev1.ContainerPort
+	}{
+		{name: "ip", target: egressTarget{IP: "100.64.0.1"}, wantEnv: corev1.EnvVar{Name: "TS_TAILNET_TARGET_IP", Value: "100.64.0.1"}},
+		{name: "fqdn", target: egressTarget{FQDN: "db.example.ts.net"}, wantEnv: corev1.EnvVar{Name: "TS_TAILNET_TARGET_FQDN", Value: "db.example.ts.net"}},
+		{
+			name:      "listen port",
+			target:    egressTarget{IP: "100.64.0.1", Port: 5432},
+			wantEnv:   corev1.EnvVar{Name: "TS_TAILNET_TARGET_IP", Value: "100.64.0.1"},
+			wantPorts: []corev1.ContainerPort{{Name: egressPortName, ContainerPort: 5432, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := &corev1.Container{}
+			applyEgressTarget(container, &tt.target)
+			if !reflect.DeepEqual(container.Env, []corev1.EnvVar{tt.wantEnv}) {
+				t.Errorf("applyEgressTarget() env = %+v, want %+v", container.Env, tt.wantEnv)
+			}
+			if !reflect.DeepEqual(container.Ports, tt.wantPorts) {
+				t.Errorf("applyEgressTarget() ports = %+v, want %+v", container.Ports, tt.wantPorts)
+			}
+		})
+	}
+}
+
+func TestEgressTargetNetworkingMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		userspace string
+		wantErr   bool
+	}{
+		{name: "kernel", userspace: "false"},
+		{name: "userspace", userspace: "true", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := testInjectedPod()
+			pod.Annotations[annotationUserspace] = tt.userspace
+			pod.Annotations[annotationEgressTarget] = "100.64.0.1"
+			pod.Annotations[annotationEgressListen] = "5432"
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generateSidecarPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			sidecar, _ := sidecarFromPatch(patches)
+			if ip, _ := containerEnv(sidecar, "TS_TAILNET_TARGET_IP"); ip != "100.64.0.1" {
+				t.Errorf("TS_TAILNET_TARGET_IP = %q, want 100.64.0.1", ip)
+			}
+			found := false
+			for _, port := range sidecar.Ports {
+				found = found || port.Name == egressPortName && port.ContainerPort == 5432
+			}
+			if !found {
+				t.Errorf("sidecar ports = %+v, want %s 5432", sidecar.Ports, egressPortName)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	_ "time/tzdata" // validate TS_SIDECAR_TZ without tzdata in the image
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// managedEnvOrder is the fixed order of the env vars set by the webhook. The
+// pod metadata vars come first since later values reference them with
+// $(POD_NAME) style expansion, which only sees previously defined vars.
+var managedEnvOrder = []string{
+	"POD_NAME",
+	"POD_NAMESPACE",
+	"POD_UID",
+	"TS_AUTHKEY",
+	"TS_AUTH_ONCE",
+	"TS_HOSTNAME",
+	"TS_KUBE_SECRET",
+	"TS_EXTRA_ARGS",
+	"TS_USERSPACE",
+	"TS_ACCEPT_DNS",
+	"TS_DEBUG_FIREWALL_MODE",
+	"TS_HEALTHCHECK_ADDR_PORT",
+	"TS_EXPERIMENTAL_VERSIONED_CONFIG_DIR",
+	"TS_SERVE_CONFIG",
+	"TS_TAILNET_TARGET_IP",
+	"TS_TAILNET_TARGET_FQDN",
+	"TS_ENABLE_METRICS",
+	"TS_LOCAL_ADDR_PORT",
+	"TS_SOCKS5_SERVER",
+}
+
+var managedEnvRank = func() map[string]int {
+	rank := map[string]int{}
+	for i, name := range managedEnvOrder {
+		rank[name] = i
+	}
+	return rank
+}()
+
+// sortEnv orders env vars deterministically so that the same pod and config
+// always produce the same patch: managed vars in managedEnvOrder, followed by
+// any other vars sorted by name.
+func sortEnv(env []corev1.EnvVar) {
+	sort.SliceStable(env, func(i, j int) bool {
+		ri, iManaged := managedEnvRank[env[i].Name]
+		rj, jManaged := managedEnvRank[env[j].Name]
+		switch {
+		case iManaged && jManaged:
+			return ri < rj
+		case iManaged != jManaged:
+			return iManaged
+		default:
+			return env[i].Name < env[j].Name
+		}
+	})
+}
+
+// setEnvVar sets the value of an existing env var on the container, or
+// appends it when not present.
+func setEnvVar(container *corev1.Container, name, value string) {
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env[i].Value = value
+			container.Env[i].ValueFrom = nil
+			return
+		}
+	}
+	container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: value})
+}
+
+// removeEnvVar removes an env var from the container if present.
+func removeEnvVar(container *corev1.Container, name string) {
+	for i := range container.Env {
+		if container.Env[i].Name == name {
+			container.Env = append(container.Env[:i], container.Env[i+1:]...)
+			return
+		}
+	}
+}
+
+// getSidecarEnv returns the extra env vars set on every sidecar: TZ from
+// TS_SIDECAR_TZ (default UTC), so sidecar logs line up with app logs, and
+// the comma separated KEY=value pairs of TS_SIDECAR_ENV, e.g. LANG=C.UTF-8.
+// Env vars managed by the webhook cannot be overridden this way.
+func getSidecarEnv() ([]corev1.EnvVar, error) {
+	tz := getEnv("TS_SIDECAR_TZ", "UTC")
+	if _, err := time.LoadLocation(tz); err != nil || tz == "" || tz == "Local" {
+		return nil, fmt.Errorf("invalid TS_SIDECAR_TZ %q: must be an IANA time zone, e.g. UTC or Europe/Berlin", tz)
+	}
+	env := []corev1.EnvVar{{Name: "TZ", Value: tz}}
+
+	for _, pair := range strings.Split(getEnv("TS_SIDECAR_ENV", ""), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || len(validation.IsEnvVarName(name)) > 0 {
+			return nil, fmt.Errorf("invalid TS_SIDECAR_ENV entry %q: must be KEY=value", pair)
+		}
+		if _, managed := managedEnvRank[name]; managed || name == "TZ" {
+			return nil, fmt.Errorf("invalid TS_SIDECAR_ENV entry %q: %s is set by the webhook", pair, name)
+		}
+		env = append(env, corev1.EnvVar{Name: name, Value: value})
+	}
+	return env, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSortEnv(t *testing.T) {
+	names := func(env []corev1.EnvVar) []string {
+		var names []string
+		for _, e := range env {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+	tests := []struct {
+		name string
+		in   []string
+		want []string
+	}{
+		{name: "managed order", in: []string{"TS_HOSTNAME", "TS_AUTHKEY", "POD_NAME"}, want: []string{"POD_NAME", "TS_AUTHKEY", "TS_HOSTNAME"}},
+		{name: "unmanaged last by name", in: []string{"TZ", "LANG", "TS_USERSPACE"}, want: []string{"TS_USERSPACE", "LANG", "TZ"}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var env []corev1.EnvVar
+			for _, name := range tt.in {
+				env = append(env, corev1.EnvVar{Name: name})
+			}
+			sortEnv(env)
+			if got := names(env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sortEnv(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSidecarEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		tz      string
+		extra   string
+		want    []corev1.EnvVar
+		wantErr bool
+	}{
+		{name: "default", want: []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}},
+		{name: "zone", tz: "Europe/Berlin", want: []corev1.EnvVar{{Name: "TZ", Value: "Europe/Berlin"}}},
+		{name: "invalid zone", tz: "Mars/Olympus", wantErr: true},
+		{name: "local", tz: "Local", wantErr: true},
+		{
+			name:  "extra env",
+			extra: "LANG=C.UTF-8, GODEBUG=x=1,",
+			want:  []corev1.EnvVar{{Name: "TZ", Value: "UTC"}, {Name: "LANG", Value: "C.UTF-8"}, {Name: "GODEBUG", Value: "x=1"}},
+		},
+		{name: "missing value", extra: "LANG", wantErr: true},
+		{name: "invalid name", extra: "1LANG=C", wantErr: true},
+		{name: "managed", extra: "TS_AUTHKEY=tskey", wantErr: true},
+		{name: "tz", extra: "TZ=UTC", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_SIDECAR_TZ", tt.tz)
+			t.Setenv("TS_SIDECAR_ENV", tt.extra)
+			got, err := getSidecarEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getSidecarEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getSidecarEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
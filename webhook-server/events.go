@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// reasonInjectionSkipped is the event reason used when a pod is admitted
+// without its sidecar because injection failed.
+const reasonInjectionSkipped = "SidecarInjectionSkipped"
+
+// eventRecorder emits events on pods. It is nil unless TS_EMIT_EVENTS is set
+// and the webhook runs in a cluster.
+var eventRecorder record.EventRecorder
+
+// eventDelay is how long to wait before looking up a skipped pod. The pod is
+// only persisted once admission completes, so the event has to be emitted
+// after the response has been sent.
+var eventDelay = 2 * time.Second
+
+func initEventRecorder() {
+	if getEnv("TS_EMIT_EVENTS", "false") != "true" {
+		return
+	}
+	if kubeClient == nil {
+		log.Printf("TS_EMIT_EVENTS is set but the Kubernetes API is unavailable, events disabled")
+		return
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	eventRecorder = broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "tailscale-webhook"})
+}
+
+// skipOnError reports whether a pod whose sidecar could not be generated
+// should be admitted without it instead of being denied.
+func skipOnError() bool {
+	return getEnv("INJECTION_ERROR_POLICY", "deny") == "skip"
+}
+
+// isDryRun reports whether the admission request is a dry run, whose
+// response must not be accompanied by side effects.
+func isDryRun(admissionReview *admissionv1.AdmissionReview) bool {
+	return admissionReview.Request.DryRun != nil && *admissionReview.Request.DryRun
+}
+
+// emitSkipEvent records a warning event on pod once it exists. The pod has
+// no UID during admission, so it is looked up by name after eventDelay.
+// Pods created from generateName have no name yet and cannot be looked up,
+// so the event goes to their controller, e.g. the ReplicaSet, instead; such
+// pods without a controller get no event. Dry-run pods are never created.
+func emitSkipEvent(admissionReview *admissionv1.AdmissionReview, pod *corev1.Pod, message string) {
+	if eventRecorder == nil {
+		return
+	}
+	if isDryRun(admissionReview) {
+		debugf("Not emitting %s event for dry-run pod %s/%s", reasonInjectionSkipped, pod.Namespace, pod.Name)
+		return
+	}
+	if pod.Name == "" {
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil {
+			log.Printf("Not emitting %s event for pod in namespace %s: pod name is generated and the pod has no controller", reasonInjectionSkipped, pod.Namespace)
+			return
+		}
+		// The controller already exists, so its event needs no delay
+		eventRecorder.Event(ownerReference(pod.Namespace, owner), corev1.EventTypeWarning, reasonInjectionSkipped, message+" (pod "+pod.GenerateName+"*)")
+		return
+	}
+	namespace, name := pod.Namespace, pod.Name
+	go func() {
+		time.Sleep(eventDelay)
+		emitPodEvent(context.Background(), eventRecorder, kubeClient, namespace, name, message)
+	}()
+}
+
+// emitPodEvent looks up the named pod and records a skip event on it. Lookup
+// failures are logged, since the pod may have been rejected by a later
+// admission step.
+func emitPodEvent(ctx context.Context, recorder record.EventRecorder, client kubernetes.Interface, namespace, name, message string) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	pod, err := client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Printf("Not emitting %s event for pod %s/%s: %v", reasonInjectionSkipped, namespace, name, err)
+		return
+	}
+	recorder.Event(pod, corev1.EventTypeWarning, reasonInjectionSkipped, message)
+}
+
+// ownerReference returns the object reference of the owner of a pod in
+// namespace, for recording events on it.
+func ownerReference(namespace string, owner *metav1.OwnerReference) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		APIVersion: owner.APIVersion,
+		Kind:       owner.Kind,
+		Namespace:  namespace,
+		Name:       owner.Name,
+		UID:        owner.UID,
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEmitPodEvent(t *testing.T) {
+	existing := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"}}
+	tests := []struct {
+		name      string
+		pod       string
+		wantEvent bool
+	}{
+		{name: "pod exists", pod: "web", wantEvent: true},
+		{name: "pod rejected later", pod: "gone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			client := fake.NewSimpleClientset(existing)
+			emitPodEvent(context.Background(), recorder, client, "prod", tt.pod, "auth key not found")
+			select {
+			case event := <-recorder.Events:
+				if !tt.wantEvent {
+					t.Fatalf("emitPodEvent() recorded %q, want no event", event)
+				}
+				want := corev1.EventTypeWarning + " " + reasonInjectionSkipped + " auth key not found"
+				if !strings.HasPrefix(event, want) {
+					t.Errorf("emitPodEvent() recorded %q, want %q", event, want)
+				}
+			default:
+				if tt.wantEvent {
+					t.Fatal("emitPodEvent() recorded no event")
+				}
+			}
+		})
+	}
+}
+
+func TestSkipOnError(t *testing.T) {
+	for value, want := range map[string]bool{"": false, "deny": false, "skip": true} {
+		t.Setenv("INJECTION_ERROR_POLICY", value)
+		if got := skipOnError(); got != want {
+			t.Errorf("skipOnError() with %q = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestEmitSkipEventDryRun(t *testing.T) {
+	oldRecorder, oldClient, oldDelay := eventRecorder, kubeClient, eventDelay
+	defer func() { eventRecorder, kubeClient, eventDelay = oldRecorder, oldClient, oldDelay }()
+	eventDelay = 0
+	kubeClient = fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"}})
+
+	dryRun, notDryRun := true, false
+	tests := []struct {
+		name      string
+		dryRun    *bool
+		podName   string
+		wantEvent bool
+	}{
+		{name: "dry run", dryRun: &dryRun, podName: "web"},
+		{name: "not dry run", dryRun: &notDryRun, podName: "web", wantEvent: true},
+		{name: "unset", podName: "web", wantEvent: true},
+		{name: "generated name without controller", podName: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			eventRecorder = recorder
+			review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{DryRun: tt.dryRun}}
+			if got, want := isDryRun(review), tt.dryRun != nil && *tt.dryRun; got != want {
+				t.Errorf("isDryRun() = %v, want %v", got, want)
+			}
+			emitSkipEvent(review, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.podName, Namespace: "prod"}}, "skipped")
+			select {
+			case event := <-recorder.Events:
+				if !tt.wantEvent {
+					t.Errorf("emitSkipEvent() recorded %q, want no event", event)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.wantEvent {
+					t.Error("emitSkipEvent() recorded no event")
+				}
+			}
+		})
+	}
+}
+
+func TestEmitSkipEventGeneratedName(t *testing.T) {
+	oldRecorder := eventRecorder
+	defer func() { eventRecorder = oldRecorder }()
+
+	controller := true
+	tests := []struct {
+		name      string
+		owners    []metav1.OwnerReference
+		wantEvent bool
+	}{
+		{name: "no owner"},
+		{name: "not a controller", owners: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "config", UID: "c"}}},
+		{
+			name:      "controller",
+			owners:    []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-7d9f8", UID: "rs", Controller: &controller}},
+			wantEvent: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(1)
+			recorder.IncludeObject = true
+			eventRecorder = recorder
+			review := &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{}}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "web-7d9f8-", Namespace: "prod", OwnerReferences: tt.owners}}
+			emitSkipEvent(review, pod, "skipped")
+			select {
+			case event := <-recorder.Events:
+				if !tt.wantEvent {
+					t.Fatalf("emitSkipEvent() recorded %q, want no event", event)
+				}
+				for _, want := range []string{reasonInjectionSkipped, "skipped (pod web-7d9f8-*)", "kind=ReplicaSet,apiVersion=apps/v1"} {
+					if !strings.Contains(event, want) {
+						t.Errorf("emitSkipEvent() recorded %q, want %q", event, want)
+					}
+				}
+				ref := ownerReference(pod.Namespace, metav1.GetControllerOf(pod))
+				if ref.Namespace != "prod" || ref.Name != "web-7d9f8" || ref.UID != "rs" {
+					t.Errorf("ownerReference() = %+v, want the ReplicaSet in prod", ref)
+				}
+			default:
+				if tt.wantEvent {
+					t.Fatal("emitSkipEvent() recorded no event")
+				}
+			}
+		})
+	}
+}
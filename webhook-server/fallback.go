@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// annotationImageFallback requests TS_IMAGE_FALLBACK for a single pod, for
+// example set by the policy service while the primary registry is degraded.
+const annotationImageFallback = "tailscale.com/image-fallback"
+
+// registryDegraded is toggled by SIGHUP during registry incidents to make
+// every injection use TS_IMAGE_FALLBACK.
+var registryDegraded atomic.Bool
+
+// initFallbackSignal toggles registryDegraded on SIGHUP when TS_IMAGE_FALLBACK
+// is set, e.g. with kubectl exec deploy/tailscale-webhook -- kill -HUP 1.
+func initFallbackSignal() {
+	if getEnv("TS_IMAGE_FALLBACK", "") == "" {
+		return
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			toggleRegistryDegraded()
+		}
+	}()
+}
+
+// toggleRegistryDegraded flips registryDegraded and drops the patches cached
+// with the previous image.
+func toggleRegistryDegraded() {
+	degraded := !registryDegraded.Load()
+	registryDegraded.Store(degraded)
+	patchResults.invalidate()
+	if degraded {
+		log.Printf("Registry marked degraded, injecting the fallback image %s", getEnv("TS_IMAGE_FALLBACK", ""))
+	} else {
+		log.Printf("Registry marked healthy, injecting the primary image")
+	}
+}
+
+// getFallbackImage returns TS_IMAGE_FALLBACK when the registry is marked
+// degraded or the pod requests the fallback, or "" otherwise.
+func getFallbackImage(pod *corev1.Pod) string {
+	fallback := getEnv("TS_IMAGE_FALLBACK", "")
+	if fallback == "" {
+		return ""
+	}
+	if registryDegraded.Load() || pod.Annotations[annotationImageFallback] == "true" {
+		return fallback
+	}
+	return ""
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetFallbackImage(t *testing.T) {
+	defer registryDegraded.Store(false)
+	tests := []struct {
+		name       string
+		fallback   string
+		degraded   bool
+		annotation string
+		want       string
+	}{
+		{name: "no fallback configured", degraded: true, annotation: "true"},
+		{name: "healthy", fallback: "mirror.example.com/tailscale:stable"},
+		{name: "degraded", fallback: "mirror.example.com/tailscale:stable", degraded: true, want: "mirror.example.com/tailscale:stable"},
+		{name: "pod annotation", fallback: "mirror.example.com/tailscale:stable", annotation: "true", want: "mirror.example.com/tailscale:stable"},
+		{name: "pod annotation false", fallback: "mirror.example.com/tailscale:stable", annotation: "false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_IMAGE_FALLBACK", tt.fallback)
+			registryDegraded.Store(tt.degraded)
+			pod := &corev1.Pod{}
+			if tt.annotation != "" {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{annotationImageFallback: tt.annotation}}
+			}
+			if got := getFallbackImage(pod); got != tt.want {
+				t.Errorf("getFallbackImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	annotationForward = "tailscale.com/forward"
+
+	// annotationServeConfig carries the generated serve config. It is
+	// projected into the sidecar with the downward API, so no ConfigMap has
+	// to exist for it.
+	annotationServeConfig = "tailscale.com/serve-config"
+
+	serveConfigVolumeName = "ts-serve-config"
+	serveConfigDir        = "/etc/tailscale/serve"
+	serveConfigFile       = "serve.json"
+)
+
+// forwardRule forwards a tailnet port to a local port of the pod.
+type forwardRule struct {
+	Protocol    string
+	TailnetPort int
+	LocalPort   int
+}
+
+// serveConfigSpec is the subset of tailscale's serve config needed for TCP
+// forwarding, e.g. {"TCP":{"8080":{"TCPForward":"127.0.0.1:80"}}}.
+type serveConfigSpec struct {
+	TCP map[string]serveTCPHandler `json:"TCP"`
+}
+
+type serveTCPHandler struct {
+	TCPForward string `json:"TCPForward"`
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q: must be between 1 and 65535", value)
+	}
+	return port, nil
+}
+
+// parseForwardRules parses a comma separated list of forward specs of the
+// form <protocol>/<tailnet-port>-><local-port>, e.g. "tcp/8080->80". Only
+// TCP is supported since tailscale serve cannot forward UDP.
+func parseForwardRules(value string) ([]forwardRule, error) {
+	var rules []forwardRule
+	seen := map[int]bool{}
+	for _, spec := range strings.Split(value, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		protocol, ports, ok := strings.Cut(spec, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid forward %q: expected <protocol>/<tailnet-port>-><local-port>", spec)
+		}
+		protocol = strings.ToLower(protocol)
+		if protocol != "tcp" {
+			return nil, fmt.Errorf("invalid forward %q: unsupported protocol %q, only tcp is supported", spec, protocol)
+		}
+		from, to, ok := strings.Cut(ports, "->")
+		if !ok {
+			return nil, fmt.Errorf("invalid forward %q: expected <protocol>/<tailnet-port>-><local-port>", spec)
+		}
+		tailnetPort, err := parsePort(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward %q: %v", spec, err)
+		}
+		localPort, err := parsePort(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid forward %q: %v", spec, err)
+		}
+		if seen[tailnetPort] {
+			return nil, fmt.Errorf("invalid forward %q: tailnet port %d is forwarded twice", spec, tailnetPort)
+		}
+		seen[tailnetPort] = true
+		rules = append(rules, forwardRule{Protocol: protocol, TailnetPort: tailnetPort, LocalPort: localPort})
+	}
+	return rules, nil
+}
+
+// getServeConfig returns the serve config JSON for the pod's
+// tailscale.com/forward annotation, or an empty string when it is not set.
+func getServeConfig(pod *corev1.Pod) (string, error) {
+	value, ok := pod.Annotations[annotationForward]
+	if !ok {
+		return "", nil
+	}
+	rules, err := parseForwardRules(value)
+	if err != nil {
+		return "", field.Invalid(annotationPath(annotationForward), value, err.Error())
+	}
+	if len(rules) == 0 {
+		return "", nil
+	}
+
+	config := serveConfigSpec{TCP: map[string]serveTCPHandler{}}
+	for _, rule := range rules {
+		config.TCP[strconv.Itoa(rule.TailnetPort)] = serveTCPHandler{
+			TCPForward: fmt.Sprintf("127.0.0.1:%d", rule.LocalPort),
+		}
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// serveConfigVolume projects the serve config annotation into a file.
+func serveConfigVolume() corev1.Volume {
+	return corev1.Volume{
+		Name: serveConfigVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			DownwardAPI: &corev1.DownwardAPIVolumeSource{
+				Items: []corev1.DownwardAPIVolumeFile{
+					{
+						Path: serveConfigFile,
+						FieldRef: &corev1.ObjectFieldSelector{
+							FieldPath: fmt.Sprintf("metadata.annotations['%s']", annotationServeConfig),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// applyServeConfig mounts the serve config into the sidecar and points
+// TS_SERVE_CONFIG at it.
+func applyServeConfig(sidecar *corev1.Container) {
+	setEnvVar(sidecar, "TS_SERVE_CONFIG", serveConfigDir+"/"+serveConfigFile)
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      serveConfigVolumeName,
+		MountPath: serveConfigDir,
+		ReadOnly:  true,
+	})
+}
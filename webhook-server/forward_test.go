@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseForwardRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []forwardRule
+		wantErr bool
+	}{
+		{name: "empty", value: " , "},
+		{name: "single", value: "tcp/8080->80", want: []forwardRule{{Protocol: "tcp", TailnetPort: 8080, LocalPort: 80}}},
+		{
+			name:  "multiple",
+			value: "TCP/443->8443, tcp/80->8080",
+			want:  []forwardRule{{Protocol: "tcp", TailnetPort: 443, LocalPort: 8443}, {Protocol: "tcp", TailnetPort: 80, LocalPort: 8080}},
+		},
+		{name: "no protocol", value: "8080->80", wantErr: true},
+		{name: "udp", value: "udp/53->53", wantErr: true},
+		{name: "no arrow", value: "tcp/8080", wantErr: true},
+		{name: "port out of range", value: "tcp/70000->80", wantErr: true},
+		{name: "local port zero", value: "tcp/80->0", wantErr: true},
+		{name: "duplicate tailnet port", value: "tcp/80->8080,tcp/80->9090", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseForwardRules(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseForwardRules(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseForwardRules(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetServeConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "empty", annotations: map[string]string{annotationForward: ""}},
+		{
+			name:        "forward",
+			annotations: map[string]string{annotationForward: "tcp/443->8443,tcp/80->8080"},
+			want:        `{"TCP":{"443":{"TCPForward":"127.0.0.1:8443"},"80":{"TCPForward":"127.0.0.1:8080"}}}`,
+		},
+		{name: "invalid", annotations: map[string]string{annotationForward: "tcp/80"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getServeConfig(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getServeConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getServeConfig() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyServeConfig(t *testing.T) {
+	sidecar := &corev1.Container{Name: "ts-sidecar"}
+	applyServeConfig(sidecar)
+	if len(sidecar.Env) != 1 || sidecar.Env[0].Name != "TS_SERVE_CONFIG" || sidecar.Env[0].Value != "/etc/tailscale/serve/serve.json" {
+		t.Errorf("applyServeConfig() env = %v, want TS_SERVE_CONFIG=/etc/tailscale/serve/serve.json", sidecar.Env)
+	}
+	volume := serveConfigVolume()
+	if len(sidecar.VolumeMounts) != 1 || sidecar.VolumeMounts[0].Name != volume.Name || !sidecar.VolumeMounts[0].ReadOnly {
+		t.Errorf("applyServeConfig() mounts = %v, want a read-only mount of %s", sidecar.VolumeMounts, volume.Name)
+	}
+	if got := volume.DownwardAPI.Items[0].FieldRef.FieldPath; got != "metadata.annotations['tailscale.com/serve-config']" {
+		t.Errorf("serveConfigVolume() projects %s", got)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// annotationHealthCheckConfigMap names a ConfigMap in the pod's namespace
+	// holding a health check script, run by the sidecar's liveness probe
+	// instead of the HTTP check on /healthz.
+	annotationHealthCheckConfigMap = "tailscale.com/healthcheck-configmap"
+	// annotationHealthCheckScriptKey is the key of the script in the
+	// ConfigMap (default: healthcheck.sh).
+	annotationHealthCheckScriptKey = "tailscale.com/healthcheck-script-key"
+
+	defaultHealthCheckScriptKey = "healthcheck.sh"
+	healthCheckVolumeName       = "ts-healthcheck"
+	healthCheckScriptDir        = "/etc/tailscale/healthcheck"
+)
+
+// healthCheckScript is a health check script mounted from a ConfigMap.
+type healthCheckScript struct {
+	configMap string
+	key       string
+}
+
+// getHealthCheckScript returns the script requested by the
+// tailscale.com/healthcheck-configmap annotation, or nil when unset.
+func getHealthCheckScript(pod *corev1.Pod) (*healthCheckScript, error) {
+	value, ok := pod.Annotations[annotationHealthCheckConfigMap]
+	if !ok {
+		if _, ok := pod.Annotations[annotationHealthCheckScriptKey]; ok {
+			return nil, field.Invalid(annotationPath(annotationHealthCheckScriptKey), pod.Annotations[annotationHealthCheckScriptKey], "requires "+annotationHealthCheckConfigMap)
+		}
+		return nil, nil
+	}
+	name := strings.TrimSpace(value)
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, field.Invalid(annotationPath(annotationHealthCheckConfigMap), value, strings.Join(errs, "; "))
+	}
+	key := defaultHealthCheckScriptKey
+	if value, ok := pod.Annotations[annotationHealthCheckScriptKey]; ok {
+		key = strings.TrimSpace(value)
+		if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+			return nil, field.Invalid(annotationPath(annotationHealthCheckScriptKey), value, strings.Join(errs, "; "))
+		}
+	}
+	return &healthCheckScript{configMap: name, key: key}, nil
+}
+
+// healthCheckScriptVolume projects only the script key of the ConfigMap,
+// executable by the sidecar.
+func healthCheckScriptVolume(script *healthCheckScript) corev1.Volume {
+	mode := int32(0o555)
+	return corev1.Volume{
+		Name: healthCheckVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: script.configMap},
+				Items:                []corev1.KeyToPath{{Key: script.key, Path: script.key}},
+				DefaultMode:          &mode,
+			},
+		},
+	}
+}
+
+// applyHealthCheckScript mounts the script into the sidecar and runs it as
+// the liveness probe, replacing any HTTP liveness probe. Like the HTTP
+// probe, it is left out when the sidecar would not be restarted.
+func applyHealthCheckScript(pod *corev1.Pod, container *corev1.Container, script *healthCheckScript) {
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      healthCheckVolumeName,
+		MountPath: healthCheckScriptDir,
+		ReadOnly:  true,
+	})
+	if !livenessRestartable(pod) {
+		log.Printf("Pod %s/%s has restartPolicy Never, not adding the health check script as liveness probe", pod.Namespace, pod.Name)
+		container.LivenessProbe = nil
+		return
+	}
+	container.LivenessProbe = &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/bin/sh", healthCheckScriptDir + "/" + script.key},
+			},
+		},
+		InitialDelaySeconds: 10,
+		PeriodSeconds:       10,
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetHealthCheckScript(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        *healthCheckScript
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "default key", annotations: map[string]string{annotationHealthCheckConfigMap: "checks"}, want: &healthCheckScript{configMap: "checks", key: "healthcheck.sh"}},
+		{
+			name:        "custom key",
+			annotations: map[string]string{annotationHealthCheckConfigMap: "checks", annotationHealthCheckScriptKey: "tailnet.sh"},
+			want:        &healthCheckScript{configMap: "checks", key: "tailnet.sh"},
+		},
+		{name: "key without configmap", annotations: map[string]string{annotationHealthCheckScriptKey: "tailnet.sh"}, wantErr: true},
+		{name: "invalid configmap", annotations: map[string]string{annotationHealthCheckConfigMap: "Checks!"}, wantErr: true},
+		{name: "invalid key", annotations: map[string]string{annotationHealthCheckConfigMap: "checks", annotationHealthCheckScriptKey: "../etc/passwd"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getHealthCheckScript(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getHealthCheckScript() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("getHealthCheckScript() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHealthCheckScript(t *testing.T) {
+	script := &healthCheckScript{configMap: "checks", key: "tailnet.sh"}
+	tests := []struct {
+		name          string
+		restartPolicy corev1.RestartPolicy
+		wantProbe     bool
+	}{
+		{name: "always", restartPolicy: corev1.RestartPolicyAlways, wantProbe: true},
+		{name: "never", restartPolicy: corev1.RestartPolicyNever},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{RestartPolicy: tt.restartPolicy}}
+			container := &corev1.Container{
+				LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"}}},
+			}
+			applyHealthCheckScript(pod, container, script)
+
+			if len(container.VolumeMounts) != 1 || container.VolumeMounts[0].Name != healthCheckVolumeName || container.VolumeMounts[0].MountPath != healthCheckScriptDir {
+				t.Errorf("applyHealthCheckScript() mounts = %v", container.VolumeMounts)
+			}
+			if !tt.wantProbe {
+				if container.LivenessProbe != nil {
+					t.Errorf("applyHealthCheckScript() liveness probe = %v, want none", container.LivenessProbe)
+				}
+				return
+			}
+			if container.LivenessProbe == nil || container.LivenessProbe.Exec == nil || container.LivenessProbe.HTTPGet != nil {
+				t.Fatalf("applyHealthCheckScript() liveness probe = %v, want only an exec probe", container.LivenessProbe)
+			}
+			if got := container.LivenessProbe.Exec.Command; len(got) != 2 || got[1] != "/etc/tailscale/healthcheck/tailnet.sh" {
+				t.Errorf("applyHealthCheckScript() command = %q", got)
+			}
+		})
+	}
+
+	volume := healthCheckScriptVolume(script)
+	if items := volume.ConfigMap.Items; volume.ConfigMap.Name != "checks" || len(items) != 1 || items[0].Key != "tailnet.sh" {
+		t.Errorf("healthCheckScriptVolume() = %+v, want only key tailnet.sh of checks", volume.ConfigMap)
+	}
+	if mode := *volume.ConfigMap.DefaultMode; mode != 0o555 {
+		t.Errorf("healthCheckScriptVolume() mode = %o, want 555", mode)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// maxHostnameLen is the longest hostname that fits in a DNS label.
+	maxHostnameLen = 63
+	// maxHostnameSuffixLen leaves room for a meaningful prefix and the hash
+	// when a cluster suffix is appended.
+	maxHostnameSuffixLen = 32
+	// hostnameHashLen is the number of hex characters used to disambiguate
+	// truncated hostnames.
+	hostnameHashLen = 8
+
+	// hostnameFromPod as tailscale.com/hostname derives the hostname from
+	// the pod's spec.hostname and spec.subdomain.
+	hostnameFromPod = "from-pod"
+)
+
+// Naming schemes for the default hostname and state secret (TS_NAME_SCHEME).
+const (
+	nameSchemeDefault = "default"
+	nameSchemeShared  = "shared"
+)
+
+// getNameScheme returns TS_NAME_SCHEME. The shared scheme replaces the
+// default hostname and state secret name, so it cannot be combined with
+// TS_HOSTNAME_TEMPLATE or TS_KUBE_SECRET.
+func getNameScheme() (string, error) {
+	scheme := getEnv("TS_NAME_SCHEME", nameSchemeDefault)
+	switch scheme {
+	case nameSchemeDefault:
+		return scheme, nil
+	case nameSchemeShared:
+		for _, env := range []string{"TS_HOSTNAME_TEMPLATE", "TS_KUBE_SECRET"} {
+			if getEnv(env, "") != "" {
+				return "", fmt.Errorf("TS_NAME_SCHEME=%s cannot be combined with %s", nameSchemeShared, env)
+			}
+		}
+		return scheme, nil
+	}
+	return "", fmt.Errorf("invalid TS_NAME_SCHEME %q: must be %s or %s", scheme, nameSchemeDefault, nameSchemeShared)
+}
+
+// sharedNameID returns the identifier both the hostname and the state secret
+// are derived from with TS_NAME_SCHEME=shared: the sanitized
+// <pod-name>-<namespace>, truncated so that the hostname with suffix fits in
+// a DNS label, followed by a hash of the namespace and pod name. The hash
+// keeps truncated names distinct and lets a node be matched to its secret
+// even when the readable part is cut short. It returns "" when the pod name
+// is not yet known (generateName).
+func sharedNameID(pod *corev1.Pod, suffix string) string {
+	if pod.Name == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(pod.Namespace + "/" + pod.Name))
+	hash := hex.EncodeToString(sum[:])[:hostnameHashLen]
+	budget := maxHostnameLen - len(hash) - 1
+	if suffix != "" {
+		budget -= len(suffix) + 1
+	}
+	base := sanitizeK8sName(pod.Name + "-" + pod.Namespace)
+	if len(base) > budget {
+		base = strings.TrimRight(base[:budget], "-")
+	}
+	if base == "" {
+		return hash
+	}
+	return base + "-" + hash
+}
+
+// sharedNameWarning returns an admission warning when TS_NAME_SCHEME=shared
+// cannot apply because the pod name is only known at runtime (generateName),
+// as for pods of Deployments and other controllers. The hash of the shared
+// identifier cannot be expanded by Kubernetes, so such pods keep the default
+// hostname and state secret.
+func sharedNameWarning(pod *corev1.Pod, scheme string) string {
+	if scheme != nameSchemeShared || pod.Name != "" {
+		return ""
+	}
+	log.Printf("Warning: pod %s/%s has a generated name, TS_NAME_SCHEME=%s falls back to the default hostname and state secret", pod.Namespace, pod.GenerateName, nameSchemeShared)
+	return fmt.Sprintf("TS_NAME_SCHEME=%s needs the pod name, pods created from generateName use the default Tailscale hostname $(POD_NAME)-$(POD_NAMESPACE) and the default state secret", nameSchemeShared)
+}
+
+// getHostnameSuffix returns the sanitized TS_HOSTNAME_SUFFIX, typically the
+// cluster name, so nodes from several clusters sharing a control server do
+// not collide.
+func getHostnameSuffix() string {
+	return sanitizeK8sName(getEnv("TS_HOSTNAME_SUFFIX", ""))
+}
+
+// hostnamePlaceholder matches the {{...}} placeholders of TS_HOSTNAME_TEMPLATE.
+var hostnamePlaceholder = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+
+// getHostnameTemplate returns TS_HOSTNAME_TEMPLATE, a base hostname built from
+// {{POD_NAME}}, {{NAMESPACE}}, {{OWNER_NAME}}, {{OWNER_UID}} and
+// {{LABEL:<key>}} placeholders, e.g. "{{LABEL:app}}-{{NAMESPACE}}". An empty
+// template keeps the default <pod-name>-<namespace> base.
+func getHostnameTemplate() (string, error) {
+	template := strings.TrimSpace(getEnv("TS_HOSTNAME_TEMPLATE", ""))
+	for _, m := range hostnamePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch key, isLabel := strings.CutPrefix(m[1], "LABEL:"); {
+		case m[1] == "POD_NAME", m[1] == "NAMESPACE", m[1] == "OWNER_NAME", m[1] == "OWNER_UID":
+		case isLabel:
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return "", fmt.Errorf("invalid TS_HOSTNAME_TEMPLATE: label %q: %s", key, strings.Join(errs, "; "))
+			}
+		default:
+			return "", fmt.Errorf("invalid TS_HOSTNAME_TEMPLATE: unknown placeholder %q", m[0])
+		}
+	}
+	return template, nil
+}
+
+// expandHostnameTemplate substitutes the placeholders of template for pod.
+// The owner placeholders fall back to the pod name for unowned pods. It
+// returns false when a referenced label is missing or the pod name is not
+// yet known, in which case the default hostname is used instead.
+func expandHostnameTemplate(template string, pod *corev1.Pod) (string, bool) {
+	ok := true
+	expanded := hostnamePlaceholder.ReplaceAllStringFunc(template, func(m string) string {
+		switch name := m[2 : len(m)-2]; name {
+		case "POD_NAME":
+			ok = ok && pod.Name != ""
+			return pod.Name
+		case "NAMESPACE":
+			return pod.Namespace
+		case "OWNER_NAME", "OWNER_UID":
+			owner := podOwner(pod)
+			if owner == nil {
+				ok = ok && pod.Name != ""
+				return pod.Name
+			}
+			if name == "OWNER_UID" {
+				return string(owner.UID)
+			}
+			return owner.Name
+		default:
+			value := strings.TrimSpace(pod.Labels[strings.TrimPrefix(name, "LABEL:")])
+			ok = ok && value != ""
+			return value
+		}
+	})
+	return expanded, ok && sanitizeK8sName(expanded) != ""
+}
+
+// podOwner returns the pod's controller, or else its first owner, or nil for
+// unowned pods.
+func podOwner(pod *corev1.Pod) *metav1.OwnerReference {
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		return owner
+	}
+	if len(pod.OwnerReferences) > 0 {
+		return &pod.OwnerReferences[0]
+	}
+	return nil
+}
+
+// getHostname returns the tailnet hostname for the pod. The
+// tailscale.com/hostname annotation sets an explicit DNS label, or with
+// from-pod the pod's <hostname>[-<subdomain>][-<suffix>]. Otherwise the
+// hostname is <pod-name>-<namespace>[-<suffix>], TS_HOSTNAME_TEMPLATE
+// expanded in place of <pod-name>-<namespace>, or with TS_NAME_SCHEME=shared
+// the sharedNameID; when the pod name is not yet known (generateName) it is
+// expanded by Kubernetes at runtime instead.
+func getHostname(pod *corev1.Pod) (string, error) {
+	suffix := getHostnameSuffix()
+	if hostname, ok := pod.Annotations[annotationHostname]; ok {
+		if hostname == hostnameFromPod {
+			if base := specHostname(pod); base != "" {
+				return deriveHostname(base, suffix), nil
+			}
+			debugf("Pod %s/%s sets no spec.hostname, using the default hostname", pod.Namespace, pod.Name)
+		} else {
+			if errs := validation.IsDNS1123Label(hostname); len(errs) > 0 {
+				return "", field.Invalid(annotationPath(annotationHostname), hostname, strings.Join(errs, "; "))
+			}
+			return hostname, nil
+		}
+	}
+
+	scheme, err := getNameScheme()
+	if err != nil {
+		return "", err
+	}
+	if id := sharedNameID(pod, suffix); scheme == nameSchemeShared && id != "" {
+		if suffix != "" {
+			return id + "-" + suffix, nil
+		}
+		return id, nil
+	}
+	template, err := getHostnameTemplate()
+	if err != nil {
+		return "", err
+	}
+	if template != "" {
+		if base, ok := expandHostnameTemplate(template, pod); ok {
+			return deriveHostname(base, suffix), nil
+		}
+		debugf("Hostname template %q cannot be expanded for pod %s/%s, using the default hostname", template, pod.Namespace, pod.Name)
+	}
+	if pod.Name == "" {
+		hostname := "$(POD_NAME)-$(POD_NAMESPACE)"
+		if suffix != "" {
+			hostname += "-" + suffix
+		}
+		return hostname, nil
+	}
+	return deriveHostname(pod.Name+"-"+pod.Namespace, suffix), nil
+}
+
+// specHostname returns the pod's spec.hostname, joined with spec.subdomain
+// when set, or "" when the pod sets no hostname.
+func specHostname(pod *corev1.Pod) string {
+	if pod.Spec.Hostname == "" {
+		return ""
+	}
+	if pod.Spec.Subdomain != "" {
+		return pod.Spec.Hostname + "-" + pod.Spec.Subdomain
+	}
+	return pod.Spec.Hostname
+}
+
+// deriveHostname builds a valid hostname from base and an optional suffix.
+// When the result would exceed maxHostnameLen, base is truncated to the
+// budget left by the suffix and a hash of the full name is inserted so that
+// names sharing a long prefix stay distinct, e.g. <base...>-<hash>-<suffix>.
+func deriveHostname(base, suffix string) string {
+	full := sanitizeK8sName(base)
+	if suffix != "" {
+		full += "-" + suffix
+	}
+	if len(full) <= maxHostnameLen {
+		return full
+	}
+
+	sum := sha256.Sum256([]byte(full))
+	tail := "-" + hex.EncodeToString(sum[:])[:hostnameHashLen]
+	if suffix != "" {
+		tail += "-" + suffix
+	}
+	prefix := strings.TrimRight(sanitizeK8sName(base)[:maxHostnameLen-len(tail)], "-")
+	return prefix + tail
+}
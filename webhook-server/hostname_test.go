@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeriveHostname(t *testing.T) {
+	long := strings.Repeat("a", 70)
+	tests := []struct {
+		name       string
+		base       string
+		suffix     string
+		want       string
+		wantPrefix string
+		wantSuffix string
+	}{
+		{name: "short", base: "web-prod", want: "web-prod"},
+		{name: "suffix", base: "web-prod", suffix: "eu1", want: "web-prod-eu1"},
+		{name: "sanitized", base: "Web_Prod", want: "web-prod"},
+		{name: "truncated", base: long, wantPrefix: strings.Repeat("a", 54) + "-"},
+		{name: "truncated with suffix", base: long, suffix: "eu1", wantPrefix: strings.Repeat("a", 50) + "-", wantSuffix: "-eu1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deriveHostname(tt.base, tt.suffix)
+			if len(got) > maxHostnameLen {
+				t.Errorf("deriveHostname() = %q, longer than %d", got, maxHostnameLen)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("deriveHostname() = %q, want %q", got, tt.want)
+			}
+			if !strings.HasPrefix(got, tt.wantPrefix) || !strings.HasSuffix(got, tt.wantSuffix) {
+				t.Errorf("deriveHostname() = %q, want %q...%q", got, tt.wantPrefix, tt.wantSuffix)
+			}
+		})
+	}
+
+	// Names sharing a long prefix stay distinct.
+	if a, b := deriveHostname(long+"-x", "eu1"), deriveHostname(long+"-y", "eu1"); a == b {
+		t.Errorf("deriveHostname() = %q for different names", a)
+	}
+}
+
+func TestGetHostname(t *testing.T) {
+	tests := []struct {
+		name        string
+		podName     string
+		annotations map[string]string
+		suffix      string
+		want        string
+		wantErr     bool
+	}{
+		{name: "default", podName: "web", want: "web-prod"},
+		{name: "suffix", podName: "web", suffix: "EU_1", want: "web-prod-eu-1"},
+		{name: "generated name", want: "$(POD_NAME)-$(POD_NAMESPACE)"},
+		{name: "generated name suffix", suffix: "eu1", want: "$(POD_NAME)-$(POD_NAMESPACE)-eu1"},
+		{name: "annotation", podName: "web", annotations: map[string]string{annotationHostname: "frontend"}, suffix: "eu1", want: "frontend"},
+		{name: "invalid annotation", podName: "web", annotations: map[string]string{annotationHostname: "Front_End"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_HOSTNAME_SUFFIX", tt.suffix)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.podName, Namespace: "prod", Annotations: tt.annotations}}
+			got, err := getHostname(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getHostname() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getHostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostnameTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		podName  string
+		labels   map[string]string
+		want     string
+		wantErr  bool
+	}{
+		{name: "label and namespace", template: "{{LABEL:app}}-{{NAMESPACE}}", podName: "web-7d9f", labels: map[string]string{"app": "web"}, want: "web-prod"},
+		{name: "pod name", template: "ts-{{POD_NAME}}", podName: "web-7d9f", want: "ts-web-7d9f"},
+		{name: "missing label", template: "{{LABEL:app}}-{{NAMESPACE}}", podName: "web-7d9f", want: "web-7d9f-prod"},
+		{name: "generated name", template: "{{POD_NAME}}", want: "$(POD_NAME)-$(POD_NAMESPACE)"},
+		{name: "unknown placeholder", template: "{{CLUSTER}}", podName: "web", wantErr: true},
+		{name: "invalid label", template: "{{LABEL:-app}}", podName: "web", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_HOSTNAME_TEMPLATE", tt.template)
+			if _, err := getHostnameTemplate(); (err != nil) != tt.wantErr {
+				t.Fatalf("getHostnameTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.podName, Namespace: "prod", Labels: tt.labels}}
+			got, err := getHostname(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getHostname() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getHostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostnameTemplateOwner(t *testing.T) {
+	controller := true
+	owners := []metav1.OwnerReference{
+		{Kind: "ConfigMap", Name: "config", UID: "uid-config"},
+		{Kind: "ReplicaSet", Name: "web-7d9f", UID: "uid-rs", Controller: &controller},
+	}
+	tests := []struct {
+		name     string
+		template string
+		podName  string
+		owners   []metav1.OwnerReference
+		want     string
+	}{
+		{name: "controller", template: "{{OWNER_NAME}}", podName: "web-7d9f-abcde", owners: owners, want: "web-7d9f-prod"},
+		{name: "controller uid", template: "{{OWNER_UID}}", podName: "web-7d9f-abcde", owners: owners, want: "uid-rs-prod"},
+		{name: "first owner", template: "{{OWNER_NAME}}", podName: "web", owners: owners[:1], want: "config-prod"},
+		{name: "unowned", template: "{{OWNER_NAME}}", podName: "web", want: "web-prod"},
+		{name: "owned generated name", template: "{{OWNER_NAME}}", owners: owners, want: "web-7d9f-prod"},
+		{name: "unowned generated name", template: "{{OWNER_NAME}}", want: "$(POD_NAME)-$(POD_NAMESPACE)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_HOSTNAME_TEMPLATE", tt.template+"-{{NAMESPACE}}")
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.podName, Namespace: "prod", OwnerReferences: tt.owners}}
+			got, err := getHostname(pod)
+			if err != nil {
+				t.Fatalf("getHostname() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getHostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetNameScheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		scheme   string
+		template string
+		secret   string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", want: nameSchemeDefault},
+		{name: "shared", scheme: "shared", want: nameSchemeShared},
+		{name: "shared with template", scheme: "shared", template: "{{POD_NAME}}", wantErr: true},
+		{name: "shared with secret", scheme: "shared", secret: "ts-state", wantErr: true},
+		{name: "default with template", scheme: "default", template: "{{POD_NAME}}", want: nameSchemeDefault},
+		{name: "invalid", scheme: "random", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NAME_SCHEME", tt.scheme)
+			t.Setenv("TS_HOSTNAME_TEMPLATE", tt.template)
+			t.Setenv("TS_KUBE_SECRET", tt.secret)
+			got, err := getNameScheme()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getNameScheme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getNameScheme() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharedNameScheme(t *testing.T) {
+	tests := []struct {
+		name       string
+		podName    string
+		suffix     string
+		wantPrefix string
+	}{
+		{name: "short", podName: "web", wantPrefix: "web-prod-"},
+		{name: "suffix", podName: "web", suffix: "eu1", wantPrefix: "web-prod-"},
+		{name: "long", podName: strings.Repeat("w", 70), suffix: "eu1", wantPrefix: strings.Repeat("w", 50)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NAME_SCHEME", "shared")
+			t.Setenv("TS_HOSTNAME_SUFFIX", tt.suffix)
+			pod := testInjectedPod()
+			pod.Name = tt.podName
+			id := sharedNameID(pod, tt.suffix)
+			if !strings.HasPrefix(id, tt.wantPrefix) {
+				t.Errorf("sharedNameID() = %q, want prefix %q", id, tt.wantPrefix)
+			}
+
+			hostname, err := getHostname(pod)
+			if err != nil {
+				t.Fatalf("getHostname() error = %v", err)
+			}
+			if len(hostname) > maxHostnameLen {
+				t.Errorf("getHostname() = %q, longer than %d", hostname, maxHostnameLen)
+			}
+			if want := strings.TrimSuffix(id+"-"+tt.suffix, "-"); hostname != want {
+				t.Errorf("getHostname() = %q, want %q", hostname, want)
+			}
+
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("generateSidecarPatch() error = %v", err)
+			}
+			sidecar, _ := sidecarFromPatch(patches)
+			secret := ""
+			for _, env := range sidecar.Env {
+				if env.Name == "TS_KUBE_SECRET" {
+					secret = env.Value
+				}
+			}
+			if secret != "tailscale-"+id {
+				t.Errorf("TS_KUBE_SECRET = %q, want %q", secret, "tailscale-"+id)
+			}
+		})
+	}
+
+	// The hash keeps pods in different namespaces apart even when the
+	// readable part is truncated to the same prefix.
+	a := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("w", 70), Namespace: "a"}}
+	b := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("w", 70), Namespace: "b"}}
+	if sharedNameID(a, "") == sharedNameID(b, "") {
+		t.Errorf("sharedNameID() = %q for pods in different namespaces", sharedNameID(a, ""))
+	}
+	if id := sharedNameID(&corev1.Pod{}, ""); id != "" {
+		t.Errorf("sharedNameID() without a pod name = %q, want empty", id)
+	}
+}
+
+func TestHostnameFromPod(t *testing.T) {
+	tests := []struct {
+		name      string
+		hostname  string
+		subdomain string
+		suffix    string
+		want      string
+	}{
+		{name: "hostname", hostname: "db-0", want: "db-0"},
+		{name: "subdomain", hostname: "db-0", subdomain: "db", want: "db-0-db"},
+		{name: "suffix", hostname: "db-0", subdomain: "db", suffix: "eu1", want: "db-0-db-eu1"},
+		{name: "no spec hostname", want: "web-prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_HOSTNAME_SUFFIX", tt.suffix)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Annotations: map[string]string{annotationHostname: hostnameFromPod}},
+				Spec:       corev1.PodSpec{Hostname: tt.hostname, Subdomain: tt.subdomain},
+			}
+			got, err := getHostname(pod)
+			if err != nil {
+				t.Fatalf("getHostname() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("getHostname() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSharedNameSchemeGeneratedName(t *testing.T) {
+	tests := []struct {
+		name        string
+		scheme      string
+		podName     string
+		wantWarning bool
+	}{
+		{name: "default scheme", scheme: nameSchemeDefault},
+		{name: "shared with name", scheme: nameSchemeShared, podName: "web-7d9f8"},
+		{name: "shared with generated name", scheme: nameSchemeShared, wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NAME_SCHEME", tt.scheme)
+			pod := testInjectedPod()
+			pod.Name, pod.GenerateName = tt.podName, "web-"
+			patches, warnings, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("generateSidecarPatch() error = %v", err)
+			}
+			found := false
+			for _, warning := range warnings {
+				found = found || strings.Contains(warning, "TS_NAME_SCHEME")
+			}
+			if found != tt.wantWarning {
+				t.Errorf("generateSidecarPatch() warnings = %q, want TS_NAME_SCHEME warning %v", warnings, tt.wantWarning)
+			}
+			if !tt.wantWarning {
+				return
+			}
+			// The fallback is the default scheme, expanded at runtime
+			sidecar, _ := sidecarFromPatch(patches)
+			hostname, _ := containerEnv(sidecar, "TS_HOSTNAME")
+			if hostname != "$(POD_NAME)-$(POD_NAMESPACE)" {
+				t.Errorf("TS_HOSTNAME = %q, want the default $(POD_NAME)-$(POD_NAMESPACE)", hostname)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// annotationImageSpec pins the sidecar image and its pull policy together,
+// as <image>@<policy>, so a pinned test image never keeps a pull policy
+// meant for the default image.
+const annotationImageSpec = "tailscale.com/image-spec"
+
+// getImageSpec parses the tailscale.com/image-spec annotation. It returns an
+// empty image when the annotation is not set. The policy follows the last
+// "@", so images referenced by digest work too, e.g.
+// "ghcr.io/tailscale/tailscale@sha256:...@IfNotPresent".
+func getImageSpec(pod *corev1.Pod) (string, corev1.PullPolicy, error) {
+	value, ok := pod.Annotations[annotationImageSpec]
+	if !ok {
+		return "", "", nil
+	}
+	path := annotationPath(annotationImageSpec)
+	spec := strings.TrimSpace(value)
+	i := strings.LastIndex(spec, "@")
+	if i < 0 {
+		return "", "", field.Invalid(path, value, "must be <image>@<pull policy>, e.g. ghcr.io/tailscale/tailscale:v1.76.1@IfNotPresent")
+	}
+	image, policy := spec[:i], corev1.PullPolicy(spec[i+1:])
+	switch policy {
+	case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+	default:
+		return "", "", field.NotSupported(path, string(policy), []string{string(corev1.PullAlways), string(corev1.PullIfNotPresent), string(corev1.PullNever)})
+	}
+	if image == "" || strings.ContainsAny(image, " \t\n") {
+		return "", "", field.Invalid(path, value, "the image must be a non-empty image reference without whitespace")
+	}
+	return image, policy, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetImageSpec(t *testing.T) {
+	digest := "ghcr.io/tailscale/tailscale@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name       string
+		value      string
+		unset      bool
+		wantImage  string
+		wantPolicy corev1.PullPolicy
+		wantErr    bool
+	}{
+		{name: "unset", unset: true},
+		{name: "tag", value: "ghcr.io/tailscale/tailscale:v1.76.1@IfNotPresent", wantImage: "ghcr.io/tailscale/tailscale:v1.76.1", wantPolicy: corev1.PullIfNotPresent},
+		{name: "digest", value: digest + "@Always", wantImage: digest, wantPolicy: corev1.PullAlways},
+		{name: "no policy", value: "tailscale/tailscale:stable", wantErr: true},
+		{name: "unknown policy", value: "tailscale/tailscale:stable@Sometimes", wantErr: true},
+		{name: "no image", value: "@Never", wantErr: true},
+		{name: "whitespace", value: "tailscale/tailscale stable@Never", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			if !tt.unset {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{annotationImageSpec: tt.value}}
+			}
+			image, policy, err := getImageSpec(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getImageSpec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if image != tt.wantImage || policy != tt.wantPolicy {
+				t.Errorf("getImageSpec() = %q, %q, want %q, %q", image, policy, tt.wantImage, tt.wantPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	injectLabel = "tailscale.com/inject"
+	// namespaceInjectDefault on a namespace injects its pods unless they are
+	// labeled tailscale.com/inject=false.
+	namespaceInjectDefault = "tailscale.com/inject-default"
+)
+
+// injectLabelValue returns the tailscale.com/inject label normalized for
+// comparison, so values such as "True" or " true " are honoured.
+func injectLabelValue(pod *corev1.Pod) string {
+	return strings.ToLower(strings.TrimSpace(pod.Labels[injectLabel]))
+}
+
+// optsOutOfInjection reports whether the pod is labeled
+// tailscale.com/inject=false (or 0).
+func optsOutOfInjection(pod *corev1.Pod) bool {
+	value := injectLabelValue(pod)
+	return value == "false" || value == "0"
+}
+
+// getImageMatcher returns a matcher for INJECT_IMAGE_MATCH, or nil when unset.
+// The value is a substring of the image reference, or a regular expression
+// when prefixed with "regex:".
+func getImageMatcher() (func(image string) bool, error) {
+	pattern := getEnv("INJECT_IMAGE_MATCH", "")
+	if pattern == "" {
+		return nil, nil
+	}
+	if expr, ok := strings.CutPrefix(pattern, "regex:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INJECT_IMAGE_MATCH regex: %v", err)
+		}
+		return re.MatchString, nil
+	}
+	return func(image string) bool {
+		return strings.Contains(image, pattern)
+	}, nil
+}
+
+// matchesInjectImage reports whether any container of the pod runs an image
+// matching INJECT_IMAGE_MATCH.
+func matchesInjectImage(pod *corev1.Pod) bool {
+	match, err := getImageMatcher()
+	if err != nil || match == nil {
+		return false
+	}
+	for _, container := range pod.Spec.Containers {
+		if match(container.Image) {
+			return true
+		}
+	}
+	return false
+}
+
+// injectSource is the signal that decided whether a pod is injected.
+type injectSource string
+
+const (
+	injectSourceNone      injectSource = "none"
+	injectSourceOptOut    injectSource = "opt-out"
+	injectSourceLabel     injectSource = "label"
+	injectSourceImage     injectSource = "image"
+	injectSourceNamespace injectSource = "namespace"
+)
+
+// shouldInject resolves the injection signals of a pod, in order of
+// precedence:
+//
+//  1. the pod opting out with tailscale.com/inject=false (or 0)
+//  2. the pod opting in with tailscale.com/inject=true
+//  3. a container image matching INJECT_IMAGE_MATCH
+//  4. the pod's namespace injecting by default, as reported by
+//     namespaceDefault, which is only called when no pod signal decides
+//
+// It returns the decision, the signal that made it, and a reason for logs.
+func shouldInject(pod *corev1.Pod, namespaceDefault func() bool) (bool, injectSource, string) {
+	switch {
+	case optsOutOfInjection(pod):
+		return false, injectSourceOptOut, fmt.Sprintf("pod is labeled %s=false", injectLabel)
+	case injectLabelValue(pod) == "true":
+		return true, injectSourceLabel, fmt.Sprintf("pod is labeled %s=true", injectLabel)
+	case matchesInjectImage(pod):
+		return true, injectSourceImage, "pod runs an image matching INJECT_IMAGE_MATCH"
+	case namespaceDefault():
+		return true, injectSourceNamespace, "namespace injects by default"
+	}
+	return false, injectSourceNone, fmt.Sprintf("pod does not have the %s=true label", injectLabel)
+}
+
+// requestsInjection reports whether the pod asks for a sidecar, see
+// shouldInject.
+func requestsInjection(ctx context.Context, pod *corev1.Pod) bool {
+	inject, _, _ := shouldInject(pod, func() bool {
+		return namespaceInjectsByDefault(ctx, pod.Namespace)
+	})
+	return inject
+}
+
+// getInjectOperations returns the admission operations handled by /mutate
+// from INJECT_OPERATIONS, CREATE by default.
+func getInjectOperations() (map[admissionv1.Operation]bool, error) {
+	operations := map[admissionv1.Operation]bool{}
+	for _, value := range strings.Split(getEnv("INJECT_OPERATIONS", string(admissionv1.Create)), ",") {
+		operation := admissionv1.Operation(strings.ToUpper(strings.TrimSpace(value)))
+		switch operation {
+		case "":
+			continue
+		case admissionv1.Create, admissionv1.Update:
+			operations[operation] = true
+		default:
+			return nil, fmt.Errorf("invalid INJECT_OPERATIONS entry %q: must be CREATE or UPDATE", value)
+		}
+	}
+	return operations, nil
+}
+
+// handlesOperation reports whether /mutate acts on the operation. Requests
+// without an operation are treated as CREATE.
+func handlesOperation(operation admissionv1.Operation) bool {
+	if operation == "" {
+		operation = admissionv1.Create
+	}
+	operations, err := getInjectOperations()
+	return err == nil && operations[operation]
+}
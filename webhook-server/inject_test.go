@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMatchesInjectImage(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		images  []string
+		want    bool
+		wantErr bool
+	}{
+		{name: "unset", images: []string{"registry.example.com/payments/api:v1"}},
+		{name: "substring", pattern: "/payments/", images: []string{"nginx", "registry.example.com/payments/api:v1"}, want: true},
+		{name: "substring miss", pattern: "/payments/", images: []string{"registry.example.com/billing/api:v1"}},
+		{name: "regex", pattern: `regex:^registry\.example\.com/.+:v\d+$`, images: []string{"registry.example.com/payments/api:v1"}, want: true},
+		{name: "regex miss", pattern: `regex:^docker\.io/`, images: []string{"registry.example.com/payments/api:v1"}},
+		{name: "invalid regex", pattern: "regex:(", images: []string{"("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INJECT_IMAGE_MATCH", tt.pattern)
+			if _, err := getImageMatcher(); (err != nil) != tt.wantErr {
+				t.Fatalf("getImageMatcher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			pod := &corev1.Pod{}
+			for _, image := range tt.images {
+				pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Image: image})
+			}
+			if got := matchesInjectImage(pod); got != tt.want {
+				t.Errorf("matchesInjectImage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlesOperation(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations string
+		want       map[admissionv1.Operation]bool
+		wantErr    bool
+	}{
+		{name: "default", want: map[admissionv1.Operation]bool{admissionv1.Create: true, "": true}},
+		{name: "update opt-in", operations: "create, update", want: map[admissionv1.Operation]bool{admissionv1.Create: true, admissionv1.Update: true, "": true}},
+		{name: "update only", operations: "UPDATE", want: map[admissionv1.Operation]bool{admissionv1.Update: true}},
+		{name: "invalid", operations: "CREATE,DELETE", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INJECT_OPERATIONS", tt.operations)
+			if _, err := getInjectOperations(); (err != nil) != tt.wantErr {
+				t.Fatalf("getInjectOperations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, operation := range []admissionv1.Operation{"", admissionv1.Create, admissionv1.Update, admissionv1.Delete} {
+				if got := handlesOperation(operation); got != tt.want[operation] {
+					t.Errorf("handlesOperation(%q) = %v, want %v", operation, got, tt.want[operation])
+				}
+			}
+		})
+	}
+}
+
+func TestInjectLabelValue(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantInject bool
+		wantOptOut bool
+	}{
+		{value: "true", wantInject: true},
+		{value: "True", wantInject: true},
+		{value: " TRUE ", wantInject: true},
+		{value: "false", wantOptOut: true},
+		{value: "FALSE", wantOptOut: true},
+		{value: "0", wantOptOut: true},
+		{value: "yes"},
+		{value: ""},
+	}
+	for _, tt := range tests {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{injectLabel: tt.value}}}
+		if got := injectLabelValue(pod) == "true"; got != tt.wantInject {
+			t.Errorf("injectLabelValue(%q) == true is %v, want %v", tt.value, got, tt.wantInject)
+		}
+		if got := optsOutOfInjection(pod); got != tt.wantOptOut {
+			t.Errorf("optsOutOfInjection(%q) = %v, want %v", tt.value, got, tt.wantOptOut)
+		}
+	}
+}
+
+func TestShouldInject(t *testing.T) {
+	tests := []struct {
+		name             string
+		label            string
+		image            string
+		namespaceDefault bool
+		want             bool
+		wantSource       injectSource
+		wantLookup       bool
+	}{
+		{name: "opt-out beats everything", label: "false", image: "payments/api", namespaceDefault: true, wantSource: injectSourceOptOut},
+		{name: "label", label: "true", wantSource: injectSourceLabel, want: true},
+		{name: "image", image: "payments/api", wantSource: injectSourceImage, want: true},
+		{name: "namespace", image: "nginx", namespaceDefault: true, wantSource: injectSourceNamespace, want: true, wantLookup: true},
+		{name: "none", image: "nginx", wantSource: injectSourceNone, wantLookup: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INJECT_IMAGE_MATCH", "payments/")
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Image: tt.image}}}}
+			if tt.label != "" {
+				pod.Labels = map[string]string{injectLabel: tt.label}
+			}
+			looked := false
+			inject, source, reason := shouldInject(pod, func() bool {
+				looked = true
+				return tt.namespaceDefault
+			})
+			if inject != tt.want || source != tt.wantSource {
+				t.Errorf("shouldInject() = %v, %s, want %v, %s", inject, source, tt.want, tt.wantSource)
+			}
+			if reason == "" {
+				t.Error("shouldInject() returned no reason")
+			}
+			if looked != tt.wantLookup {
+				t.Errorf("shouldInject() looked up the namespace: %v, want %v", looked, tt.wantLookup)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// annotationIP carries the sidecar's tailnet IPs, comma separated, once
+	// it has connected. It is set after admission by the IP annotator.
+	annotationIP = "tailscale.com/ip"
+
+	// stateKeyDeviceIPs is the state secret key containerboot writes the
+	// node's tailnet IPs to, as a JSON array.
+	stateKeyDeviceIPs = "device_ips"
+)
+
+// startIPAnnotator watches pods when TS_ANNOTATE_IP=true and stamps the
+// tailnet IPs of injected pods on them. The sidecar stores its IPs in its
+// state secret after connecting, which does not touch the pod, so pods are
+// rechecked every TS_ANNOTATE_IP_RESYNC (default: 1m).
+func startIPAnnotator(ctx context.Context) {
+	if getEnv("TS_ANNOTATE_IP", "false") != "true" {
+		return
+	}
+	if kubeClient == nil {
+		log.Printf("TS_ANNOTATE_IP is set but the Kubernetes API is unavailable, IP annotations disabled")
+		return
+	}
+	resync, err := getIPAnnotatorResync()
+	if err != nil {
+		log.Printf("Not annotating pod IPs: %v", err)
+		return
+	}
+
+	factory := informers.NewSharedInformerFactory(kubeClient, resync)
+	annotate := func(obj interface{}) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		if err := annotatePodIP(ctx, kubeClient, pod); err != nil {
+			log.Printf("Error annotating tailnet IP of pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	factory.Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    annotate,
+		UpdateFunc: func(_, obj interface{}) { annotate(obj) },
+	})
+	factory.Start(ctx.Done())
+	log.Printf("Annotating injected pods with their tailnet IPs")
+}
+
+// getIPAnnotatorResync returns TS_ANNOTATE_IP_RESYNC.
+func getIPAnnotatorResync() (time.Duration, error) {
+	value := getEnv("TS_ANNOTATE_IP_RESYNC", "1m")
+	resync, err := time.ParseDuration(value)
+	if err != nil || resync <= 0 {
+		return 0, fmt.Errorf("invalid TS_ANNOTATE_IP_RESYNC %q: must be a positive duration", value)
+	}
+	return resync, nil
+}
+
+// podStateSecret returns the state secret of an injected pod's sidecar, from
+// its TS_KUBE_SECRET env var with pod name and namespace references
+// expanded, or "" when the sidecar keeps no state secret.
+func podStateSecret(pod *corev1.Pod) string {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if !isInjectedContainer(container.Name) || container.Name == configReloaderName {
+				continue
+			}
+			for _, env := range container.Env {
+				if env.Name != "TS_KUBE_SECRET" {
+					continue
+				}
+				name := strings.NewReplacer("$(POD_NAME)", pod.Name, "$(POD_NAMESPACE)", pod.Namespace).Replace(env.Value)
+				if strings.Contains(name, "$(") {
+					return ""
+				}
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// annotatePodIP sets the tailscale.com/ip annotation of an injected pod from
+// the device IPs in its state secret. Pods that were not injected, are not
+// running, or whose sidecar has not connected yet are left alone.
+func annotatePodIP(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) error {
+	if _, injected := pod.Annotations[annotationWebhookVersion]; !injected || pod.Status.Phase != corev1.PodRunning {
+		return nil
+	}
+	secretName := podStateSecret(pod)
+	if secretName == "" {
+		return nil
+	}
+	secret, err := client.CoreV1().Secrets(pod.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("reading state secret %s: %v", secretName, err)
+	}
+	raw, ok := secret.Data[stateKeyDeviceIPs]
+	if !ok {
+		return nil
+	}
+	var ips []string
+	if err := json.Unmarshal(raw, &ips); err != nil {
+		return fmt.Errorf("parsing %s of state secret %s: %v", stateKeyDeviceIPs, secretName, err)
+	}
+	value := strings.Join(ips, ",")
+	if value == "" || pod.Annotations[annotationIP] == value {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{annotationIP: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+	log.Printf("Annotated pod %s/%s with tailnet IPs %s", pod.Namespace, pod.Name, value)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodStateSecret(t *testing.T) {
+	sidecar := func(value string) corev1.Container {
+		return corev1.Container{Name: "ts-sidecar", Env: []corev1.EnvVar{{Name: "TS_KUBE_SECRET", Value: value}}}
+	}
+	tests := []struct {
+		name       string
+		podName    string
+		containers []corev1.Container
+		want       string
+	}{
+		{name: "expanded", podName: "web", containers: []corev1.Container{sidecar("tailscale-$(POD_NAMESPACE)-$(POD_NAME)")}, want: "tailscale-prod-web"},
+		{name: "literal", podName: "web", containers: []corev1.Container{sidecar("ts-state")}, want: "ts-state"},
+		{name: "unknown reference", podName: "web", containers: []corev1.Container{sidecar("tailscale-$(POD_UID)")}},
+		{name: "no state secret", podName: "web", containers: []corev1.Container{{Name: "ts-sidecar"}}},
+		{name: "app container", podName: "web", containers: []corev1.Container{{Name: "app", Env: []corev1.EnvVar{{Name: "TS_KUBE_SECRET", Value: "other"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: tt.podName, Namespace: "prod"},
+				Spec:       corev1.PodSpec{Containers: tt.containers},
+			}
+			if got := podStateSecret(pod); got != tt.want {
+				t.Errorf("podStateSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnnotatePodIP(t *testing.T) {
+	injected := func(phase corev1.PodPhase, annotations map[string]string) *corev1.Pod {
+		all := map[string]string{annotationWebhookVersion: version}
+		for k, v := range annotations {
+			all[k] = v
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Annotations: all},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "ts-sidecar",
+				Env:  []corev1.EnvVar{{Name: "TS_KUBE_SECRET", Value: "ts-state"}},
+			}}},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	tests := []struct {
+		name      string
+		pod       *corev1.Pod
+		deviceIPs string
+		want      string
+		wantErr   bool
+	}{
+		{name: "annotated", pod: injected(corev1.PodRunning, nil), deviceIPs: `["100.64.0.1","fd7a:115c:a1e0::1"]`, want: "100.64.0.1,fd7a:115c:a1e0::1"},
+		{name: "not running", pod: injected(corev1.PodPending, nil), deviceIPs: `["100.64.0.1"]`},
+		{name: "not connected", pod: injected(corev1.PodRunning, nil)},
+		{name: "unchanged", pod: injected(corev1.PodRunning, map[string]string{annotationIP: "100.64.0.1"}), deviceIPs: `["100.64.0.1"]`, want: "100.64.0.1"},
+		{name: "invalid state", pod: injected(corev1.PodRunning, nil), deviceIPs: `100.64.0.1`, wantErr: true},
+		{
+			name: "not injected",
+			pod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+				Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+			},
+			deviceIPs: `["100.64.0.1"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ts-state", Namespace: "prod"}}
+			if tt.deviceIPs != "" {
+				secret.Data = map[string][]byte{stateKeyDeviceIPs: []byte(tt.deviceIPs)}
+			}
+			client := fake.NewSimpleClientset(tt.pod, secret)
+			err := annotatePodIP(context.Background(), client, tt.pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("annotatePodIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			pod, err := client.CoreV1().Pods("prod").Get(context.Background(), "web", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pod.Annotations[annotationIP]; got != tt.want {
+				t.Errorf("%s = %q, want %q", annotationIP, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIPAnnotatorResync(t *testing.T) {
+	for value, wantErr := range map[string]bool{"": false, "30s": false, "0s": true, "-1m": true, "often": true} {
+		t.Setenv("TS_ANNOTATE_IP_RESYNC", value)
+		if _, err := getIPAnnotatorResync(); (err != nil) != wantErr {
+			t.Errorf("getIPAnnotatorResync() with %q error = %v, wantErr %v", value, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getLatencyBudget returns the MAX_LATENCY_MS budget for patch generation, or
+// 0 when unlimited.
+func getLatencyBudget() (time.Duration, error) {
+	value := getEnv("MAX_LATENCY_MS", "")
+	if value == "" {
+		return 0, nil
+	}
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("invalid MAX_LATENCY_MS %q: must be a non-negative number of milliseconds", value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+type patchResult struct {
+	patches  []patchOperation
+	warnings []string
+	err      error
+}
+
+// generateWithinBudget runs generateSidecarPatch, giving up once the latency
+// budget is exceeded so that the webhook never delays pod creation for
+// long. It returns false when the budget ran out; generation is then
+// cancelled through its context, and abandoned is closed once it returned,
+// so that callers can hold their mutation slot until the work is done.
+func generateWithinBudget(ctx context.Context, pod *corev1.Pod) (result patchResult, abandoned <-chan struct{}, ok bool) {
+	budget, _ := getLatencyBudget()
+	if budget == 0 {
+		patches, warnings, err := generateSidecarPatch(ctx, pod)
+		return patchResult{patches, warnings, err}, nil, true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	done := make(chan patchResult, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		defer cancel()
+		patches, warnings, err := generateSidecarPatch(ctx, pod)
+		done <- patchResult{patches, warnings, err}
+	}()
+	select {
+	case result := <-done:
+		return result, nil, true
+	case <-ctx.Done():
+		return patchResult{}, finished, false
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGenerateWithinBudget(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget string
+		lookup time.Duration
+		wantOK bool
+	}{
+		{name: "unlimited", lookup: 20 * time.Millisecond, wantOK: true},
+		{name: "within budget", budget: "1000", wantOK: true},
+		{name: "exceeded", budget: "10", lookup: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_LATENCY_MS", tt.budget)
+			client := fake.NewSimpleClientset()
+			client.PrependReactor("get", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+				time.Sleep(tt.lookup)
+				return false, nil, nil
+			})
+			previous := kubeClient
+			kubeClient = client
+			t.Cleanup(func() { kubeClient = previous })
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}},
+			}
+			result, abandoned, ok := generateWithinBudget(context.Background(), pod)
+			if ok != tt.wantOK {
+				t.Fatalf("generateWithinBudget() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok {
+				if result.err != nil || len(result.patches) == 0 {
+					t.Errorf("result = %+v, want patches", result)
+				}
+				return
+			}
+			// The abandoned generation still runs, so callers keep their slot
+			select {
+			case <-abandoned:
+				t.Fatal("abandoned closed before generation returned")
+			default:
+			}
+			select {
+			case <-abandoned:
+			case <-time.After(5 * time.Second):
+				t.Fatal("abandoned not closed after generation returned")
+			}
+		})
+	}
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	admissionv1 "k8s.io/api/admission/v1"
@@ -15,8 +16,13 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
+// version is the webhook build version, set with
+// -ldflags "-X main.version=<version>".
+var version = "dev"
+
 var (
 	runtimeScheme = runtime.NewScheme()
 	codecs        = serializer.NewCodecFactory(runtimeScheme)
@@ -28,6 +34,33 @@ func init() {
 	_ = admissionv1.AddToScheme(runtimeScheme)
 }
 
+const (
+	annotationFirewallMode   = "tailscale.com/firewall-mode"
+	annotationNetworkingMode = "tailscale.com/networking-mode"
+	annotationUserspace      = "tailscale.com/userspace"
+	annotationHostname       = "tailscale.com/hostname"
+
+	// annotationWebhookVersion records which webhook build injected the pod.
+	annotationWebhookVersion = "tailscale.com/webhook-version"
+)
+
+// Networking modes for tailscaled. Kernel mode uses a TUN device and needs a
+// privileged container, userspace mode runs unprivileged with netstack.
+const (
+	networkingModeKernel    = "kernel"
+	networkingModeUserspace = "userspace"
+)
+
+// validFirewallModes lists the accepted firewall mode values. "off" and
+// "none" are equivalent and stop tailscaled from touching netfilter at all.
+var validFirewallModes = map[string]bool{
+	"auto":     true,
+	"iptables": true,
+	"nftables": true,
+	"off":      true,
+	"none":     true,
+}
+
 type patchOperation struct {
 	Op    string      `json:"op"`
 	Path  string      `json:"path"`
@@ -39,79 +72,499 @@ func main() {
 	keyPath := getEnv("TLS_KEY", "/etc/webhook/certs/tls.key")
 	port := getEnv("PORT", "8443")
 
+	if err := validateConfig(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	initKubeClient()
+	initNamespaceCache()
+	initRecentDecisions()
+	initEventRecorder()
+	initInjectLimiter()
+	initMutationSlots()
+	initPatchCache()
+	initFallbackSignal()
+	startIPAnnotator(context.Background())
+
+	tlsConfig, err := getTLSConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	certs, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		log.Fatalf("Failed to load certificate: %v", err)
+	}
+	reloadInterval, _ := getCertReloadInterval()
+	certs.watch(reloadInterval)
+	tlsConfig.GetCertificate = certs.getCertificate
+
+	handlers, err := getHandlers()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/mutate", mutateHandler)
-	mux.HandleFunc("/health", healthHandler)
-
-	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: mux,
-		TLSConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		},
+	for _, h := range handlers {
+		mux.HandleFunc(h.path, h.handler)
 	}
 
-	log.Printf("Starting webhook server on port %s", port)
-	if err := server.ListenAndServeTLS(certPath, keyPath); err != nil {
+	server, err := newServer(fmt.Sprintf(":%s", port), mux, tlsConfig)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	log.Printf("Starting webhook server %s on port %s", version, port)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
+type handlerRoute struct {
+	path    string
+	handler http.HandlerFunc
+}
+
+// getHandlers returns the HTTP routes of the webhook, with the admission
+// paths taken from MUTATE_PATH (default: /mutate) and VALIDATE_PATH (default:
+// /validate). Overlapping paths are rejected, since one handler would then
+// silently shadow the other.
+func getHandlers() ([]handlerRoute, error) {
+	handlers := []handlerRoute{
+		{getEnv("MUTATE_PATH", "/mutate"), mutateHandler},
+		{getEnv("VALIDATE_PATH", "/validate"), validateHandler},
+		{"/health", healthHandler},
+		{"/debug/recent", recentHandler},
+		{"/metrics", metricsHandler},
+	}
+	seen := map[string]bool{}
+	for _, h := range handlers {
+		if !strings.HasPrefix(h.path, "/") {
+			return nil, fmt.Errorf("handler path %q must start with /", h.path)
+		}
+		// ServeMux treats a trailing slash as a subtree, matching the same
+		// requests as the path without it
+		path := strings.TrimSuffix(h.path, "/")
+		if seen[path] {
+			return nil, fmt.Errorf("handler path %q is used more than once, check MUTATE_PATH and VALIDATE_PATH", h.path)
+		}
+		seen[path] = true
+	}
+	return handlers, nil
+}
+
+// validateConfig checks the environment based configuration at startup so
+// that mistakes fail fast instead of on every admission request.
+func validateConfig() error {
+	if _, err := getNetworkingMode(&corev1.Pod{}, &sidecarProfile{}); err != nil {
+		return fmt.Errorf("TS_NETWORKING_MODE: %v", err)
+	}
+	if _, err := loadProfiles(); err != nil {
+		return err
+	}
+	if suffix := getHostnameSuffix(); len(suffix) > maxHostnameSuffixLen {
+		return fmt.Errorf("TS_HOSTNAME_SUFFIX %q is longer than %d characters", suffix, maxHostnameSuffixLen)
+	}
+	if _, err := getHostnameTemplate(); err != nil {
+		return err
+	}
+	if _, err := getNameScheme(); err != nil {
+		return err
+	}
+	if _, err := getImagePullPolicy(); err != nil {
+		return err
+	}
+	if _, err := getImagePresentRequirement(); err != nil {
+		return err
+	}
+	if denied := getDeniedFlags(); len(denied) > 0 {
+		args, err := splitArgs(getEnv("TS_EXTRA_ARGS", ""))
+		if err != nil {
+			return fmt.Errorf("invalid TS_EXTRA_ARGS: %v", err)
+		}
+		if arg := findDeniedFlag(args, denied); arg != "" {
+			return fmt.Errorf("TS_EXTRA_ARGS passes %s, which DENIED_EXTRA_FLAGS denies", arg)
+		}
+	}
+	if _, _, err := getNetpolLabel(); err != nil {
+		return err
+	}
+	if _, err := loadTailnets(); err != nil {
+		return err
+	}
+	if _, err := getRecordCollisionPolicy(); err != nil {
+		return err
+	}
+	if _, _, err := getPatchCacheConfig(); err != nil {
+		return err
+	}
+	if _, err := getServerConfig(); err != nil {
+		return err
+	}
+	if _, err := getDefaultPriorityClass(); err != nil {
+		return err
+	}
+	if _, err := getTags(&corev1.Pod{}); err != nil {
+		return err
+	}
+	if _, err := getImageMatcher(); err != nil {
+		return err
+	}
+	if _, _, err := getExtraVolumes(); err != nil {
+		return err
+	}
+	if _, err := getHealthCheckPort(); err != nil {
+		return err
+	}
+	if _, err := getSidecarEnv(); err != nil {
+		return err
+	}
+	if _, _, err := getMaxRoutes(); err != nil {
+		return err
+	}
+	if _, err := getNamespaceLabelKeys(); err != nil {
+		return err
+	}
+	if _, err := getHandlers(); err != nil {
+		return err
+	}
+	if _, err := getIPAnnotatorResync(); err != nil {
+		return err
+	}
+	if _, _, err := getMaxConcurrentMutations(); err != nil {
+		return err
+	}
+	if _, _, _, err := getInjectRate(); err != nil {
+		return err
+	}
+	if _, err := getLatencyBudget(); err != nil {
+		return err
+	}
+	if _, err := getHostNamespacePolicy(); err != nil {
+		return err
+	}
+	if _, err := getStateOwnerPolicy(); err != nil {
+		return err
+	}
+	if _, err := getMeshPolicy(); err != nil {
+		return err
+	}
+	if _, err := getSeccompProfile(); err != nil {
+		return err
+	}
+	if _, err := getInjectOperations(); err != nil {
+		return err
+	}
+	if _, err := getTLSConfig(); err != nil {
+		return err
+	}
+	if _, err := getCertReloadInterval(); err != nil {
+		return err
+	}
+	if port, err := parsePort(getEnv("TS_METRICS_PORT", "9002")); err != nil {
+		return fmt.Errorf("invalid TS_METRICS_PORT: %v", err)
+	} else if healthPort, _ := getHealthCheckPort(); int32(port) == healthPort {
+		return fmt.Errorf("TS_METRICS_PORT and TS_HEALTHCHECK_PORT must differ")
+	}
+	if _, err := getWaitConnected(); err != nil {
+		return err
+	}
+	if _, err := getDefaultShutdownDelay(); err != nil {
+		return err
+	}
+	if _, err := getReadinessGate(); err != nil {
+		return err
+	}
+	if _, err := parsePortSpec(getEnv("TS_SIDECAR_PORTS", "")); err != nil {
+		return fmt.Errorf("invalid TS_SIDECAR_PORTS: %v", err)
+	}
+	if _, _, err := getConfigReloader(); err != nil {
+		return err
+	}
+	for _, mode := range []string{networkingModeKernel, networkingModeUserspace} {
+		if _, err := getSidecarResources(mode, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("OK"))
 }
 
-func mutateHandler(w http.ResponseWriter, r *http.Request) {
+// checkReviewVersion verifies that body is an admission.k8s.io/v1
+// AdmissionReview. Other versions are counted and answered with a Status
+// listing the supported version, since the API server cannot read a response
+// in a version it did not send. Bodies that are not JSON are left to the
+// deserializer to report.
+func checkReviewVersion(w http.ResponseWriter, body []byte) bool {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(body, &typeMeta); err != nil {
+		return true
+	}
+	supported := admissionv1.SchemeGroupVersion.WithKind("AdmissionReview")
+	if typeMeta.GroupVersionKind() == supported {
+		return true
+	}
+
+	var causes []metav1.StatusCause
+	if typeMeta.APIVersion != supported.GroupVersion().String() {
+		causes = append(causes, metav1.StatusCause{Type: metav1.CauseTypeFieldValueNotSupported, Field: "apiVersion", Message: "supported values: " + supported.GroupVersion().String()})
+	}
+	if typeMeta.Kind != supported.Kind {
+		causes = append(causes, metav1.StatusCause{Type: metav1.CauseTypeFieldValueNotSupported, Field: "kind", Message: "supported values: " + supported.Kind})
+	}
+	versionMismatches.Add(1)
+	log.Printf("Unsupported admission review apiVersion %q kind %q, expected %s %s", typeMeta.APIVersion, typeMeta.Kind, supported.GroupVersion(), supported.Kind)
+	status := metav1.Status{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+		Status:   metav1.StatusFailure,
+		Message:  fmt.Sprintf("unsupported AdmissionReview apiVersion %q kind %q, supported: %s %s", typeMeta.APIVersion, typeMeta.Kind, supported.GroupVersion(), supported.Kind),
+		Reason:   metav1.StatusReasonBadRequest,
+		Code:     http.StatusBadRequest,
+		Details:  &metav1.StatusDetails{Causes: causes},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(status)
+	return false
+}
+
+// readPodReview decodes the admission review of a pod request. It writes the
+// error or empty object response itself and returns ok=false when there is
+// no pod to act on.
+func readPodReview(w http.ResponseWriter, r *http.Request) (*admissionv1.AdmissionReview, *corev1.Pod, bool) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+		return nil, nil, false
 	}
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		log.Printf("Error reading request body: %v", err)
 		http.Error(w, "Error reading request body", http.StatusBadRequest)
-		return
+		return nil, nil, false
 	}
 	defer r.Body.Close()
 
+	if !checkReviewVersion(w, body) {
+		return nil, nil, false
+	}
+
 	var admissionReview admissionv1.AdmissionReview
 	if _, _, err := deserializer.Decode(body, nil, &admissionReview); err != nil {
 		log.Printf("Error decoding admission review: %v", err)
 		http.Error(w, fmt.Sprintf("Error decoding admission review: %v", err), http.StatusBadRequest)
-		return
+		return nil, nil, false
+	}
+
+	if admissionReview.Request == nil {
+		log.Printf("Admission review has no request")
+		http.Error(w, "Admission review has no request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	// Some subresource or malformed requests carry no object; unmarshaling
+	// would yield an empty pod with nonsensical derived names
+	if len(admissionReview.Request.Object.Raw) == 0 {
+		allowed := getEnv("EMPTY_OBJECT_POLICY", "allow") != "deny"
+		log.Printf("Admission request %s for %s/%s has no object, allowed=%t", admissionReview.Request.UID, admissionReview.Request.Namespace, admissionReview.Request.Name, allowed)
+		sendAdmissionResponse(w, &admissionReview, nil, allowed, "Admission request has no object", nil, nil)
+		return nil, nil, false
 	}
 
 	pod := &corev1.Pod{}
 	if err := json.Unmarshal(admissionReview.Request.Object.Raw, pod); err != nil {
 		log.Printf("Error unmarshaling pod: %v", err)
 		http.Error(w, fmt.Sprintf("Error unmarshaling pod: %v", err), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	// Pods created through controllers often have no namespace in the object
+	if pod.Namespace == "" {
+		pod.Namespace = admissionReview.Request.Namespace
+	}
+	return &admissionReview, pod, true
+}
+
+func mutateHandler(w http.ResponseWriter, r *http.Request) {
+	admissionReview, pod, ok := readPodReview(w, r)
+	if !ok {
+		return
+	}
+
+	debug := debugRequested(r)
+	if debug {
+		log.Printf("[debug] %s request %s for pod %s/%s", admissionReview.Request.Operation, admissionReview.Request.UID, pod.Namespace, pod.Name)
+	}
+
+	operation := admissionReview.Request.Operation
+	if !handlesOperation(operation) {
+		log.Printf("Not handling %s of pod %s/%s", operation, pod.Namespace, pod.Name)
+		skip(w, admissionReview, pod, skipOperationNotHandled, fmt.Sprintf("Operation %s is not handled", operation), nil)
+		return
+	}
+
+	// Static pods are managed by the kubelet, a patch to their mirror pod
+	// would never reach the running pod
+	if _, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]; ok {
+		log.Printf("Pod %s/%s is a mirror pod of a static pod, skipping", pod.Namespace, pod.Name)
+		skip(w, admissionReview, pod, skipMirrorPod, "Mirror pods are not mutated", nil)
+		return
+	}
+
+	// Check if pod has the injection label, runs a matching image or is in a
+	// namespace that injects by default
+	inject, source, reason := shouldInject(pod, func() bool {
+		return namespaceInjectsByDefault(r.Context(), pod.Namespace)
+	})
+	if !inject {
+		log.Printf("Pod %s/%s is not injected: %s, skipping", pod.Namespace, pod.Name, reason)
+		skip(w, admissionReview, pod, skipNoInjectLabel, "Pod does not require sidecar injection", nil)
 		return
 	}
+	debugf("Pod %s/%s requests injection by %s: %s", pod.Namespace, pod.Name, source, reason)
 
-	// Check if pod has the injection label
-	injectLabel := pod.Labels["tailscale.com/inject"]
-	if injectLabel != "true" {
-		log.Printf("Pod %s/%s does not have tailscale.com/inject=true label, skipping", pod.Namespace, pod.Name)
-		sendAdmissionResponse(w, &admissionReview, nil, true, "Pod does not require sidecar injection")
+	if !supportsPodOS(pod) {
+		log.Printf("Pod %s/%s targets %s nodes, skipping", pod.Namespace, pod.Name, getPodOS(pod))
+		skip(w, admissionReview, pod, skipUnsupportedOS, "Pod OS is not supported", nil)
 		return
 	}
 
 	// Check if sidecar already exists (check for ts-sidecar or ts-sidecar-* pattern)
 	sidecarName := getSidecarName(pod)
-	for _, container := range pod.Spec.Containers {
-		if container.Name == "ts-sidecar" || container.Name == sidecarName {
-			log.Printf("Pod %s/%s already has sidecar container (%s), skipping", pod.Namespace, pod.Name, container.Name)
-			sendAdmissionResponse(w, &admissionReview, nil, true, "Sidecar already exists")
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if container.Name == "ts-sidecar" || container.Name == sidecarName {
+				log.Printf("Pod %s/%s already has sidecar container (%s), skipping", pod.Namespace, pod.Name, container.Name)
+				var warnings []string
+				if drift := checkSidecarDrift(r.Context(), pod, container); drift != "" {
+					log.Printf("Warning: pod %s/%s: %s", pod.Namespace, pod.Name, drift)
+					warnings = append(warnings, drift)
+				}
+				skip(w, admissionReview, pod, skipAlreadyInjected, "Sidecar already exists", warnings)
+				return
+			}
+		}
+	}
+
+	// Containers of an existing pod are immutable, so updates only get the
+	// drift check above
+	if operation == admissionv1.Update {
+		log.Printf("Pod %s/%s has no sidecar and cannot be injected on update, skipping", pod.Namespace, pod.Name)
+		skip(w, admissionReview, pod, skipUpdate, "Sidecars are only injected on create", nil)
+		return
+	}
+
+	// Bound the admissions doing API lookups and patch generation at once
+	release, ok := acquireMutationSlot(r.Context(), mutationSlots)
+	if !ok {
+		const message = "Too many concurrent mutations"
+		if skipOnError() {
+			log.Printf("Too many concurrent mutations, allowing pod %s/%s without sidecar", pod.Namespace, pod.Name)
+			emitSkipEvent(admissionReview, pod, "Tailscale sidecar not injected: too many concurrent mutations")
+			skip(w, admissionReview, pod, skipConcurrencyLimited, message, nil)
+			return
+		}
+		log.Printf("Too many concurrent mutations, denying pod %s/%s", pod.Namespace, pod.Name)
+		respond(w, admissionReview, pod, nil, false, message, nil, nil)
+		return
+	}
+	defer func() { release() }()
+
+	if isNamespaceTerminating(r.Context(), pod.Namespace) {
+		log.Printf("Namespace %s is terminating, skipping pod %s", pod.Namespace, pod.Name)
+		skip(w, admissionReview, pod, skipNamespaceTerminating, "Namespace is terminating", nil)
+		return
+	}
+
+	// Let the external policy service, if configured, have the final word
+	if decision := consultPolicy(r.Context(), pod); decision != nil {
+		switch decision.Decision {
+		case policyDecisionSkip:
+			log.Printf("Policy service skipped pod %s/%s: %s", pod.Namespace, pod.Name, decision.Reason)
+			skip(w, admissionReview, pod, skipPolicy, "Injection skipped by policy", nil)
+			return
+		case policyDecisionDeny:
+			log.Printf("Policy service denied pod %s/%s: %s", pod.Namespace, pod.Name, decision.Reason)
+			respond(w, admissionReview, pod, nil, false, fmt.Sprintf("Denied by policy: %s", decision.Reason), nil, nil)
 			return
 		}
+		r = r.WithContext(applyPolicyOverrides(r.Context(), pod, decision.Overrides))
+	}
+
+	// Pods sharing the node's PID or IPC namespace expose the node to the sidecar
+	hostWarning, err := checkHostNamespaces(pod)
+	if err != nil {
+		log.Printf("Denying pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		respond(w, admissionReview, pod, nil, false, err.Error(), statusCauses(err), nil)
+		return
 	}
 
 	log.Printf("Injecting Tailscale sidecar into pod %s/%s", pod.Namespace, pod.Name)
 
-	// Generate patch operations
-	patches := generateSidecarPatch(pod)
+	// Generate patch operations, unless an identical pod was just injected
+	var cacheKey string
+	if patchResults != nil {
+		if cacheKey, err = patchCacheKey(r.Context(), pod); err != nil {
+			log.Printf("Error hashing pod %s/%s, not caching its patch: %v", pod.Namespace, pod.Name, err)
+			cacheKey = ""
+		}
+	}
+	var patches []patchOperation
+	var warnings []string
+	cached := false
+	if cacheKey != "" {
+		patches, warnings, cached = patchResults.get(cacheKey)
+	}
+	if cached {
+		debugf("Using cached patch for pod %s/%s", pod.Namespace, pod.Name)
+	} else {
+		result, abandoned, ok := generateWithinBudget(r.Context(), pod)
+		if !ok {
+			// Hold the slot until the abandoned generation returns, so that
+			// MAX_CONCURRENT_MUTATIONS still bounds the work in flight
+			slot := release
+			release = func() {}
+			go func() {
+				<-abandoned
+				slot()
+			}()
+			log.Printf("Patch generation for pod %s/%s exceeded MAX_LATENCY_MS, allowing without sidecar", pod.Namespace, pod.Name)
+			emitSkipEvent(admissionReview, pod, "Tailscale sidecar not injected: patch generation exceeded the latency budget")
+			skip(w, admissionReview, pod, skipLatencyBudget, "Patch generation exceeded the latency budget", nil)
+			return
+		}
+		patches, warnings, err = result.patches, result.warnings, result.err
+		if err == nil && cacheKey != "" {
+			patchResults.put(cacheKey, patches, warnings)
+		}
+	}
+	if err != nil {
+		if skipOnError() {
+			log.Printf("Skipping injection for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+			emitSkipEvent(admissionReview, pod, "Tailscale sidecar not injected: "+err.Error())
+			skip(w, admissionReview, pod, skipInjectionError, err.Error(), nil)
+			return
+		}
+		log.Printf("Denying pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		respond(w, admissionReview, pod, nil, false, err.Error(), statusCauses(err), nil)
+		return
+	}
+
+	// Smooth out node registrations during scale events. Dry-run pods never
+	// register a node, so they do not use up the rate limit.
+	if !isDryRun(admissionReview) && !waitForInjection(r.Context(), injectLimiter) {
+		const message = "Injection rate limit exceeded"
+		if skipOnError() {
+			log.Printf("Injection rate limit exceeded for pod %s/%s, allowing without sidecar", pod.Namespace, pod.Name)
+			emitSkipEvent(admissionReview, pod, "Tailscale sidecar not injected: injection rate limit exceeded")
+			skip(w, admissionReview, pod, skipRateLimited, message, nil)
+			return
+		}
+		log.Printf("Injection rate limit exceeded, denying pod %s/%s", pod.Namespace, pod.Name)
+		respond(w, admissionReview, pod, nil, false, message, nil, nil)
+		return
+	}
 
 	patchBytes, err := json.Marshal(patches)
 	if err != nil {
@@ -120,8 +573,28 @@ func mutateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if debug {
+		log.Printf("[debug] Patch for pod %s/%s: %s", pod.Namespace, pod.Name, redactForLog(patches))
+	}
+
+	if hostWarning != "" {
+		warnings = append(warnings, hostWarning)
+	}
+
 	patchType := admissionv1.PatchTypeJSONPatch
-	sendAdmissionResponse(w, &admissionReview, patchBytes, true, "Sidecar injected successfully", &patchType)
+	respond(w, admissionReview, pod, patchBytes, true, "Sidecar injected successfully", nil, warnings, &patchType)
+}
+
+// respond records the decision for /debug/recent and sends the response.
+func respond(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview, pod *corev1.Pod, patch []byte, allowed bool, message string, causes []metav1.StatusCause, warnings []string, patchType ...*admissionv1.PatchType) {
+	outcome := outcomeSkipped
+	if !allowed {
+		outcome = outcomeDenied
+	} else if len(patch) > 0 {
+		outcome = outcomeInjected
+	}
+	recordDecision(pod, outcome, message)
+	sendAdmissionResponse(w, admissionReview, patch, allowed, message, causes, warnings, patchType...)
 }
 
 func getSidecarName(pod *corev1.Pod) string {
@@ -165,14 +638,389 @@ func sanitizeK8sName(name string) string {
 	return result
 }
 
-func generateSidecarPatch(pod *corev1.Pod) []patchOperation {
+// getFirewallMode resolves the firewall mode for the pod. The
+// tailscale.com/firewall-mode annotation wins, then TS_HOST_NETWORK_FIREWALL_MODE
+// for hostNetwork pods, then TS_FIREWALL_MODE.
+func getFirewallMode(pod *corev1.Pod) (string, error) {
+	mode := getEnv("TS_FIREWALL_MODE", "auto")
+	if pod.Spec.HostNetwork {
+		mode = getEnv("TS_HOST_NETWORK_FIREWALL_MODE", mode)
+	}
+	if value, ok := pod.Annotations[annotationFirewallMode]; ok {
+		mode = value
+	}
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if !validFirewallModes[mode] {
+		return "", settingError(pod, annotationFirewallMode, "TS_FIREWALL_MODE", mode, "must be one of auto, iptables, nftables, off, none")
+	}
+	return mode, nil
+}
+
+// getSidecarImage returns the tailscale image for the pod's OS, or else
+// TS_IMAGE_FALLBACK while in use, TS_IMAGE_MIRROR, the profile image or
+// TS_IMAGE.
+func getSidecarImage(pod *corev1.Pod, profile *sidecarProfile) string {
+	if image := getOSImage(pod); image != "" {
+		return image
+	}
+	if image := getFallbackImage(pod); image != "" {
+		return image
+	}
+	if mirror := getEnv("TS_IMAGE_MIRROR", ""); mirror != "" {
+		return mirror
+	}
+	if profile.Image != "" {
+		return profile.Image
+	}
+	return getEnv("TS_IMAGE", "ghcr.io/tailscale/tailscale:latest")
+}
+
+// imageWarning returns an admission warning when image comes from
+// TS_IMAGE_FALLBACK or TS_IMAGE_MIRROR, so that pull failures are easy to
+// trace back to it.
+func imageWarning(image string) string {
+	for _, env := range []string{"TS_IMAGE_FALLBACK", "TS_IMAGE_MIRROR"} {
+		if source := getEnv(env, ""); source != "" && image == source {
+			return fmt.Sprintf("Tailscale sidecar uses the image %s (%s); check that registry if the sidecar fails to pull", image, env)
+		}
+	}
+	return ""
+}
+
+// getImagePullPolicy returns the sidecar TS_IMAGE_PULL_POLICY, Always by
+// default.
+func getImagePullPolicy() (corev1.PullPolicy, error) {
+	policy := corev1.PullPolicy(getEnv("TS_IMAGE_PULL_POLICY", string(corev1.PullAlways)))
+	switch policy {
+	case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid TS_IMAGE_PULL_POLICY %q: must be Always, IfNotPresent or Never", policy)
+}
+
+// getNetworkingMode resolves the networking mode for the pod from the
+// tailscale.com/userspace or tailscale.com/networking-mode annotations, the
+// profile, or TS_NETWORKING_MODE. The mode only controls TS_USERSPACE and
+// the resource defaults; whether the container is privileged is decided
+// separately by getPrivileged.
+func getNetworkingMode(pod *corev1.Pod, profile *sidecarProfile) (string, error) {
+	if value, ok := pod.Annotations[annotationUserspace]; ok {
+		userspace, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return "", field.Invalid(annotationPath(annotationUserspace), value, "must be true or false")
+		}
+		if userspace {
+			return networkingModeUserspace, nil
+		}
+		return networkingModeKernel, nil
+	}
+
+	mode := getEnv("TS_NETWORKING_MODE", networkingModeKernel)
+	if profile.NetworkingMode != "" {
+		mode = profile.NetworkingMode
+	}
+	if value, ok := pod.Annotations[annotationNetworkingMode]; ok {
+		mode = value
+	}
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode != networkingModeKernel && mode != networkingModeUserspace {
+		return "", settingError(pod, annotationNetworkingMode, "TS_NETWORKING_MODE", mode, "must be kernel or userspace")
+	}
+	return mode, nil
+}
+
+// appendExtraArg appends a flag to a TS_EXTRA_ARGS string.
+func appendExtraArg(args, arg string) string {
+	if args == "" {
+		return arg
+	}
+	return args + " " + arg
+}
+
+// generateSidecarPatch returns the patch injecting the sidecar into pod. The
+// patch must be deterministic: the same pod and configuration always yield
+// byte-identical patches, so repeated admissions during rollouts do not
+// churn manifests. Never add timestamps, and emit map entries and env vars
+// in sorted order (see addMapEntriesPatch and sortEnv).
+func generateSidecarPatch(ctx context.Context, pod *corev1.Pod) ([]patchOperation, []string, error) {
 	patches := []patchOperation{}
 
 	// Get TS_KUBE_SECRET pattern from environment or use default
 	tsKubeSecretPattern := getEnv("TS_KUBE_SECRET", fmt.Sprintf("tailscale-%s-%s", pod.Namespace, pod.Name))
+	scheme, err := getNameScheme()
+	if err != nil {
+		return nil, nil, err
+	}
+	if id := sharedNameID(pod, getHostnameSuffix()); scheme == nameSchemeShared && id != "" {
+		tsKubeSecretPattern = "tailscale-" + id
+	}
+
+	profile, err := getProfile(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := getPrimaryContainer(pod); err != nil {
+		return nil, nil, err
+	}
 
 	// Get TS_EXTRA_ARGS from environment (can be set via ConfigMap/EnvVar in deployment)
 	tsExtraArgs := getEnv("TS_EXTRA_ARGS", "")
+	if profile.ExtraArgs != "" {
+		tsExtraArgs = appendExtraArg(tsExtraArgs, profile.ExtraArgs)
+	}
+
+	firewallMode, err := getFirewallMode(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	podExtraArgs, err := getPodExtraArgs(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(podExtraArgs) > 0 {
+		tsExtraArgs = appendExtraArg(tsExtraArgs, joinArgs(podExtraArgs))
+	}
+
+	// A pod joining another tailnet logs in to that tailnet's control server
+	tailnet, err := getTailnet(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tailnet != nil {
+		if tsExtraArgs, err = withLoginServer(tsExtraArgs, tailnet.LoginServer); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	hostname, err := getHostname(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	routes, err := getAdvertiseRoutes(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	routes, routesWarning, err := limitRoutes(routes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(routes) > 0 {
+		tsExtraArgs = appendExtraArg(tsExtraArgs, "--advertise-routes="+strings.Join(routes, ","))
+	}
+
+	egressOnly, err := getEgressOnly(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if egressOnly {
+		tsExtraArgs = appendExtraArg(tsExtraArgs, "--shields-up")
+	}
+
+	tags, err := getTags(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkTagsRequired(tags, tsExtraArgs); err != nil {
+		return nil, nil, err
+	}
+	if len(tags) > 0 {
+		tsExtraArgs = appendExtraArg(tsExtraArgs, "--advertise-tags="+strings.Join(tags, ","))
+	}
+
+	nodeAttrs, err := getNodeAttrs(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, arg := range attrArgs(nodeAttrs) {
+		tsExtraArgs = appendExtraArg(tsExtraArgs, arg)
+	}
+
+	networkingMode, err := getNetworkingMode(pod, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	networkingMode = resolveRestrictedMode(pod, networkingMode)
+	userspace := networkingMode == networkingModeUserspace
+
+	privileged, err := getPrivileged(pod, profile, userspace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkPrivilegedAllowed(privileged); err != nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	if warning := sharedNameWarning(pod, scheme); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if privileged {
+		if warning := privilegedWarning(pod); warning != "" {
+			warnings = append(warnings, warning)
+		}
+	}
+	if warning := sharedProcessNamespaceWarning(pod, privileged); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	if routesWarning != "" {
+		warnings = append(warnings, routesWarning)
+	}
+	seccomp, err := getSeccompProfile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	meshAnnotations, meshWarnings, err := getMeshAdjustments(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings = append(warnings, meshWarnings...)
+
+	image := getSidecarImage(pod, profile)
+	pullPolicy, err := getImagePullPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+	// Pods scheduled onto nodes with a pre-pulled image must not pull again
+	imagePresent, err := getImagePresentRequirement()
+	if err != nil {
+		return nil, nil, err
+	}
+	if imagePresent != nil {
+		pullPolicy = corev1.PullIfNotPresent
+	}
+	// A pinned image spec sets both and is not the pre-pulled image
+	specImage, specPolicy, err := getImageSpec(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if specImage != "" {
+		image, pullPolicy, imagePresent = specImage, specPolicy, nil
+	}
+	if warning := imageWarning(image); warning != "" {
+		warnings = append(warnings, warning)
+	}
+	priorityClass, err := getPriorityClass(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	netpolKey, netpolValue, err := getNetpolLabel()
+	if err != nil {
+		return nil, nil, err
+	}
+	acceptDNS, err := getAcceptDNS(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	dnsResolvers, err := getDNSResolvers(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	securityContext := getSecurityContext(profile, userspace, privileged, seccomp)
+
+	resources, err := getSidecarResources(networkingMode, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	extraVolumes, extraMounts, err := getExtraVolumes()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkVolumeMounts(pod, extraVolumes, extraMounts); err != nil {
+		return nil, nil, err
+	}
+
+	healthCheckPort, err := getHealthCheckPort()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ports, err := getSidecarPorts(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	egress, err := getEgressTarget(pod, userspace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metricsPort, err := getMetricsPort(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serveConfig, err := getServeConfig(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if serveConfig != "" {
+		extraVolumes = append(extraVolumes, serveConfigVolume())
+	}
+	serveCertSecret, err := getServeCertSecret(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if serveCertSecret != "" {
+		extraVolumes = append(extraVolumes, serveCertVolume(serveCertSecret))
+	}
+	healthScript, err := getHealthCheckScript(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if healthScript != nil {
+		extraVolumes = append(extraVolumes, healthCheckScriptVolume(healthScript))
+	}
+
+	readinessGate, err := getReadinessGate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shutdownDelay, err := getShutdownDelay(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	waitConnected, err := getWaitConnected()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stateSecret, err := getStateSecret(pod, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sidecarEnv, err := getSidecarEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	paused, err := getPaused(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Paused sidecars need no auth key, applyPaused drops the placeholder
+	authKeyEnv := corev1.EnvVar{Name: "TS_AUTHKEY"}
+	if !paused {
+		authKeyEnv, err = resolveAuthSource(ctx, pod, tailnet)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	reloader, configVolume, err := getConfigReloader()
+	if err != nil {
+		return nil, nil, err
+	}
+	if configVolume != nil {
+		extraVolumes = append(extraVolumes, *configVolume)
+	}
 
 	// Generate unique sidecar name
 	sidecarName := getSidecarName(pod)
@@ -182,8 +1030,8 @@ func generateSidecarPatch(pod *corev1.Pod) []patchOperation {
 	// because for Deployments, the Pod name is not known at injection time.
 	sidecarContainer := corev1.Container{
 		Name:            sidecarName,
-		Image:           "ghcr.io/tailscale/tailscale:latest",
-		ImagePullPolicy: corev1.PullAlways,
+		Image:           image,
+		ImagePullPolicy: pullPolicy,
 		Env: []corev1.EnvVar{
 			{
 				Name: "POD_NAME",
@@ -207,7 +1055,7 @@ func generateSidecarPatch(pod *corev1.Pod) []patchOperation {
 			},
 			{
 				Name:  "TS_HOSTNAME",
-				Value: "$(POD_NAME)-$(POD_NAMESPACE)",
+				Value: hostname,
 			},
 			{
 				Name:  "TS_KUBE_SECRET",
@@ -215,24 +1063,9 @@ func generateSidecarPatch(pod *corev1.Pod) []patchOperation {
 			},
 			{
 				Name:  "TS_USERSPACE",
-				Value: "false",
-			},
-			{
-				Name:  "TS_DEBUG_FIREWALL_MODE",
-				Value: "auto",
-			},
-			{
-				Name: "TS_AUTHKEY",
-				ValueFrom: &corev1.EnvVarSource{
-					SecretKeyRef: &corev1.SecretKeySelector{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: "tailscale-auth",
-						},
-						Key:      "TS_AUTHKEY",
-						Optional: boolPtr(true),
-					},
-				},
+				Value: strconv.FormatBool(userspace),
 			},
+			authKeyEnv,
 			{
 				Name: "POD_UID",
 				ValueFrom: &corev1.EnvVarSource{
@@ -242,9 +1075,46 @@ func generateSidecarPatch(pod *corev1.Pod) []patchOperation {
 				},
 			},
 		},
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: boolPtr(true),
-		},
+		Ports:           ports,
+		Resources:       resources,
+		VolumeMounts:    extraMounts,
+		SecurityContext: securityContext,
+	}
+
+	// In memory state is lost on restart, tailscaled then registers anew
+	stateSecretName := tsKubeSecretPattern
+	if profile.StateMode == stateModeMemory {
+		removeEnvVar(&sidecarContainer, "TS_KUBE_SECRET")
+		stateSecretName = ""
+	}
+	if profile.Socks5Server != "" {
+		setEnvVar(&sidecarContainer, "TS_SOCKS5_SERVER", profile.Socks5Server)
+	}
+	if acceptDNS != nil {
+		setEnvVar(&sidecarContainer, "TS_ACCEPT_DNS", strconv.FormatBool(*acceptDNS))
+	}
+	if stateSecret != "" {
+		setEnvVar(&sidecarContainer, "TS_KUBE_SECRET", stateSecret)
+		stateSecretName = stateSecret
+	}
+	ownerWarning, err := checkStateSecretOwner(ctx, pod, stateSecretName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ownerWarning != "" {
+		warnings = append(warnings, ownerWarning)
+	}
+
+	// With the firewall off, tailscaled must not program netfilter at all, so
+	// drop the firewall mode env and pass --netfilter-mode=off instead. This is
+	// mostly useful for hostNetwork pods where the rules would land on the node.
+	if firewallMode == "off" || firewallMode == "none" {
+		setEnvVar(&sidecarContainer, "TS_EXTRA_ARGS", appendExtraArg(tsExtraArgs, "--netfilter-mode=off"))
+	} else {
+		sidecarContainer.Env = append(sidecarContainer.Env, corev1.EnvVar{
+			Name:  "TS_DEBUG_FIREWALL_MODE",
+			Value: firewallMode,
+		})
 	}
 
 	// Ensure automountServiceAccountToken is enabled (required for Tailscale to access K8s API)
@@ -265,17 +1135,145 @@ func generateSidecarPatch(pod *corev1.Pod) []patchOperation {
 		})
 	}
 
+	priorityPatches, err := priorityClassPatch(ctx, priorityClass)
+	if err != nil {
+		return nil, nil, err
+	}
+	patches = append(patches, priorityPatches...)
+
+	applyHealthCheck(pod, &sidecarContainer, healthCheckPort)
+	if healthScript != nil {
+		applyHealthCheckScript(pod, &sidecarContainer, healthScript)
+	}
+	if configVolume != nil {
+		applyConfigReloader(&sidecarContainer)
+	}
+	if serveConfig != "" {
+		applyServeConfig(&sidecarContainer)
+	}
+	if serveCertSecret != "" {
+		applyServeCert(&sidecarContainer)
+	}
+	if egress != nil {
+		applyEgressTarget(&sidecarContainer, egress)
+	}
+	if metricsPort != 0 {
+		applyMetrics(&sidecarContainer, metricsPort)
+	}
+	if paused {
+		applyPaused(&sidecarContainer)
+	}
+
+	sidecarContainer.Env = append(sidecarContainer.Env, sidecarEnv...)
+	sortEnv(sidecarContainer.Env)
+
+	// Annotations recording how the pod was injected
+	records := map[string]string{
+		annotationWebhookVersion: version,
+	}
+	if !paused {
+		records[annotationAuthKeySecretUsed] = authSourceName(authKeyEnv)
+	}
+	for key, value := range stateSecretAnnotations(pod, stateSecretName) {
+		records[key] = value
+	}
+	for key, value := range nodeAttrsAnnotation(nodeAttrs) {
+		records[key] = value
+	}
+	podAnnotations := map[string]string{}
+	if err := addRecordAnnotations(pod, podAnnotations, records); err != nil {
+		return nil, nil, err
+	}
+	for key, value := range meshAnnotations {
+		podAnnotations[key] = value
+	}
+	if serveConfig != "" {
+		podAnnotations[annotationServeConfig] = serveConfig
+	}
+	if metricsPort != 0 {
+		for key, value := range metricsAnnotations(metricsPort) {
+			if _, ok := pod.Annotations[key]; ok {
+				log.Printf("Pod %s/%s already sets %s, not adding the metrics scrape annotation", pod.Namespace, pod.Name, key)
+				continue
+			}
+			podAnnotations[key] = value
+		}
+	}
+
+	patches = append(patches, addVolumesPatch(pod, extraVolumes)...)
+
 	// Add sidecar container
-	patches = append(patches, patchOperation{
-		Op:    "add",
-		Path:  "/spec/containers/-",
-		Value: sidecarContainer,
-	})
+	if nativeSidecarEnabled() {
+		applyNativeSidecar(&sidecarContainer)
+		// A paused sidecar has no auth key and never connects, waiting
+		// would only get it restarted and block the app containers
+		if !paused {
+			applyWaitConnected(&sidecarContainer, waitConnected)
+		}
+		if containerValidationEnabled() {
+			if err := validateSidecarContainer(pod, sidecarContainer, extraVolumes, field.NewPath("spec", "initContainers").Index(0)); err != nil {
+				return nil, nil, err
+			}
+		}
+		patches = append(patches, addNativeSidecarPatch(pod, sidecarContainer))
+	} else {
+		applyShutdownDelay(&sidecarContainer, shutdownDelay)
+		if containerValidationEnabled() {
+			if err := validateSidecarContainer(pod, sidecarContainer, extraVolumes, field.NewPath("spec", "containers").Index(len(pod.Spec.Containers))); err != nil {
+				return nil, nil, err
+			}
+		}
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  "/spec/containers/-",
+			Value: sidecarContainer,
+		})
+	}
+
+	// A companion signaling tailscaled needs a shared process namespace
+	if reloader != nil {
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  "/spec/containers/-",
+			Value: *reloader,
+		})
+		if configReloaderSharesProcesses() && (pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace) {
+			patches = append(patches, patchOperation{
+				Op:    "add",
+				Path:  "/spec/shareProcessNamespace",
+				Value: true,
+			})
+		}
+	}
+
+	patches = append(patches, addReadinessGatePatch(pod, readinessGate)...)
+	patches = append(patches, addNodeRequirementPatch(pod, imagePresent)...)
+	patches = append(patches, addDNSResolversPatch(pod, dnsResolvers)...)
+	admitted := admittedPod(ctx, pod)
+	patches = append(patches, addMapEntriesPatch("/metadata/annotations", admitted.Annotations, podAnnotations)...)
+	podLabels := inheritedNamespaceLabels(ctx, pod)
+	if netpolKey != "" && pod.Labels[netpolKey] != netpolValue {
+		if podLabels == nil {
+			podLabels = map[string]string{}
+		}
+		podLabels[netpolKey] = netpolValue
+	}
+	patches = append(patches, addMapEntriesPatch("/metadata/labels", pod.Labels, podLabels)...)
+
+	if verifyPatchEnabled() {
+		if err := verifyPatchedPod(admitted, patches); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return patches, warnings, nil
+}
 
-	return patches
+func sendAdmissionResponse(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview, patch []byte, allowed bool, message string, causes []metav1.StatusCause, warnings []string, patchType ...*admissionv1.PatchType) {
+	writeAdmissionResponse(w, admissionReview, newAdmissionResponse(admissionReview, patch, allowed, message, causes, warnings, patchType...))
 }
 
-func sendAdmissionResponse(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview, patch []byte, allowed bool, message string, patchType ...*admissionv1.PatchType) {
+func newAdmissionResponse(admissionReview *admissionv1.AdmissionReview, patch []byte, allowed bool, message string, causes []metav1.StatusCause, warnings []string, patchType ...*admissionv1.PatchType) *admissionv1.AdmissionResponse {
 	response := &admissionv1.AdmissionResponse{
 		UID:     admissionReview.Request.UID,
 		Allowed: allowed,
@@ -284,6 +1282,16 @@ func sendAdmissionResponse(w http.ResponseWriter, admissionReview *admissionv1.A
 		},
 	}
 
+	response.Warnings = warnings
+
+	// Field level causes let clients see exactly which annotation was rejected
+	if len(causes) > 0 {
+		response.Result.Reason = metav1.StatusReasonInvalid
+		response.Result.Details = &metav1.StatusDetails{
+			Causes: causes,
+		}
+	}
+
 	if len(patch) > 0 {
 		response.Patch = patch
 		if len(patchType) > 0 && patchType[0] != nil {
@@ -293,7 +1301,11 @@ func sendAdmissionResponse(w http.ResponseWriter, admissionReview *admissionv1.A
 			response.PatchType = &pt
 		}
 	}
+	return response
+}
 
+// writeAdmissionResponse sends response as the answer to admissionReview.
+func writeAdmissionResponse(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview, response *admissionv1.AdmissionResponse) {
 	admissionReview.Response = response
 	admissionReview.Request = nil
 
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// containerEnv returns the value of the env var name in container.
+func containerEnv(container corev1.Container, name string) (string, bool) {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return env.Value, true
+		}
+	}
+	return "", false
+}
+
+func TestGetFirewallMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         string
+		hostEnv     string
+		hostNetwork bool
+		annotation  *string
+		want        string
+		wantErr     bool
+	}{
+		{name: "default", want: "auto"},
+		{name: "env", env: "nftables", want: "nftables"},
+		{name: "host network env", env: "nftables", hostEnv: "off", hostNetwork: true, want: "off"},
+		{name: "host network env ignored for pod network", env: "nftables", hostEnv: "off", want: "nftables"},
+		{name: "host network falls back to env", env: "iptables", hostNetwork: true, want: "iptables"},
+		{name: "annotation wins", env: "nftables", hostEnv: "off", hostNetwork: true, annotation: stringPtr(" IPTables "), want: "iptables"},
+		{name: "invalid annotation", annotation: stringPtr("ufw"), wantErr: true},
+		{name: "invalid env", env: "ufw", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_FIREWALL_MODE", tt.env)
+			t.Setenv("TS_HOST_NETWORK_FIREWALL_MODE", tt.hostEnv)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}},
+				Spec:       corev1.PodSpec{HostNetwork: tt.hostNetwork},
+			}
+			if tt.annotation != nil {
+				pod.Annotations[annotationFirewallMode] = *tt.annotation
+			}
+			got, err := getFirewallMode(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getFirewallMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getFirewallMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirewallModeSidecarEnv(t *testing.T) {
+	tests := []struct {
+		mode          string
+		wantDebugMode string
+		wantOff       bool
+	}{
+		{mode: "auto", wantDebugMode: "auto"},
+		{mode: "nftables", wantDebugMode: "nftables"},
+		{mode: "off", wantOff: true},
+		{mode: "none", wantOff: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			pod := testInjectedPod()
+			pod.Annotations[annotationFirewallMode] = tt.mode
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("generateSidecarPatch() error = %v", err)
+			}
+			sidecar, ok := sidecarFromPatch(patches)
+			if !ok {
+				t.Fatal("generateSidecarPatch() added no sidecar")
+			}
+			debugMode, _ := containerEnv(sidecar, "TS_DEBUG_FIREWALL_MODE")
+			if debugMode != tt.wantDebugMode {
+				t.Errorf("TS_DEBUG_FIREWALL_MODE = %q, want %q", debugMode, tt.wantDebugMode)
+			}
+			extraArgs, _ := containerEnv(sidecar, "TS_EXTRA_ARGS")
+			if got := strings.Contains(extraArgs, "--netfilter-mode=off"); got != tt.wantOff {
+				t.Errorf("TS_EXTRA_ARGS = %q, want --netfilter-mode=off %v", extraArgs, tt.wantOff)
+			}
+		})
+	}
+}
+
+func TestReadPodReviewEmptyObject(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		wantAllowed bool
+	}{
+		{name: "default", wantAllowed: true},
+		{name: "allow", policy: "allow", wantAllowed: true},
+		{name: "deny", policy: "deny"},
+	}
+	for _, tt := range tests {
+		for handlerName, handler := range map[string]http.HandlerFunc{"mutate": mutateHandler, "validate": validateHandler} {
+			t.Run(tt.name+" "+handlerName, func(t *testing.T) {
+				t.Setenv("EMPTY_OBJECT_POLICY", tt.policy)
+				body, err := json.Marshal(admissionv1.AdmissionReview{
+					TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+					Request:  &admissionv1.AdmissionRequest{UID: types.UID("test"), Namespace: "prod", Operation: admissionv1.Create},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				w := httptest.NewRecorder()
+				handler(w, httptest.NewRequest(http.MethodPost, "/"+handlerName, bytes.NewReader(body)))
+				var review admissionv1.AdmissionReview
+				if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil || review.Response == nil {
+					t.Fatalf("status %d, body %s: %v", w.Code, w.Body, err)
+				}
+				if review.Response.Allowed != tt.wantAllowed {
+					t.Errorf("response allowed = %v, want %v", review.Response.Allowed, tt.wantAllowed)
+				}
+				if review.Response.Patch != nil {
+					t.Errorf("response patch = %s, want none", review.Response.Patch)
+				}
+			})
+		}
+	}
+}
+
+func TestGetSidecarImage(t *testing.T) {
+	const fallback, mirror = "fallback.example.com/tailscale:stable", "mirror.example.com/tailscale:stable"
+	tests := []struct {
+		name         string
+		image        string
+		mirror       string
+		fallback     string
+		podFallback  bool
+		profileImage string
+		want         string
+	}{
+		{name: "default", want: "ghcr.io/tailscale/tailscale:latest"},
+		{name: "TS_IMAGE", image: "tailscale/tailscale:v1.70", want: "tailscale/tailscale:v1.70"},
+		{name: "profile", image: "tailscale/tailscale:v1.70", profileImage: "tailscale/tailscale:v1.72", want: "tailscale/tailscale:v1.72"},
+		{name: "mirror", image: "tailscale/tailscale:v1.70", mirror: mirror, profileImage: "tailscale/tailscale:v1.72", want: mirror},
+		{name: "fallback not requested", mirror: mirror, fallback: fallback, want: mirror},
+		{name: "fallback requested", mirror: mirror, fallback: fallback, podFallback: true, want: fallback},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_IMAGE", tt.image)
+			t.Setenv("TS_IMAGE_MIRROR", tt.mirror)
+			t.Setenv("TS_IMAGE_FALLBACK", tt.fallback)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tt.podFallback {
+				pod.Annotations[annotationImageFallback] = "true"
+			}
+			if got := getSidecarImage(pod, &sidecarProfile{Image: tt.profileImage}); got != tt.want {
+				t.Errorf("getSidecarImage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageWarning(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    string
+		mirror   string
+		fallback string
+		want     string
+	}{
+		{name: "primary image", image: "ghcr.io/tailscale/tailscale:latest", mirror: "mirror.example.com/tailscale"},
+		{name: "mirror", image: "mirror.example.com/tailscale", mirror: "mirror.example.com/tailscale", want: "TS_IMAGE_MIRROR"},
+		{name: "fallback", image: "fallback.example.com/tailscale", mirror: "mirror.example.com/tailscale", fallback: "fallback.example.com/tailscale", want: "TS_IMAGE_FALLBACK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_IMAGE_MIRROR", tt.mirror)
+			t.Setenv("TS_IMAGE_FALLBACK", tt.fallback)
+			got := imageWarning(tt.image)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("imageWarning(%q) = %q, want none", tt.image, got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) || !strings.Contains(got, tt.image) {
+				t.Errorf("imageWarning(%q) = %q, want a warning naming %s", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetImagePullPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    corev1.PullPolicy
+		wantErr bool
+	}{
+		{value: "", want: corev1.PullAlways},
+		{value: "Always", want: corev1.PullAlways},
+		{value: "IfNotPresent", want: corev1.PullIfNotPresent},
+		{value: "Never", want: corev1.PullNever},
+		{value: "always", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TS_IMAGE_PULL_POLICY", tt.value)
+			got, err := getImagePullPolicy()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getImagePullPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getImagePullPolicy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSidecarImageMirror(t *testing.T) {
+	t.Setenv("TS_IMAGE_MIRROR", "mirror.example.com/tailscale:stable")
+	t.Setenv("TS_IMAGE_PULL_POLICY", "IfNotPresent")
+	patches, warnings, err := generateSidecarPatch(context.Background(), testInjectedPod())
+	if err != nil {
+		t.Fatalf("generateSidecarPatch() error = %v", err)
+	}
+	sidecar, _ := sidecarFromPatch(patches)
+	if sidecar.Image != "mirror.example.com/tailscale:stable" || sidecar.ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("sidecar image = %s (%s), want the mirror with IfNotPresent", sidecar.Image, sidecar.ImagePullPolicy)
+	}
+	found := false
+	for _, warning := range warnings {
+		found = found || strings.Contains(warning, "TS_IMAGE_MIRROR")
+	}
+	if !found {
+		t.Errorf("generateSidecarPatch() warnings = %q, want the mirror warning", warnings)
+	}
+}
+
+func TestGetHandlers(t *testing.T) {
+	tests := []struct {
+		name         string
+		mutate       string
+		validate     string
+		wantMutate   string
+		wantValidate string
+		wantErr      bool
+	}{
+		{name: "defaults", wantMutate: "/mutate", wantValidate: "/validate"},
+		{name: "custom", mutate: "/v1/mutate", validate: "/v1/validate", wantMutate: "/v1/mutate", wantValidate: "/v1/validate"},
+		{name: "same paths", mutate: "/admit", validate: "/admit", wantErr: true},
+		{name: "trailing slash", mutate: "/admit/", validate: "/admit", wantErr: true},
+		{name: "shadows health", validate: "/health", wantErr: true},
+		{name: "relative mutate path", mutate: "mutate", wantErr: true},
+		{name: "relative validate path", validate: "validate", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MUTATE_PATH", tt.mutate)
+			t.Setenv("VALIDATE_PATH", tt.validate)
+			handlers, err := getHandlers()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getHandlers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if handlers[0].path != tt.wantMutate || handlers[1].path != tt.wantValidate {
+				t.Errorf("getHandlers() paths = %s, %s, want %s, %s", handlers[0].path, handlers[1].path, tt.wantMutate, tt.wantValidate)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Service meshes detected on pods.
+const (
+	meshIstio   = "istio"
+	meshLinkerd = "linkerd"
+)
+
+// Behaviors for pods with a service mesh sidecar (MESH_POLICY).
+const (
+	meshPolicyAdjust = "adjust"
+	meshPolicyDeny   = "deny"
+	meshPolicyIgnore = "ignore"
+)
+
+// tailnetRanges are the Tailscale address ranges. The mesh proxy must not
+// capture traffic to them, or it would never reach tailscaled.
+var tailnetRanges = []string{"100.64.0.0/10", "fd7a:115c:a1e0::/48"}
+
+const istioExcludeOutboundAnnotation = "traffic.sidecar.istio.io/excludeOutboundIPRanges"
+
+// detectMesh returns the service mesh whose sidecar the pod already has or
+// requests, or "" for none. Only meshes injected before this webhook, or
+// requested through pod labels and annotations, are visible.
+func detectMesh(pod *corev1.Pod) string {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			switch container.Name {
+			case "istio-proxy":
+				return meshIstio
+			case "linkerd-proxy":
+				return meshLinkerd
+			}
+		}
+	}
+	if _, ok := pod.Annotations["sidecar.istio.io/status"]; ok {
+		return meshIstio
+	}
+	if pod.Labels["sidecar.istio.io/inject"] == "true" || pod.Annotations["sidecar.istio.io/inject"] == "true" {
+		return meshIstio
+	}
+	if pod.Annotations["linkerd.io/inject"] == "enabled" {
+		return meshLinkerd
+	}
+	return ""
+}
+
+func getMeshPolicy() (string, error) {
+	policy := getEnv("MESH_POLICY", meshPolicyAdjust)
+	switch policy {
+	case meshPolicyAdjust, meshPolicyDeny, meshPolicyIgnore:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid MESH_POLICY %q: must be %s, %s, or %s", policy, meshPolicyAdjust, meshPolicyDeny, meshPolicyIgnore)
+}
+
+// getMeshAdjustments returns pod annotations that keep a service mesh from
+// intercepting tailnet traffic, and warnings for meshes that cannot be
+// adjusted. With MESH_POLICY=deny, pods with a mesh are denied instead.
+func getMeshAdjustments(pod *corev1.Pod) (map[string]string, []string, error) {
+	mesh := detectMesh(pod)
+	if mesh == "" {
+		return nil, nil, nil
+	}
+	policy, err := getMeshPolicy()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch policy {
+	case meshPolicyIgnore:
+		return nil, nil, nil
+	case meshPolicyDeny:
+		return nil, nil, fmt.Errorf("pod uses the %s service mesh, which may intercept tailnet traffic: remove the mesh sidecar or ask an administrator to allow meshes with MESH_POLICY", mesh)
+	}
+
+	if mesh != meshIstio {
+		log.Printf("Warning: pod %s/%s uses the %s service mesh, which is not adjusted", pod.Namespace, pod.Name, mesh)
+		return nil, []string{fmt.Sprintf("the %s service mesh may intercept tailnet traffic, exclude %s from its proxy", mesh, strings.Join(tailnetRanges, ", "))}, nil
+	}
+
+	log.Printf("Pod %s/%s uses the %s service mesh, excluding tailnet ranges from its proxy", pod.Namespace, pod.Name, mesh)
+	ranges := tailnetRanges
+	if existing := pod.Annotations[istioExcludeOutboundAnnotation]; existing != "" {
+		ranges = append([]string{existing}, missingRanges(existing)...)
+	}
+	return map[string]string{istioExcludeOutboundAnnotation: strings.Join(ranges, ",")}, nil, nil
+}
+
+// missingRanges returns the tailnet ranges not in the comma separated list.
+func missingRanges(list string) []string {
+	present := map[string]bool{}
+	for _, entry := range strings.Split(list, ",") {
+		present[strings.TrimSpace(entry)] = true
+	}
+	var missing []string
+	for _, cidr := range tailnetRanges {
+		if !present[cidr] {
+			missing = append(missing, cidr)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDetectMesh(t *testing.T) {
+	tests := []struct {
+		name        string
+		containers  []corev1.Container
+		labels      map[string]string
+		annotations map[string]string
+		want        string
+	}{
+		{name: "none", containers: []corev1.Container{{Name: "app"}}},
+		{name: "istio proxy", containers: []corev1.Container{{Name: "app"}, {Name: "istio-proxy"}}, want: meshIstio},
+		{name: "linkerd proxy", containers: []corev1.Container{{Name: "linkerd-proxy"}}, want: meshLinkerd},
+		{name: "istio status", annotations: map[string]string{"sidecar.istio.io/status": "{}"}, want: meshIstio},
+		{name: "istio label", labels: map[string]string{"sidecar.istio.io/inject": "true"}, want: meshIstio},
+		{name: "istio disabled", labels: map[string]string{"sidecar.istio.io/inject": "false"}},
+		{name: "linkerd annotation", annotations: map[string]string{"linkerd.io/inject": "enabled"}, want: meshLinkerd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Labels: tt.labels, Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: tt.containers},
+			}
+			if got := detectMesh(pod); got != tt.want {
+				t.Errorf("detectMesh() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMeshAdjustments(t *testing.T) {
+	istio := map[string]string{"sidecar.istio.io/status": "{}"}
+	tests := []struct {
+		name         string
+		policy       string
+		annotations  map[string]string
+		want         map[string]string
+		wantWarnings int
+		wantErr      bool
+	}{
+		{name: "no mesh"},
+		{name: "istio", annotations: istio, want: map[string]string{istioExcludeOutboundAnnotation: "100.64.0.0/10,fd7a:115c:a1e0::/48"}},
+		{
+			name:        "istio existing ranges",
+			annotations: map[string]string{"sidecar.istio.io/status": "{}", istioExcludeOutboundAnnotation: "10.0.0.0/8, 100.64.0.0/10"},
+			want:        map[string]string{istioExcludeOutboundAnnotation: "10.0.0.0/8, 100.64.0.0/10,fd7a:115c:a1e0::/48"},
+		},
+		{name: "linkerd warns", annotations: map[string]string{"linkerd.io/inject": "enabled"}, wantWarnings: 1},
+		{name: "ignore", policy: meshPolicyIgnore, annotations: istio},
+		{name: "deny", policy: meshPolicyDeny, annotations: istio, wantErr: true},
+		{name: "deny without mesh", policy: meshPolicyDeny},
+		{name: "invalid policy", policy: "allow", annotations: istio, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MESH_POLICY", tt.policy)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, warnings, err := getMeshAdjustments(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMeshAdjustments() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getMeshAdjustments() = %v, want %v", got, tt.want)
+			}
+			if len(warnings) != tt.wantWarnings {
+				t.Errorf("getMeshAdjustments() warnings = %q, want %d", warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	annotationMetrics = "tailscale.com/metrics"
+	metricsPortName   = "metrics"
+	metricsPath       = "/metrics"
+)
+
+// getMetricsPort returns the port tailscaled serves metrics on when the pod
+// sets tailscale.com/metrics=true, or 0 otherwise.
+func getMetricsPort(pod *corev1.Pod) (int32, error) {
+	value, ok := pod.Annotations[annotationMetrics]
+	if !ok {
+		return 0, nil
+	}
+	enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return 0, field.Invalid(annotationPath(annotationMetrics), value, "must be true or false")
+	}
+	if !enabled {
+		return 0, nil
+	}
+	port, err := parsePort(getEnv("TS_METRICS_PORT", "9002"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid TS_METRICS_PORT: %v", err)
+	}
+	return int32(port), nil
+}
+
+// applyMetrics makes tailscaled serve metrics on port and exposes it as the
+// sidecar's metrics container port.
+func applyMetrics(container *corev1.Container, port int32) {
+	setEnvVar(container, "TS_ENABLE_METRICS", "true")
+	setEnvVar(container, "TS_LOCAL_ADDR_PORT", fmt.Sprintf("[::]:%d", port))
+	container.Ports = setContainerPort(container.Ports, corev1.ContainerPort{
+		Name:          metricsPortName,
+		ContainerPort: port,
+		Protocol:      corev1.ProtocolTCP,
+	})
+}
+
+// metricsAnnotations returns the scrape annotations for port, using the
+// METRICS_ANNOTATION_PREFIX (default: prometheus.io) keys.
+func metricsAnnotations(port int32) map[string]string {
+	prefix := getEnv("METRICS_ANNOTATION_PREFIX", "prometheus.io")
+	return map[string]string{
+		prefix + "/scrape": "true",
+		prefix + "/port":   strconv.Itoa(int(port)),
+		prefix + "/path":   metricsPath,
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetMetricsPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		unset   bool
+		port    string
+		want    int32
+		wantErr bool
+	}{
+		{name: "unset", unset: true},
+		{name: "disabled", value: "false"},
+		{name: "default port", value: "true", want: 9002},
+		{name: "custom port", value: "true", port: "9100", want: 9100},
+		{name: "invalid port", value: "true", port: "0", wantErr: true},
+		{name: "invalid value", value: "on", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_METRICS_PORT", tt.port)
+			pod := &corev1.Pod{}
+			if !tt.unset {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{annotationMetrics: tt.value}}
+			}
+			got, err := getMetricsPort(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getMetricsPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getMetricsPort() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyMetrics(t *testing.T) {
+	container := &corev1.Container{}
+	applyMetrics(container, 9100)
+	want := []corev1.EnvVar{{Name: "TS_ENABLE_METRICS", Value: "true"}, {Name: "TS_LOCAL_ADDR_PORT", Value: "[::]:9100"}}
+	if !reflect.DeepEqual(container.Env, want) {
+		t.Errorf("applyMetrics() env = %v, want %v", container.Env, want)
+	}
+	if len(container.Ports) != 1 || container.Ports[0].Name != metricsPortName || container.Ports[0].ContainerPort != 9100 {
+		t.Errorf("applyMetrics() ports = %v", container.Ports)
+	}
+}
+
+func TestMetricsAnnotations(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   map[string]string
+	}{
+		{want: map[string]string{"prometheus.io/scrape": "true", "prometheus.io/port": "9002", "prometheus.io/path": "/metrics"}},
+		{prefix: "metrics.example.com", want: map[string]string{"metrics.example.com/scrape": "true", "metrics.example.com/port": "9002", "metrics.example.com/path": "/metrics"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("METRICS_ANNOTATION_PREFIX", tt.prefix)
+		if got := metricsAnnotations(9002); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("metricsAnnotations() = %v, want %v", got, tt.want)
+		}
+	}
+}
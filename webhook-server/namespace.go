@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// kubeClient is used for lookups the admission request does not carry. It is
+// nil when the webhook is not running in a cluster, in which case those
+// checks are skipped.
+var kubeClient kubernetes.Interface
+
+// namespaces caches namespace reads for the lifetime of an admission burst.
+var namespaces *namespaceCache
+
+func initKubeClient() {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Printf("Not running in cluster, Kubernetes API lookups disabled: %v", err)
+		return
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Printf("Error creating Kubernetes client, API lookups disabled: %v", err)
+		return
+	}
+	kubeClient = client
+}
+
+func initNamespaceCache() {
+	ttl, err := time.ParseDuration(getEnv("NAMESPACE_CACHE_TTL", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid NAMESPACE_CACHE_TTL: %v", err)
+	}
+	if kubeClient != nil {
+		namespaces = newNamespaceCache(kubeClient, ttl)
+	}
+}
+
+type namespaceCacheEntry struct {
+	namespace *corev1.Namespace
+	expires   time.Time
+}
+
+// namespaceCache is a small TTL cache in front of namespace GETs.
+type namespaceCache struct {
+	client kubernetes.Interface
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]namespaceCacheEntry
+}
+
+func newNamespaceCache(client kubernetes.Interface, ttl time.Duration) *namespaceCache {
+	return &namespaceCache{
+		client:  client,
+		ttl:     ttl,
+		entries: map[string]namespaceCacheEntry{},
+	}
+}
+
+func (c *namespaceCache) get(ctx context.Context, name string) (*corev1.Namespace, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.namespace, nil
+	}
+
+	namespace, err := c.client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = namespaceCacheEntry{namespace: namespace, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return namespace, nil
+}
+
+// isNamespaceTerminating reports whether the namespace is being deleted.
+// Lookup failures are logged and treated as not terminating so that an API
+// hiccup never blocks injection.
+func isNamespaceTerminating(ctx context.Context, name string) bool {
+	if namespaces == nil || getEnv("SKIP_TERMINATING_NAMESPACES", "true") != "true" {
+		return false
+	}
+	namespace, err := namespaces.get(ctx, name)
+	if err != nil {
+		log.Printf("Error looking up namespace %s: %v", name, err)
+		return false
+	}
+	return namespace.DeletionTimestamp != nil || namespace.Status.Phase == corev1.NamespaceTerminating
+}
+
+// namespaceInjectsByDefault reports whether the namespace opts in to
+// injecting every pod with the tailscale.com/inject-default=true label or
+// annotation, or the tailscale.com/inject=true label. Lookup failures are
+// logged and treated as not opted in.
+func namespaceInjectsByDefault(ctx context.Context, name string) bool {
+	if namespaces == nil {
+		return false
+	}
+	namespace, err := namespaces.get(ctx, name)
+	if err != nil {
+		log.Printf("Error looking up namespace %s: %v", name, err)
+		return false
+	}
+	if strings.EqualFold(strings.TrimSpace(namespace.Labels[injectLabel]), "true") {
+		return true
+	}
+	for _, values := range []map[string]string{namespace.Labels, namespace.Annotations} {
+		if strings.EqualFold(strings.TrimSpace(values[namespaceInjectDefault]), "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// getNamespaceLabelKeys returns the comma separated TS_NAMESPACE_LABELS, the
+// namespace labels copied onto injected pods, e.g. for cost allocation.
+func getNamespaceLabelKeys() ([]string, error) {
+	var keys []string
+	for _, key := range strings.Split(getEnv("TS_NAMESPACE_LABELS", ""), ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid TS_NAMESPACE_LABELS entry %q: %s", key, strings.Join(errs, "; "))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// inheritedNamespaceLabels returns the TS_NAMESPACE_LABELS labels of the
+// pod's namespace that the pod does not set itself. Lookup failures are
+// logged and yield no labels, so that an API hiccup never blocks injection.
+func inheritedNamespaceLabels(ctx context.Context, pod *corev1.Pod) map[string]string {
+	keys, err := getNamespaceLabelKeys()
+	if err != nil || len(keys) == 0 || namespaces == nil {
+		return nil
+	}
+	namespace, err := namespaces.get(ctx, pod.Namespace)
+	if err != nil {
+		log.Printf("Error looking up namespace %s, not copying its labels: %v", pod.Namespace, err)
+		return nil
+	}
+	labels := map[string]string{}
+	for _, key := range keys {
+		value, ok := namespace.Labels[key]
+		if _, set := pod.Labels[key]; !ok || set {
+			continue
+		}
+		labels[key] = value
+	}
+	return labels
+}
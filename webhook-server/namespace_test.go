@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// useTestNamespaces serves namespace lookups from a fake client holding
+// objects for the duration of the test.
+func useTestNamespaces(t *testing.T, objects ...*corev1.Namespace) {
+	t.Helper()
+	client := fake.NewSimpleClientset()
+	for _, namespace := range objects {
+		if _, err := client.CoreV1().Namespaces().Create(context.Background(), namespace, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := namespaces
+	namespaces = newNamespaceCache(client, time.Minute)
+	t.Cleanup(func() { namespaces = old })
+}
+
+func TestIsNamespaceTerminating(t *testing.T) {
+	now := metav1.Now()
+	useTestNamespaces(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "active"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "deleting", DeletionTimestamp: &now, Finalizers: []string{"kubernetes"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "terminating"}, Status: corev1.NamespaceStatus{Phase: corev1.NamespaceTerminating}},
+	)
+	tests := []struct {
+		name      string
+		namespace string
+		disable   bool
+		want      bool
+	}{
+		{name: "active", namespace: "active"},
+		{name: "deletion timestamp", namespace: "deleting", want: true},
+		{name: "terminating phase", namespace: "terminating", want: true},
+		{name: "lookup failure", namespace: "missing"},
+		{name: "disabled", namespace: "terminating", disable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.disable {
+				t.Setenv("SKIP_TERMINATING_NAMESPACES", "false")
+			}
+			if got := isNamespaceTerminating(context.Background(), tt.namespace); got != tt.want {
+				t.Errorf("isNamespaceTerminating(%q) = %v, want %v", tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamespaceCache(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod"}})
+	gets := func() int {
+		n := 0
+		for _, action := range client.Actions() {
+			if action.GetVerb() == "get" {
+				n++
+			}
+		}
+		return n
+	}
+
+	cache := newNamespaceCache(client, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := cache.get(context.Background(), "prod"); err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+	}
+	if n := gets(); n != 1 {
+		t.Errorf("cached lookups made %d API calls, want 1", n)
+	}
+	if _, err := cache.get(context.Background(), "missing"); err == nil {
+		t.Error("get() of a missing namespace succeeded")
+	}
+
+	expired := newNamespaceCache(client, 0)
+	before := gets()
+	for i := 0; i < 2; i++ {
+		if _, err := expired.get(context.Background(), "prod"); err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+	}
+	if n := gets() - before; n != 2 {
+		t.Errorf("lookups without a TTL made %d API calls, want 2", n)
+	}
+}
+
+func TestNamespaceInjectsByDefault(t *testing.T) {
+	useTestNamespaces(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "plain"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "labeled", Labels: map[string]string{namespaceInjectDefault: "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "annotated", Annotations: map[string]string{namespaceInjectDefault: " True "}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "off", Labels: map[string]string{namespaceInjectDefault: "false"}}},
+	)
+	tests := []struct {
+		namespace string
+		want      bool
+	}{
+		{namespace: "plain"},
+		{namespace: "labeled", want: true},
+		{namespace: "annotated", want: true},
+		{namespace: "off"},
+		{namespace: "missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			if got := namespaceInjectsByDefault(context.Background(), tt.namespace); got != tt.want {
+				t.Errorf("namespaceInjectsByDefault(%q) = %v, want %v", tt.namespace, got, tt.want)
+			}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace}}
+			if got := requestsInjection(context.Background(), pod); got != tt.want {
+				t.Errorf("requestsInjection() in %q = %v, want %v", tt.namespace, got, tt.want)
+			}
+			pod.Labels = map[string]string{injectLabel: "false"}
+			if requestsInjection(context.Background(), pod) {
+				t.Errorf("requestsInjection() of an opted out pod in %q = true", tt.namespace)
+			}
+		})
+	}
+}
+
+func TestNamespaceInjectLabel(t *testing.T) {
+	useTestNamespaces(t,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "injected", Labels: map[string]string{injectLabel: "TRUE"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "annotated", Annotations: map[string]string{injectLabel: "true"}}},
+	)
+	tests := []struct {
+		namespace string
+		want      bool
+	}{
+		{namespace: "injected", want: true},
+		// Only the namespace label is honoured, not an annotation.
+		{namespace: "annotated"},
+	}
+	for _, tt := range tests {
+		if got := namespaceInjectsByDefault(context.Background(), tt.namespace); got != tt.want {
+			t.Errorf("namespaceInjectsByDefault(%q) = %v, want %v", tt.namespace, got, tt.want)
+		}
+	}
+}
+
+func TestInheritedNamespaceLabels(t *testing.T) {
+	useTestNamespaces(t, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "prod",
+		Labels: map[string]string{"team": "payments", "cost-center": "cc-42", "env": "prod"},
+	}})
+	tests := []struct {
+		name      string
+		keys      string
+		namespace string
+		podLabels map[string]string
+		want      map[string]string
+		wantErr   bool
+	}{
+		{name: "unset", namespace: "prod"},
+		{name: "copied", keys: "team, cost-center", namespace: "prod", want: map[string]string{"team": "payments", "cost-center": "cc-42"}},
+		{name: "pod label wins", keys: "team,env", namespace: "prod", podLabels: map[string]string{"team": "billing"}, want: map[string]string{"env": "prod"}},
+		{name: "missing on namespace", keys: "owner", namespace: "prod", want: map[string]string{}},
+		{name: "lookup failure", keys: "team", namespace: "missing"},
+		{name: "invalid key", keys: "team,-bad", namespace: "prod", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NAMESPACE_LABELS", tt.keys)
+			if _, err := getNamespaceLabelKeys(); (err != nil) != tt.wantErr {
+				t.Fatalf("getNamespaceLabelKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Labels: tt.podLabels}}
+			if got := inheritedNamespaceLabels(context.Background(), pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inheritedNamespaceLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
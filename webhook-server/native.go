@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// waitConnectedCommand polls tailscale status until tailscaled reports it is
+// connected, failing after the given number of seconds. containerboot puts
+// the tailscaled socket in /tmp unless TS_SOCKET says otherwise.
+const waitConnectedCommand = `i=0; until tailscale --socket="${TS_SOCKET:-/tmp/tailscaled.sock}" status >/dev/null 2>&1; do i=$((i+1)); if [ "$i" -ge %d ]; then echo "tailscale not connected after %ds" >&2; exit 1; fi; sleep 1; done`
+
+// nativeSidecarEnabled reports whether TS_NATIVE_SIDECAR is set, injecting
+// the sidecar as an init container with restartPolicy Always (Kubernetes
+// 1.29+).
+func nativeSidecarEnabled() bool {
+	return getEnv("TS_NATIVE_SIDECAR", "false") == "true"
+}
+
+// applyNativeSidecar turns the sidecar into a native sidecar. Init containers
+// after it only start once its startup probe succeeds, so with a health
+// check port they wait until tailscaled is up instead of merely started.
+func applyNativeSidecar(container *corev1.Container) {
+	always := corev1.ContainerRestartPolicyAlways
+	container.RestartPolicy = &always
+	if container.ReadinessProbe != nil {
+		container.StartupProbe = &corev1.Probe{
+			ProbeHandler:     container.ReadinessProbe.ProbeHandler,
+			PeriodSeconds:    1,
+			FailureThreshold: 60,
+		}
+	}
+}
+
+// getWaitConnected returns TS_WAIT_CONNECTED, how long the native sidecar's
+// postStart hook waits for tailscaled to connect, or 0 when disabled.
+func getWaitConnected() (time.Duration, error) {
+	value := getEnv("TS_WAIT_CONNECTED", "0")
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid TS_WAIT_CONNECTED %q: must be a non-negative duration", value)
+	}
+	return timeout, nil
+}
+
+// applyWaitConnected adds a postStart hook blocking until tailscaled is
+// connected. The kubelet only starts the next container once a native
+// sidecar's postStart hook completes, so app containers find the tailnet
+// reachable. The sidecar is restarted if it does not connect within timeout.
+func applyWaitConnected(container *corev1.Container, timeout time.Duration) {
+	seconds := int(timeout.Round(time.Second) / time.Second)
+	if seconds == 0 {
+		return
+	}
+	if container.Lifecycle == nil {
+		container.Lifecycle = &corev1.Lifecycle{}
+	}
+	container.Lifecycle.PostStart = &corev1.LifecycleHandler{
+		Exec: &corev1.ExecAction{Command: []string{"sh", "-c", fmt.Sprintf(waitConnectedCommand, seconds, seconds)}},
+	}
+}
+
+// addNativeSidecarPatch inserts the sidecar as the first init container, so
+// every app init container runs after it and has tailnet access.
+func addNativeSidecarPatch(pod *corev1.Pod, container corev1.Container) patchOperation {
+	if len(pod.Spec.InitContainers) == 0 {
+		return patchOperation{
+			Op:    "add",
+			Path:  "/spec/initContainers",
+			Value: []corev1.Container{container},
+		}
+	}
+	return patchOperation{
+		Op:    "add",
+		Path:  "/spec/initContainers/0",
+		Value: container,
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyNativeSidecar(t *testing.T) {
+	readiness := &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"}}}
+	tests := []struct {
+		name        string
+		readiness   *corev1.Probe
+		wantStartup bool
+	}{
+		{name: "health check", readiness: readiness, wantStartup: true},
+		{name: "no health check"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := &corev1.Container{ReadinessProbe: tt.readiness}
+			applyNativeSidecar(container)
+			if container.RestartPolicy == nil || *container.RestartPolicy != corev1.ContainerRestartPolicyAlways {
+				t.Errorf("applyNativeSidecar() restartPolicy = %v, want Always", container.RestartPolicy)
+			}
+			if (container.StartupProbe != nil) != tt.wantStartup {
+				t.Fatalf("applyNativeSidecar() startupProbe = %v, want %v", container.StartupProbe, tt.wantStartup)
+			}
+			if tt.wantStartup && container.StartupProbe.HTTPGet.Path != "/healthz" {
+				t.Errorf("applyNativeSidecar() startupProbe = %v, want the readiness check", container.StartupProbe)
+			}
+		})
+	}
+}
+
+func TestAddNativeSidecarPatch(t *testing.T) {
+	sidecar := corev1.Container{Name: "ts-sidecar"}
+	tests := []struct {
+		name     string
+		init     []corev1.Container
+		wantPath string
+	}{
+		{name: "no init containers", wantPath: "/spec/initContainers"},
+		{name: "ahead of app init containers", init: []corev1.Container{{Name: "migrate"}}, wantPath: "/spec/initContainers/0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{InitContainers: tt.init}}
+			if got := addNativeSidecarPatch(pod, sidecar); got.Op != "add" || got.Path != tt.wantPath {
+				t.Errorf("addNativeSidecarPatch() = %s %s, want add %s", got.Op, got.Path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestWaitConnected(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantHook  bool
+		wantLimit string
+		wantErr   bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", value: "90s", wantHook: true, wantLimit: "-ge 90 ]"},
+		{name: "rounded", value: "1500ms", wantHook: true, wantLimit: "-ge 2 ]"},
+		{name: "below a second", value: "100ms"},
+		{name: "negative", value: "-1s", wantErr: true},
+		{name: "invalid", value: "forever", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_WAIT_CONNECTED", tt.value)
+			timeout, err := getWaitConnected()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getWaitConnected() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			container := &corev1.Container{}
+			applyWaitConnected(container, timeout)
+			if !tt.wantHook {
+				if container.Lifecycle != nil {
+					t.Errorf("applyWaitConnected() added %v, want no hook", container.Lifecycle)
+				}
+				return
+			}
+			if container.Lifecycle == nil || container.Lifecycle.PostStart == nil || container.Lifecycle.PostStart.Exec == nil {
+				t.Fatalf("applyWaitConnected() lifecycle = %v, want a postStart exec hook", container.Lifecycle)
+			}
+			if script := container.Lifecycle.PostStart.Exec.Command[2]; !strings.Contains(script, tt.wantLimit) {
+				t.Errorf("applyWaitConnected() script = %q, want %q", script, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestWaitConnectedPaused(t *testing.T) {
+	tests := []struct {
+		name     string
+		paused   string
+		wantHook bool
+	}{
+		{name: "running", paused: "false", wantHook: true},
+		{name: "paused", paused: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NATIVE_SIDECAR", "true")
+			t.Setenv("TS_WAIT_CONNECTED", "60s")
+			pod := testInjectedPod()
+			pod.Annotations[annotationPaused] = tt.paused
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("generateSidecarPatch() error = %v", err)
+			}
+			sidecar, ok := sidecarFromPatch(patches)
+			if !ok {
+				t.Fatal("generateSidecarPatch() added no sidecar")
+			}
+			hasHook := sidecar.Lifecycle != nil && sidecar.Lifecycle.PostStart != nil
+			if hasHook != tt.wantHook {
+				t.Errorf("sidecar postStart hook = %v, want %v", hasHook, tt.wantHook)
+			}
+		})
+	}
+}
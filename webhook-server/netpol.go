@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// getNetpolLabel returns the label from TS_NETPOL_LABEL, "key=value" or just
+// "key" for the value "true", that is added to injected pods so egress
+// NetworkPolicies granting tailnet access select them. It returns an empty
+// key when unset.
+func getNetpolLabel() (string, string, error) {
+	setting := strings.TrimSpace(getEnv("TS_NETPOL_LABEL", ""))
+	if setting == "" {
+		return "", "", nil
+	}
+	key, value, ok := strings.Cut(setting, "=")
+	if !ok {
+		value = "true"
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid TS_NETPOL_LABEL %q: %s", setting, strings.Join(errs, "; "))
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid TS_NETPOL_LABEL %q: %s", setting, strings.Join(errs, "; "))
+	}
+	return key, value, nil
+}
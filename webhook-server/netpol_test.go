@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetNetpolLabel(t *testing.T) {
+	tests := []struct {
+		name      string
+		setting   string
+		wantKey   string
+		wantValue string
+		wantErr   bool
+	}{
+		{name: "unset"},
+		{name: "key only", setting: "tailscale.com/egress", wantKey: "tailscale.com/egress", wantValue: "true"},
+		{name: "key and value", setting: " network=tailnet ", wantKey: "network", wantValue: "tailnet"},
+		{name: "empty value", setting: "network=", wantKey: "network"},
+		{name: "invalid key", setting: "-network=tailnet", wantErr: true},
+		{name: "invalid value", setting: "network=tail net", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NETPOL_LABEL", tt.setting)
+			key, value, err := getNetpolLabel()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getNetpolLabel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if key != tt.wantKey || value != tt.wantValue {
+				t.Errorf("getNetpolLabel() = %q, %q, want %q, %q", key, value, tt.wantKey, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestNetpolLabelPatch(t *testing.T) {
+	t.Setenv("TS_NETPOL_LABEL", "tailscale.com/egress")
+	patches, _, err := generateSidecarPatch(context.Background(), testInjectedPod())
+	if err != nil {
+		t.Fatalf("generateSidecarPatch() error = %v", err)
+	}
+	for _, patch := range patches {
+		if patch.Path == "/metadata/labels/tailscale.com~1egress" {
+			if patch.Value != "true" {
+				t.Errorf("label patch value = %v, want true", patch.Value)
+			}
+			return
+		}
+	}
+	t.Errorf("generateSidecarPatch() did not label the pod: %+v", patches)
+}
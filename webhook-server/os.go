@@ -0,0 +1,35 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const osWindows = "windows"
+
+// getPodOS returns the operating system the pod targets, from spec.os or the
+// kubernetes.io/os node selector, defaulting to linux.
+func getPodOS(pod *corev1.Pod) string {
+	if pod.Spec.OS != nil && pod.Spec.OS.Name != "" {
+		return string(pod.Spec.OS.Name)
+	}
+	if os := pod.Spec.NodeSelector[corev1.LabelOSStable]; os != "" {
+		return os
+	}
+	return string(corev1.Linux)
+}
+
+// getOSImage returns the sidecar image for pods targeting a non-Linux OS, or
+// "" when the pod cannot be injected. Only Windows pods are supported, with
+// TS_WINDOWS_IMAGE.
+func getOSImage(pod *corev1.Pod) string {
+	if getPodOS(pod) != osWindows {
+		return ""
+	}
+	return getEnv("TS_WINDOWS_IMAGE", "")
+}
+
+// supportsPodOS reports whether a sidecar can be injected for the pod's OS.
+// A Linux tailscaled in a Windows pod would never schedule.
+func supportsPodOS(pod *corev1.Pod) bool {
+	return getPodOS(pod) == string(corev1.Linux) || getOSImage(pod) != ""
+}
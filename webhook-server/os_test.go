@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestPodOS(t *testing.T) {
+	tests := []struct {
+		name         string
+		os           *corev1.PodOS
+		nodeSelector map[string]string
+		windowsImage string
+		wantOS       string
+		wantImage    string
+		wantSupport  bool
+	}{
+		{name: "default", wantOS: "linux", wantSupport: true},
+		{name: "spec linux", os: &corev1.PodOS{Name: corev1.Linux}, wantOS: "linux", wantSupport: true},
+		{name: "windows", os: &corev1.PodOS{Name: corev1.Windows}, wantOS: "windows"},
+		{name: "windows selector", nodeSelector: map[string]string{corev1.LabelOSStable: "windows"}, wantOS: "windows"},
+		{name: "spec wins", os: &corev1.PodOS{Name: corev1.Linux}, nodeSelector: map[string]string{corev1.LabelOSStable: "windows"}, wantOS: "linux", wantSupport: true},
+		{
+			name:         "windows image",
+			os:           &corev1.PodOS{Name: corev1.Windows},
+			windowsImage: "example.com/tailscale-windows:v1",
+			wantOS:       "windows",
+			wantImage:    "example.com/tailscale-windows:v1",
+			wantSupport:  true,
+		},
+		{name: "windows image on linux", windowsImage: "example.com/tailscale-windows:v1", wantOS: "linux", wantSupport: true},
+		{name: "other os", nodeSelector: map[string]string{corev1.LabelOSStable: "plan9"}, windowsImage: "example.com/tailscale-windows:v1", wantOS: "plan9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_WINDOWS_IMAGE", tt.windowsImage)
+			pod := &corev1.Pod{Spec: corev1.PodSpec{OS: tt.os, NodeSelector: tt.nodeSelector}}
+			if got := getPodOS(pod); got != tt.wantOS {
+				t.Errorf("getPodOS() = %q, want %q", got, tt.wantOS)
+			}
+			if got := getOSImage(pod); got != tt.wantImage {
+				t.Errorf("getOSImage() = %q, want %q", got, tt.wantImage)
+			}
+			if got := supportsPodOS(pod); got != tt.wantSupport {
+				t.Errorf("supportsPodOS() = %v, want %v", got, tt.wantSupport)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// escapeJSONPointer escapes a map key for use in a JSON patch path (RFC 6901),
+// e.g. tailscale.com/webhook-version becomes tailscale.com~1webhook-version.
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// addMapEntriesPatch returns the patch operations setting entries in a string
+// map of the pod such as /metadata/annotations. When the map does not exist
+// yet it is created with all entries in one operation. Keys are emitted in
+// sorted order so the patch is deterministic.
+func addMapEntriesPatch(path string, existing, entries map[string]string) []patchOperation {
+	if len(entries) == 0 {
+		return nil
+	}
+	if existing == nil {
+		return []patchOperation{{
+			Op:    "add",
+			Path:  path,
+			Value: entries,
+		}}
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	patches := make([]patchOperation, 0, len(keys))
+	for _, key := range keys {
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  path + "/" + escapeJSONPointer(key),
+			Value: entries[key],
+		})
+	}
+	return patches
+}
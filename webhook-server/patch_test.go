@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestEscapeJSONPointer(t *testing.T) {
+	for key, want := range map[string]string{
+		"app":                           "app",
+		"tailscale.com/webhook-version": "tailscale.com~1webhook-version",
+		"a~b/c":                         "a~0b~1c",
+	} {
+		if got := escapeJSONPointer(key); got != want {
+			t.Errorf("escapeJSONPointer(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestAddMapEntriesPatch(t *testing.T) {
+	entries := map[string]string{"tailscale.com/webhook-version": "v1", "b": "2", "a": "1"}
+	tests := []struct {
+		name     string
+		existing map[string]string
+		entries  map[string]string
+		want     []patchOperation
+	}{
+		{name: "no entries", existing: map[string]string{}},
+		{
+			name:    "new map",
+			entries: entries,
+			want:    []patchOperation{{Op: "add", Path: "/metadata/annotations", Value: entries}},
+		},
+		{
+			name:     "existing map sorted",
+			existing: map[string]string{"c": "3"},
+			entries:  entries,
+			want: []patchOperation{
+				{Op: "add", Path: "/metadata/annotations/a", Value: "1"},
+				{Op: "add", Path: "/metadata/annotations/b", Value: "2"},
+				{Op: "add", Path: "/metadata/annotations/tailscale.com~1webhook-version", Value: "v1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := addMapEntriesPatch("/metadata/annotations", tt.existing, tt.entries); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addMapEntriesPatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookVersionAnnotation(t *testing.T) {
+	patches, _, err := generateSidecarPatch(context.Background(), testInjectedPod())
+	if err != nil {
+		t.Fatalf("generateSidecarPatch() error = %v", err)
+	}
+	for _, patch := range patches {
+		if patch.Path == "/metadata/annotations/"+escapeJSONPointer(annotationWebhookVersion) {
+			if patch.Value != version {
+				t.Errorf("%s = %v, want %s", annotationWebhookVersion, patch.Value, version)
+			}
+			return
+		}
+	}
+	t.Errorf("generateSidecarPatch() did not annotate the webhook version: %+v", patches)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// patchResults caches generated patches of recently seen pods. It is nil
+// unless PATCH_CACHE_TTL is set.
+var patchResults *patchCache
+
+// getPatchCacheConfig returns PATCH_CACHE_TTL (default: 0, disabled) and
+// PATCH_CACHE_SIZE, the most pods kept (default: 1000).
+func getPatchCacheConfig() (time.Duration, int, error) {
+	value := getEnv("PATCH_CACHE_TTL", "0")
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, 0, fmt.Errorf("invalid PATCH_CACHE_TTL %q: must be a non-negative duration", value)
+	}
+	value = getEnv("PATCH_CACHE_SIZE", "1000")
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 1 {
+		return 0, 0, fmt.Errorf("invalid PATCH_CACHE_SIZE %q: must be a positive integer", value)
+	}
+	return ttl, size, nil
+}
+
+func initPatchCache() {
+	ttl, size, err := getPatchCacheConfig()
+	if err != nil || ttl == 0 {
+		return
+	}
+	patchResults = newPatchCache(ttl, size)
+	log.Printf("Caching generated patches for %s", ttl)
+}
+
+type patchCacheEntry struct {
+	patches  []patchOperation
+	warnings []string
+	expires  time.Time
+}
+
+// patchCache is a small TTL cache of generated patches, keyed by
+// patchCacheKey. Controllers resubmitting the same pod template then skip
+// patch generation and its API lookups. Lookups made during generation,
+// such as namespace labels and secrets, may be up to the TTL stale.
+type patchCache struct {
+	ttl  time.Duration
+	size int
+
+	mu      sync.Mutex
+	entries map[string]patchCacheEntry
+}
+
+func newPatchCache(ttl time.Duration, size int) *patchCache {
+	return &patchCache{
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]patchCacheEntry{},
+	}
+}
+
+// get returns the cached result for key. The warnings are copied, since
+// callers append to them.
+func (c *patchCache) get(key string) ([]patchOperation, []string, bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !time.Now().Before(entry.expires) {
+		return nil, nil, false
+	}
+	return entry.patches, append([]string(nil), entry.warnings...), true
+}
+
+func (c *patchCache) put(key string, patches []patchOperation, warnings []string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.size {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	// Still full of live entries: evict arbitrary ones, the cache is only
+	// meant to absorb bursts of identical pods
+	for k := range c.entries {
+		if len(c.entries) < c.size {
+			break
+		}
+		delete(c.entries, k)
+	}
+	c.entries[key] = patchCacheEntry{
+		patches:  patches,
+		warnings: append([]string(nil), warnings...),
+		expires:  now.Add(c.ttl),
+	}
+}
+
+// invalidate drops every entry, e.g. after a configuration change.
+func (c *patchCache) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]patchCacheEntry{}
+}
+
+// patchCacheKey hashes everything patch generation reads besides API
+// lookups: the pod as admitted and the webhook configuration, so that a
+// changed environment or a SIGHUP toggling the fallback image never serves
+// patches generated under the old config. Whether the admitted pod has
+// annotations is hashed too, since the JSON encoding drops empty maps and
+// policy overrides fill the in-memory annotations, yet the annotation patch
+// differs.
+func patchCacheKey(ctx context.Context, pod *corev1.Pod) (string, error) {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		return "", err
+	}
+	env := os.Environ()
+	sort.Strings(env)
+
+	h := sha256.New()
+	h.Write(raw)
+	for _, kv := range env {
+		fmt.Fprintf(h, "\x00%s", kv)
+	}
+	fmt.Fprintf(h, "\x00version=%s\x00degraded=%t", version, registryDegraded.Load())
+	fmt.Fprintf(h, "\x00annotations=%t", admittedPod(ctx, pod).Annotations != nil)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
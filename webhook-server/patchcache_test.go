@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testInjectedPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "prod",
+			Labels:    map[string]string{"tailscale.com/inject": "true", "app": "web", "team": "infra", "tier": "frontend"},
+			Annotations: map[string]string{
+				"tailscale.com/tags":             "tag:web,tag:prod",
+				"tailscale.com/advertise-routes": "10.0.0.0/24,10.0.1.0/24",
+				"tailscale.com/forward":          "tcp/80->8080",
+			},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name:  "app",
+			Image: "nginx",
+			Env:   []corev1.EnvVar{{Name: "B", Value: "2"}, {Name: "A", Value: "1"}},
+		}}},
+	}
+}
+
+func marshalPatch(t *testing.T, patches []patchOperation) []byte {
+	t.Helper()
+	raw, err := json.Marshal(patches)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestGenerateSidecarPatchDeterministic(t *testing.T) {
+	t.Setenv("TS_LABEL_ANNOTATIONS", "app,team,tier")
+	first, _, err := generateSidecarPatch(context.Background(), testInjectedPod())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := marshalPatch(t, first)
+	// Map iteration order differs between runs, so repeat to catch any
+	// patch built from ranging over a map
+	for i := 0; i < 50; i++ {
+		patches, _, err := generateSidecarPatch(context.Background(), testInjectedPod())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := marshalPatch(t, patches); !bytes.Equal(got, want) {
+			t.Fatalf("run %d patch differs:\n%s\nwant:\n%s", i, got, want)
+		}
+	}
+}
+
+func TestPatchCache(t *testing.T) {
+	pod := testInjectedPod()
+	patches, warnings, err := generateSidecarPatch(context.Background(), pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := patchCacheKey(context.Background(), pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := patchCacheKey(context.Background(), testInjectedPod()); again != key {
+		t.Fatalf("patchCacheKey() differs for identical pods: %s, %s", key, again)
+	}
+
+	cache := newPatchCache(time.Minute, 2)
+	cache.put(key, patches, warnings)
+	cached, _, ok := cache.get(key)
+	if !ok {
+		t.Fatal("get() missed a fresh entry")
+	}
+	if got, want := marshalPatch(t, cached), marshalPatch(t, patches); !bytes.Equal(got, want) {
+		t.Errorf("cached patch differs:\n%s\nwant:\n%s", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*corev1.Pod)
+		env    map[string]string
+	}{
+		{name: "pod changed", mutate: func(p *corev1.Pod) { p.Labels["app"] = "api" }},
+		{name: "config changed", env: map[string]string{"TS_HOSTNAME_SUFFIX": "eu"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			other := testInjectedPod()
+			if tt.mutate != nil {
+				tt.mutate(other)
+			}
+			otherKey, err := patchCacheKey(context.Background(), other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if otherKey == key {
+				t.Errorf("patchCacheKey() unchanged")
+			}
+		})
+	}
+}
+
+func TestPatchCacheExpiryAndSize(t *testing.T) {
+	cache := newPatchCache(20*time.Millisecond, 2)
+	cache.put("a", nil, []string{"warning"})
+	_, warnings, ok := cache.get("a")
+	if !ok {
+		t.Fatal("get() missed a fresh entry")
+	}
+	warnings[0] = "changed"
+	if _, again, _ := cache.get("a"); again[0] != "warning" {
+		t.Errorf("get() warnings share storage with the cache")
+	}
+
+	cache.put("b", nil, nil)
+	cache.put("c", nil, nil)
+	if len(cache.entries) > 2 {
+		t.Errorf("cache holds %d entries, more than its size 2", len(cache.entries))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, _, ok := cache.get("c"); ok {
+		t.Error("get() returned an expired entry")
+	}
+
+	var disabled *patchCache
+	disabled.put("a", nil, nil)
+	if _, _, ok := disabled.get("a"); ok {
+		t.Error("nil cache returned an entry")
+	}
+}
+
+func TestGetPatchCacheConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      string
+		size     string
+		wantTTL  time.Duration
+		wantSize int
+		wantErr  bool
+	}{
+		{name: "defaults", wantSize: 1000},
+		{name: "set", ttl: "30s", size: "50", wantTTL: 30 * time.Second, wantSize: 50},
+		{name: "invalid ttl", ttl: "soon", wantErr: true},
+		{name: "negative ttl", ttl: "-1s", wantErr: true},
+		{name: "zero size", ttl: "30s", size: "0", wantErr: true},
+		{name: "invalid size", size: "many", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PATCH_CACHE_TTL", tt.ttl)
+			t.Setenv("PATCH_CACHE_SIZE", tt.size)
+			ttl, size, err := getPatchCacheConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPatchCacheConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ttl != tt.wantTTL || size != tt.wantSize {
+				t.Errorf("getPatchCacheConfig() = %v, %d, want %v, %d", ttl, size, tt.wantTTL, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestPatchCacheHandler(t *testing.T) {
+	saved := patchResults
+	t.Cleanup(func() { patchResults = saved })
+	patchResults = newPatchCache(time.Minute, 10)
+
+	first := reviewPod(t, mutateHandler, testInjectedPod())
+	if len(patchResults.entries) != 1 {
+		t.Fatalf("cache holds %d entries after the first admission, want 1", len(patchResults.entries))
+	}
+	second := reviewPod(t, mutateHandler, testInjectedPod())
+	if !bytes.Equal(first.Patch, second.Patch) {
+		t.Errorf("cached patch differs:\n%s\nwant:\n%s", second.Patch, first.Patch)
+	}
+	if len(patchResults.entries) != 1 {
+		t.Errorf("cache holds %d entries after an identical admission, want 1", len(patchResults.entries))
+	}
+}
+
+func TestPatchCacheInvalidate(t *testing.T) {
+	saved := patchResults
+	t.Cleanup(func() { patchResults = saved })
+	t.Setenv("TS_IMAGE_FALLBACK", "mirror.example.com/tailscale:stable")
+
+	patchResults = newPatchCache(time.Minute, 10)
+	patchResults.put("a", nil, nil)
+	patchResults.invalidate()
+	if _, _, ok := patchResults.get("a"); ok {
+		t.Fatal("get() returned an entry after invalidate()")
+	}
+	var disabled *patchCache
+	disabled.invalidate()
+
+	// SIGHUP toggles the fallback image, which must not be served from
+	// patches cached under the primary image
+	key, err := patchCacheKey(context.Background(), testInjectedPod())
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchResults.put(key, nil, nil)
+	toggleRegistryDegraded()
+	t.Cleanup(toggleRegistryDegraded)
+	if _, _, ok := patchResults.get(key); ok {
+		t.Error("get() returned a patch cached before SIGHUP")
+	}
+	if degradedKey, _ := patchCacheKey(context.Background(), testInjectedPod()); degradedKey == key {
+		t.Error("patchCacheKey() unchanged while the registry is degraded")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// annotationPaused injects the sidecar without letting the node join the
+// tailnet, for apps that only need Tailscale once a controller enables it.
+const annotationPaused = "tailscale.com/paused"
+
+// getPaused reports whether the pod asks for paused injection.
+func getPaused(pod *corev1.Pod) (bool, error) {
+	value, ok := pod.Annotations[annotationPaused]
+	if !ok {
+		return false, nil
+	}
+	paused, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, field.Invalid(annotationPath(annotationPaused), value, "must be true or false")
+	}
+	return paused, nil
+}
+
+// applyPaused keeps a paused sidecar logged out: without an auth key
+// tailscaled starts but waits for login, and TS_AUTH_ONCE stops containerboot
+// from logging in on its own. A controller brings the node up later, e.g.
+// with tailscale up --auth-key in the sidecar.
+func applyPaused(container *corev1.Container) {
+	removeEnvVar(container, "TS_AUTHKEY")
+	setEnvVar(container, "TS_AUTH_ONCE", "true")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetPaused(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		unset   bool
+		want    bool
+		wantErr bool
+	}{
+		{name: "unset", unset: true},
+		{name: "paused", value: "true", want: true},
+		{name: "not paused", value: "false"},
+		{name: "invalid", value: "later", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{}
+			if !tt.unset {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{annotationPaused: tt.value}}
+			}
+			got, err := getPaused(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPaused() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPaused() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPaused(t *testing.T) {
+	container := &corev1.Container{Env: []corev1.EnvVar{
+		{Name: "TS_AUTHKEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "authkey"}}},
+		{Name: "TS_AUTH_ONCE", Value: "false"},
+		{Name: "TS_HOSTNAME", Value: "web"},
+	}}
+	applyPaused(container)
+	want := []corev1.EnvVar{{Name: "TS_AUTH_ONCE", Value: "true"}, {Name: "TS_HOSTNAME", Value: "web"}}
+	if !reflect.DeepEqual(container.Env, want) {
+		t.Errorf("applyPaused() env = %v, want %v", container.Env, want)
+	}
+}
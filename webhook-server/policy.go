@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Decisions returned by the external policy service.
+const (
+	policyDecisionInject = "inject"
+	policyDecisionSkip   = "skip"
+	policyDecisionDeny   = "deny"
+)
+
+// policyRequest is the pod metadata sent to the external policy service.
+type policyRequest struct {
+	Namespace          string            `json:"namespace"`
+	Name               string            `json:"name"`
+	GenerateName       string            `json:"generateName,omitempty"`
+	ServiceAccountName string            `json:"serviceAccountName,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty"`
+}
+
+// policyResponse is the decision returned by the external policy service.
+// Overrides are applied as pod annotations before the patch is generated,
+// so they accept the same keys as the tailscale.com/* annotations.
+type policyResponse struct {
+	Decision  string            `json:"decision"`
+	Reason    string            `json:"reason,omitempty"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+var policyClient = &http.Client{}
+
+// consultPolicy asks the service at POLICY_ENDPOINT for the final injection
+// decision. It returns nil when no endpoint is configured. When the service
+// cannot be reached or answers garbage, POLICY_FAIL_MODE decides whether we
+// fall back to injecting ("open", the default) or deny the pod ("closed").
+func consultPolicy(ctx context.Context, pod *corev1.Pod) *policyResponse {
+	endpoint := getEnv("POLICY_ENDPOINT", "")
+	if endpoint == "" {
+		return nil
+	}
+
+	decision, err := callPolicy(ctx, endpoint, pod)
+	if err == nil {
+		return decision
+	}
+
+	if strings.ToLower(getEnv("POLICY_FAIL_MODE", "open")) == "closed" {
+		return &policyResponse{
+			Decision: policyDecisionDeny,
+			Reason:   fmt.Sprintf("policy service unavailable: %v", err),
+		}
+	}
+	log.Printf("Policy service unavailable for pod %s/%s, failing open: %v", pod.Namespace, pod.Name, err)
+	return &policyResponse{Decision: policyDecisionInject}
+}
+
+func callPolicy(ctx context.Context, endpoint string, pod *corev1.Pod) (*policyResponse, error) {
+	timeout, err := time.ParseDuration(getEnv("POLICY_TIMEOUT", "2s"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid POLICY_TIMEOUT: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(policyRequest{
+		Namespace:          pod.Namespace,
+		Name:               pod.Name,
+		GenerateName:       pod.GenerateName,
+		ServiceAccountName: pod.Spec.ServiceAccountName,
+		Labels:             pod.Labels,
+		Annotations:        pod.Annotations,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := policyClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var decision policyResponse
+	if err := json.Unmarshal(respBody, &decision); err != nil {
+		return nil, fmt.Errorf("error decoding policy response: %v", err)
+	}
+
+	switch decision.Decision {
+	case policyDecisionInject, policyDecisionSkip, policyDecisionDeny:
+	default:
+		return nil, fmt.Errorf("unknown policy decision %q", decision.Decision)
+	}
+	return &decision, nil
+}
+
+// admittedAnnotationsKey is the context key of the pod annotations as
+// admitted, before policy overrides were merged into them.
+type admittedAnnotationsKey struct{}
+
+// applyPolicyOverrides merges the policy overrides into the pod annotations,
+// where injection reads its settings from. The overrides are not written
+// back to the pod, so the returned context keeps the admitted annotations
+// for the annotation patch, see admittedPod.
+func applyPolicyOverrides(ctx context.Context, pod *corev1.Pod, overrides map[string]string) context.Context {
+	if len(overrides) == 0 {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, admittedAnnotationsKey{}, pod.Annotations)
+	annotations := make(map[string]string, len(pod.Annotations)+len(overrides))
+	for key, value := range pod.Annotations {
+		annotations[key] = value
+	}
+	for key, value := range overrides {
+		annotations[key] = value
+	}
+	pod.Annotations = annotations
+	return ctx
+}
+
+// admittedPod returns pod with the annotations it was admitted with. Patches
+// must be relative to the admitted object: a pod without annotations needs
+// /metadata/annotations created, even when overrides were merged in memory.
+func admittedPod(ctx context.Context, pod *corev1.Pod) *corev1.Pod {
+	annotations, ok := ctx.Value(admittedAnnotationsKey{}).(map[string]string)
+	if !ok {
+		return pod
+	}
+	admitted := *pod
+	admitted.Annotations = annotations
+	return &admitted
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConsultPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		delay    time.Duration
+		failMode string
+		want     *policyResponse
+	}{
+		{
+			name:   "inject with overrides",
+			status: http.StatusOK,
+			body:   `{"decision":"inject","overrides":{"tailscale.com/tags":"tag:web"}}`,
+			want:   &policyResponse{Decision: policyDecisionInject, Overrides: map[string]string{"tailscale.com/tags": "tag:web"}},
+		},
+		{
+			name:   "skip",
+			status: http.StatusOK,
+			body:   `{"decision":"skip","reason":"batch job"}`,
+			want:   &policyResponse{Decision: policyDecisionSkip, Reason: "batch job"},
+		},
+		{
+			name:   "deny",
+			status: http.StatusOK,
+			body:   `{"decision":"deny","reason":"not allowed"}`,
+			want:   &policyResponse{Decision: policyDecisionDeny, Reason: "not allowed"},
+		},
+		{
+			name:   "server error fails open",
+			status: http.StatusInternalServerError,
+			want:   &policyResponse{Decision: policyDecisionInject},
+		},
+		{
+			name:   "unknown decision fails open",
+			status: http.StatusOK,
+			body:   `{"decision":"maybe"}`,
+			want:   &policyResponse{Decision: policyDecisionInject},
+		},
+		{
+			name:   "timeout fails open",
+			status: http.StatusOK,
+			body:   `{"decision":"deny"}`,
+			delay:  200 * time.Millisecond,
+			want:   &policyResponse{Decision: policyDecisionInject},
+		},
+		{
+			name:     "garbage fails closed",
+			status:   http.StatusOK,
+			body:     `not json`,
+			failMode: "closed",
+			want:     &policyResponse{Decision: policyDecisionDeny},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got policyRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Errorf("decoding policy request: %v", err)
+				}
+				select {
+				case <-time.After(tt.delay):
+				case <-r.Context().Done():
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			t.Setenv("POLICY_ENDPOINT", server.URL)
+			t.Setenv("POLICY_TIMEOUT", "50ms")
+			t.Setenv("POLICY_FAIL_MODE", tt.failMode)
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Labels: map[string]string{"app": "web"}},
+				Spec:       corev1.PodSpec{ServiceAccountName: "web"},
+			}
+			decision := consultPolicy(context.Background(), pod)
+			// Wait for the handler before reading the request it decoded
+			server.Close()
+			if decision == nil {
+				t.Fatal("consultPolicy() = nil, want a decision")
+			}
+			if tt.failMode == "closed" {
+				// The reason carries the error, only check the decision
+				decision.Reason = ""
+			}
+			if !reflect.DeepEqual(decision, tt.want) {
+				t.Errorf("consultPolicy() = %+v, want %+v", decision, tt.want)
+			}
+			want := policyRequest{Namespace: "prod", Name: "web", ServiceAccountName: "web", Labels: pod.Labels}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("policy request = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConsultPolicyDisabled(t *testing.T) {
+	t.Setenv("POLICY_ENDPOINT", "")
+	if decision := consultPolicy(context.Background(), &corev1.Pod{}); decision != nil {
+		t.Errorf("consultPolicy() = %+v, want nil without POLICY_ENDPOINT", decision)
+	}
+}
+
+func TestApplyPolicyOverrides(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		overrides   map[string]string
+	}{
+		{name: "no overrides", annotations: map[string]string{"a": "1"}},
+		{name: "no annotations", overrides: map[string]string{"tailscale.com/tags": "tag:web"}},
+		{name: "merged", annotations: map[string]string{"a": "1", "tailscale.com/tags": "tag:db"}, overrides: map[string]string{"tailscale.com/tags": "tag:web"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			ctx := applyPolicyOverrides(context.Background(), pod, tt.overrides)
+			for key, value := range tt.overrides {
+				if pod.Annotations[key] != value {
+					t.Errorf("annotations = %v, want override %s=%s", pod.Annotations, key, value)
+				}
+			}
+			if admitted := admittedPod(ctx, pod).Annotations; !reflect.DeepEqual(admitted, tt.annotations) {
+				t.Errorf("admittedPod().Annotations = %v, want %v", admitted, tt.annotations)
+			}
+		})
+	}
+}
+
+func TestMutatePolicyOverridesWithoutAnnotations(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"decision":"inject","overrides":{"tailscale.com/tags":"tag:web"}}`))
+	}))
+	defer server.Close()
+	t.Setenv("POLICY_ENDPOINT", server.URL)
+	t.Setenv("TS_VERIFY_PATCH", "true")
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Labels: map[string]string{"tailscale.com/inject": "true"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}},
+	}
+	response := reviewPod(t, mutateHandler, pod)
+	if !response.Allowed || response.Patch == nil {
+		t.Fatalf("response allowed = %v with patch %s, want a patch: %+v", response.Allowed, response.Patch, response.Result)
+	}
+	var patches []patchOperation
+	if err := json.Unmarshal(response.Patch, &patches); err != nil {
+		t.Fatal(err)
+	}
+	// Apply to the pod as the API server holds it, not the one the
+	// handler merged the overrides into
+	patched := applyTestPatches(t, pod, patches)
+	if _, ok := patched.Annotations[annotationWebhookVersion]; !ok {
+		t.Errorf("patched annotations = %v, want %s", patched.Annotations, annotationWebhookVersion)
+	}
+	if _, ok := patched.Annotations["tailscale.com/tags"]; ok {
+		t.Errorf("patched annotations = %v, want the override not written back", patched.Annotations)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const annotationPorts = "tailscale.com/ports"
+
+// parsePortSpec parses a comma separated list of container ports of the form
+// <name>:<port>[/<protocol>], e.g. "metrics:9002,dns:53/udp".
+func parsePortSpec(spec string) ([]corev1.ContainerPort, error) {
+	var ports []corev1.ContainerPort
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid port %q: expected <name>:<port>[/<protocol>]", item)
+		}
+		if errs := validation.IsValidPortName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid port name %q: %s", name, strings.Join(errs, "; "))
+		}
+		number, protocol, _ := strings.Cut(rest, "/")
+		port, err := parsePort(number)
+		if err != nil {
+			return nil, err
+		}
+		proto := corev1.ProtocolTCP
+		switch strings.ToUpper(protocol) {
+		case "", "TCP":
+		case "UDP":
+			proto = corev1.ProtocolUDP
+		case "SCTP":
+			proto = corev1.ProtocolSCTP
+		default:
+			return nil, fmt.Errorf("invalid protocol %q for port %s: must be tcp, udp or sctp", protocol, name)
+		}
+		ports = append(ports, corev1.ContainerPort{Name: name, ContainerPort: int32(port), Protocol: proto})
+	}
+	return ports, nil
+}
+
+// getSidecarPorts returns the container ports declared on the sidecar so
+// Services and NetworkPolicies can select them, from TS_SIDECAR_PORTS and the
+// tailscale.com/ports annotation. A port from the annotation replaces a
+// global port of the same name.
+func getSidecarPorts(pod *corev1.Pod) ([]corev1.ContainerPort, error) {
+	ports, err := parsePortSpec(getEnv("TS_SIDECAR_PORTS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TS_SIDECAR_PORTS: %v", err)
+	}
+
+	value, ok := pod.Annotations[annotationPorts]
+	if !ok {
+		return ports, nil
+	}
+	podPorts, err := parsePortSpec(value)
+	if err != nil {
+		return nil, field.Invalid(annotationPath(annotationPorts), value, err.Error())
+	}
+	for _, podPort := range podPorts {
+		ports = setContainerPort(ports, podPort)
+	}
+	return ports, nil
+}
+
+// setContainerPort replaces the port with the same name, or appends it.
+func setContainerPort(ports []corev1.ContainerPort, port corev1.ContainerPort) []corev1.ContainerPort {
+	for i := range ports {
+		if ports[i].Name == port.Name {
+			ports[i] = port
+			return ports
+		}
+	}
+	return append(ports, port)
+}
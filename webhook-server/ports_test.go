@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []corev1.ContainerPort
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "protocols",
+			spec: "metrics:9002, dns:53/udp,sig:7777/SCTP",
+			want: []corev1.ContainerPort{
+				{Name: "metrics", ContainerPort: 9002, Protocol: corev1.ProtocolTCP},
+				{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP},
+				{Name: "sig", ContainerPort: 7777, Protocol: corev1.ProtocolSCTP},
+			},
+		},
+		{name: "no name", spec: "9002", wantErr: true},
+		{name: "invalid name", spec: "Metrics_Port:9002", wantErr: true},
+		{name: "invalid port", spec: "metrics:99999", wantErr: true},
+		{name: "invalid protocol", spec: "metrics:9002/icmp", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePortSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSidecarPorts(t *testing.T) {
+	tests := []struct {
+		name        string
+		global      string
+		annotations map[string]string
+		want        []corev1.ContainerPort
+		wantErr     bool
+	}{
+		{name: "none"},
+		{name: "global", global: "metrics:9002", want: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9002, Protocol: corev1.ProtocolTCP}}},
+		{
+			name:        "pod replaces by name",
+			global:      "metrics:9002,health:9003",
+			annotations: map[string]string{annotationPorts: "metrics:9100,dns:53/udp"},
+			want: []corev1.ContainerPort{
+				{Name: "metrics", ContainerPort: 9100, Protocol: corev1.ProtocolTCP},
+				{Name: "health", ContainerPort: 9003, Protocol: corev1.ProtocolTCP},
+				{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP},
+			},
+		},
+		{name: "invalid global", global: "metrics", wantErr: true},
+		{name: "invalid annotation", annotations: map[string]string{annotationPorts: "metrics"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_SIDECAR_PORTS", tt.global)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getSidecarPorts(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getSidecarPorts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getSidecarPorts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// getImagePresentRequirement returns the node selector requirement built
+// from TS_IMAGE_PRESENT_LABEL, "key" or "key=value", the label a pre-pull
+// DaemonSet sets on nodes that have the sidecar image. It returns nil when
+// unset.
+func getImagePresentRequirement() (*corev1.NodeSelectorRequirement, error) {
+	setting := strings.TrimSpace(getEnv("TS_IMAGE_PRESENT_LABEL", ""))
+	if setting == "" {
+		return nil, nil
+	}
+	key, value, hasValue := strings.Cut(setting, "=")
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid TS_IMAGE_PRESENT_LABEL %q: %s", setting, strings.Join(errs, "; "))
+	}
+	if !hasValue {
+		return &corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpExists}, nil
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid TS_IMAGE_PRESENT_LABEL %q: %s", setting, strings.Join(errs, "; "))
+	}
+	return &corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpIn, Values: []string{value}}, nil
+}
+
+// addNodeRequirementPatch requires nodes matching requirement for the pod.
+// Required node selector terms are ORed, so the requirement is added to
+// every existing term, keeping the pod's own constraints intact.
+func addNodeRequirementPatch(pod *corev1.Pod, requirement *corev1.NodeSelectorRequirement) []patchOperation {
+	if requirement == nil {
+		return nil
+	}
+	selector := &corev1.NodeSelector{
+		NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+			MatchExpressions: []corev1.NodeSelectorRequirement{*requirement},
+		}},
+	}
+
+	affinity := pod.Spec.Affinity
+	switch {
+	case affinity == nil:
+		return []patchOperation{{
+			Op:    "add",
+			Path:  "/spec/affinity",
+			Value: corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector}},
+		}}
+	case affinity.NodeAffinity == nil:
+		return []patchOperation{{
+			Op:    "add",
+			Path:  "/spec/affinity/nodeAffinity",
+			Value: corev1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector},
+		}}
+	case affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil ||
+		len(affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms) == 0:
+		return []patchOperation{{
+			Op:    "add",
+			Path:  "/spec/affinity/nodeAffinity/requiredDuringSchedulingIgnoredDuringExecution",
+			Value: selector,
+		}}
+	}
+
+	var patches []patchOperation
+	for i, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		path := fmt.Sprintf("/spec/affinity/nodeAffinity/requiredDuringSchedulingIgnoredDuringExecution/nodeSelectorTerms/%d/matchExpressions", i)
+		if len(term.MatchExpressions) == 0 {
+			patches = append(patches, patchOperation{
+				Op:    "add",
+				Path:  path,
+				Value: []corev1.NodeSelectorRequirement{*requirement},
+			})
+			continue
+		}
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  path + "/-",
+			Value: *requirement,
+		})
+	}
+	return patches
+}
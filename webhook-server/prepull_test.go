@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// applyTestPatches returns a copy of pod with patches applied.
+func applyTestPatches(t *testing.T, pod *corev1.Pod, patches []patchOperation) *corev1.Pod {
+	t.Helper()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, patch := range patches {
+		if doc, err = applyAddPatch(doc, patch); err != nil {
+			t.Fatalf("applying %s %s: %v", patch.Op, patch.Path, err)
+		}
+	}
+	if raw, err = json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+	patched := &corev1.Pod{}
+	if err := json.Unmarshal(raw, patched); err != nil {
+		t.Fatal(err)
+	}
+	return patched
+}
+
+func TestGetImagePresentRequirement(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		want    *corev1.NodeSelectorRequirement
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "key", setting: "tailscale.com/image-present", want: &corev1.NodeSelectorRequirement{Key: "tailscale.com/image-present", Operator: corev1.NodeSelectorOpExists}},
+		{name: "key and value", setting: "images/tailscale=v1.76", want: &corev1.NodeSelectorRequirement{Key: "images/tailscale", Operator: corev1.NodeSelectorOpIn, Values: []string{"v1.76"}}},
+		{name: "invalid key", setting: "-bad", wantErr: true},
+		{name: "invalid value", setting: "images/tailscale=v 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_IMAGE_PRESENT_LABEL", tt.setting)
+			got, err := getImagePresentRequirement()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getImagePresentRequirement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getImagePresentRequirement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddNodeRequirementPatch(t *testing.T) {
+	requirement := corev1.NodeSelectorRequirement{Key: "tailscale.com/image-present", Operator: corev1.NodeSelectorOpExists}
+	zone := corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	required := func(terms ...corev1.NodeSelectorTerm) *corev1.Affinity {
+		return &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: terms},
+		}}
+	}
+	tests := []struct {
+		name     string
+		affinity *corev1.Affinity
+		want     []corev1.NodeSelectorTerm
+	}{
+		{name: "no affinity", want: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{requirement}}}},
+		{
+			name:     "pod affinity only",
+			affinity: &corev1.Affinity{PodAffinity: &corev1.PodAffinity{}},
+			want:     []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{requirement}}},
+		},
+		{name: "no terms", affinity: required(), want: []corev1.NodeSelectorTerm{{MatchExpressions: []corev1.NodeSelectorRequirement{requirement}}}},
+		{
+			name: "added to every term",
+			affinity: required(
+				corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{zone}},
+				corev1.NodeSelectorTerm{MatchFields: []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-1"}}}},
+			),
+			want: []corev1.NodeSelectorTerm{
+				{MatchExpressions: []corev1.NodeSelectorRequirement{zone, requirement}},
+				{
+					MatchExpressions: []corev1.NodeSelectorRequirement{requirement},
+					MatchFields:      []corev1.NodeSelectorRequirement{{Key: "metadata.name", Operator: corev1.NodeSelectorOpIn, Values: []string{"node-1"}}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Affinity: tt.affinity}}
+			patched := applyTestPatches(t, pod, addNodeRequirementPatch(pod, &requirement))
+			got := patched.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patched node selector terms = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if patches := addNodeRequirementPatch(&corev1.Pod{}, nil); patches != nil {
+		t.Errorf("addNodeRequirementPatch(nil) = %+v, want none", patches)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// annotationPriorityClass sets the priority class of an injected pod,
+// overriding TS_PRIORITY_CLASS. Containers share the pod's priority, so a
+// tailnet-critical pod is raised as a whole.
+const annotationPriorityClass = "tailscale.com/priority-class"
+
+// getDefaultPriorityClass returns TS_PRIORITY_CLASS, or "" when unset.
+func getDefaultPriorityClass() (string, error) {
+	value := getEnv("TS_PRIORITY_CLASS", "")
+	if value == "" {
+		return "", nil
+	}
+	if errs := validation.IsDNS1123Subdomain(value); len(errs) > 0 {
+		return "", fmt.Errorf("invalid TS_PRIORITY_CLASS %q: %s", value, strings.Join(errs, "; "))
+	}
+	return value, nil
+}
+
+// getPriorityClass returns the priority class to set on the pod: the
+// tailscale.com/priority-class annotation wins over TS_PRIORITY_CLASS. Pods
+// that already name a priority class keep it, so "" is returned for them.
+func getPriorityClass(pod *corev1.Pod) (string, error) {
+	if pod.Spec.PriorityClassName != "" {
+		return "", nil
+	}
+	if value, ok := pod.Annotations[annotationPriorityClass]; ok {
+		name := strings.TrimSpace(value)
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return "", field.Invalid(annotationPath(annotationPriorityClass), value, strings.Join(errs, "; "))
+		}
+		return name, nil
+	}
+	return getDefaultPriorityClass()
+}
+
+// priorityClassPatch sets the pod's priority class. The API server resolves
+// the class into spec.priority before calling webhooks, so the class is read
+// to set the matching priority and preemption policy as well; "add" replaces
+// the values already there. Without API access only the name is set.
+func priorityClassPatch(ctx context.Context, name string) ([]patchOperation, error) {
+	if name == "" {
+		return nil, nil
+	}
+	patches := []patchOperation{{
+		Op:    "add",
+		Path:  "/spec/priorityClassName",
+		Value: name,
+	}}
+	if kubeClient == nil {
+		return patches, nil
+	}
+
+	class, err := kubeClient.SchedulingV1().PriorityClasses().Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("priority class %q not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading priority class %s: %v", name, err)
+	}
+	patches = append(patches, patchOperation{
+		Op:    "add",
+		Path:  "/spec/priority",
+		Value: class.Value,
+	})
+	if class.PreemptionPolicy != nil {
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  "/spec/preemptionPolicy",
+			Value: *class.PreemptionPolicy,
+		})
+	}
+	return patches, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetPriorityClass(t *testing.T) {
+	tests := []struct {
+		name        string
+		global      string
+		annotations map[string]string
+		existing    string
+		want        string
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "global", global: "tailnet-critical", want: "tailnet-critical"},
+		{name: "annotation wins", global: "tailnet-critical", annotations: map[string]string{annotationPriorityClass: " system-cluster-critical "}, want: "system-cluster-critical"},
+		{name: "pod keeps its own", global: "tailnet-critical", annotations: map[string]string{annotationPriorityClass: "high"}, existing: "low"},
+		{name: "invalid annotation", annotations: map[string]string{annotationPriorityClass: "High_Priority"}, wantErr: true},
+		{name: "invalid global", global: "High_Priority", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_PRIORITY_CLASS", tt.global)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{PriorityClassName: tt.existing},
+			}
+			got, err := getPriorityClass(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPriorityClass() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPriorityClass() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriorityClassPatch(t *testing.T) {
+	never := corev1.PreemptNever
+	client := fake.NewSimpleClientset(
+		&schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: "tailnet-critical"}, Value: 1000000},
+		&schedulingv1.PriorityClass{ObjectMeta: metav1.ObjectMeta{Name: "batch"}, Value: -10, PreemptionPolicy: &never},
+	)
+	tests := []struct {
+		name    string
+		client  kubernetes.Interface
+		class   string
+		want    []patchOperation
+		wantErr bool
+	}{
+		{name: "none", client: client},
+		{
+			name:  "no API access",
+			class: "tailnet-critical",
+			want:  []patchOperation{{Op: "add", Path: "/spec/priorityClassName", Value: "tailnet-critical"}},
+		},
+		{
+			name:   "priority",
+			client: client,
+			class:  "tailnet-critical",
+			want: []patchOperation{
+				{Op: "add", Path: "/spec/priorityClassName", Value: "tailnet-critical"},
+				{Op: "add", Path: "/spec/priority", Value: int32(1000000)},
+			},
+		},
+		{
+			name:   "preemption policy",
+			client: client,
+			class:  "batch",
+			want: []patchOperation{
+				{Op: "add", Path: "/spec/priorityClassName", Value: "batch"},
+				{Op: "add", Path: "/spec/priority", Value: int32(-10)},
+				{Op: "add", Path: "/spec/preemptionPolicy", Value: corev1.PreemptNever},
+			},
+		},
+		{name: "not found", client: client, class: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := kubeClient
+			defer func() { kubeClient = old }()
+			kubeClient = tt.client
+			got, err := priorityClassPatch(context.Background(), tt.class)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("priorityClassPatch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("priorityClassPatch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
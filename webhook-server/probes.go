@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// healthCheckPath is served by tailscaled when TS_HEALTHCHECK_ADDR_PORT is set.
+const healthCheckPath = "/healthz"
+
+// getHealthCheckPort returns the port from TS_HEALTHCHECK_PORT, or 0 when the
+// health endpoint is disabled.
+func getHealthCheckPort() (int32, error) {
+	value := getEnv("TS_HEALTHCHECK_PORT", "")
+	if value == "" {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid TS_HEALTHCHECK_PORT %q: must be a port number", value)
+	}
+	return int32(port), nil
+}
+
+// applyHealthCheck enables tailscaled's health endpoint on the given port and
+// points HTTP liveness and readiness probes at it, so the env and the probes
+// can never disagree on the port. The liveness probe is left out when the
+// sidecar would not be restarted after failing it, see livenessRestartable.
+func applyHealthCheck(pod *corev1.Pod, container *corev1.Container, port int32) {
+	if port == 0 {
+		return
+	}
+	setEnvVar(container, "TS_HEALTHCHECK_ADDR_PORT", fmt.Sprintf("[::]:%d", port))
+
+	handler := corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{
+			Path: healthCheckPath,
+			Port: intstr.FromInt32(port),
+		},
+	}
+	if livenessRestartable(pod) {
+		container.LivenessProbe = &corev1.Probe{
+			ProbeHandler:        handler,
+			InitialDelaySeconds: 10,
+			PeriodSeconds:       10,
+		}
+	} else {
+		log.Printf("Pod %s/%s has restartPolicy Never, not adding a liveness probe to the sidecar", pod.Namespace, pod.Name)
+	}
+	container.ReadinessProbe = &corev1.Probe{
+		ProbeHandler:  handler,
+		PeriodSeconds: 5,
+	}
+}
+
+// livenessRestartable reports whether a sidecar failing its liveness probe
+// gets restarted. Native sidecars always restart, but a regular container
+// follows the pod's restartPolicy: with Never, typical for Jobs, a failed
+// probe kills tailscaled for good while the app keeps running.
+func livenessRestartable(pod *corev1.Pod) bool {
+	return nativeSidecarEnabled() || pod.Spec.RestartPolicy != corev1.RestartPolicyNever
+}
+
+// getReadinessGate returns the pod condition type from TS_READINESS_GATE, or
+// "" when no readiness gate is configured.
+func getReadinessGate() (corev1.PodConditionType, error) {
+	value := getEnv("TS_READINESS_GATE", "")
+	if value == "" {
+		return "", nil
+	}
+	if errs := validation.IsQualifiedName(value); len(errs) > 0 {
+		return "", fmt.Errorf("invalid TS_READINESS_GATE %q: %s", value, strings.Join(errs, ", "))
+	}
+	return corev1.PodConditionType(value), nil
+}
+
+// addReadinessGatePatch adds a readiness gate for conditionType unless the
+// pod already declares one.
+func addReadinessGatePatch(pod *corev1.Pod, conditionType corev1.PodConditionType) []patchOperation {
+	if conditionType == "" {
+		return nil
+	}
+	for _, gate := range pod.Spec.ReadinessGates {
+		if gate.ConditionType == conditionType {
+			return nil
+		}
+	}
+	gate := corev1.PodReadinessGate{ConditionType: conditionType}
+	if len(pod.Spec.ReadinessGates) == 0 {
+		return []patchOperation{{
+			Op:    "add",
+			Path:  "/spec/readinessGates",
+			Value: []corev1.PodReadinessGate{gate},
+		}}
+	}
+	return []patchOperation{{
+		Op:    "add",
+		Path:  "/spec/readinessGates/-",
+		Value: gate,
+	}}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGetHealthCheckPort(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int32
+		wantErr bool
+	}{
+		{value: ""},
+		{value: "9003", want: 9003},
+		{value: "0", wantErr: true},
+		{value: "65536", wantErr: true},
+		{value: "health", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Setenv("TS_HEALTHCHECK_PORT", tt.value)
+		got, err := getHealthCheckPort()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("getHealthCheckPort() with %q error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("getHealthCheckPort() with %q = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestApplyHealthCheck(t *testing.T) {
+	pod := &corev1.Pod{}
+	container := &corev1.Container{}
+	applyHealthCheck(pod, container, 0)
+	if len(container.Env) != 0 || container.LivenessProbe != nil || container.ReadinessProbe != nil {
+		t.Fatalf("applyHealthCheck() without a port changed the container: %+v", container)
+	}
+
+	applyHealthCheck(pod, container, 9003)
+	if len(container.Env) != 1 || container.Env[0].Name != "TS_HEALTHCHECK_ADDR_PORT" || container.Env[0].Value != "[::]:9003" {
+		t.Errorf("applyHealthCheck() env = %v, want TS_HEALTHCHECK_ADDR_PORT=[::]:9003", container.Env)
+	}
+	for name, probe := range map[string]*corev1.Probe{"liveness": container.LivenessProbe, "readiness": container.ReadinessProbe} {
+		if probe == nil || probe.HTTPGet == nil {
+			t.Errorf("applyHealthCheck() %s probe = %v, want an HTTP probe", name, probe)
+			continue
+		}
+		if probe.HTTPGet.Path != healthCheckPath || probe.HTTPGet.Port.IntValue() != 9003 {
+			t.Errorf("applyHealthCheck() %s probe = %s:%s, want %s:9003", name, probe.HTTPGet.Path, probe.HTTPGet.Port.String(), healthCheckPath)
+		}
+	}
+}
+
+func TestReadinessGate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		existing []corev1.PodReadinessGate
+		want     []corev1.PodReadinessGate
+		wantErr  bool
+	}{
+		{name: "unset"},
+		{name: "added", value: "tailscale.com/connected", want: []corev1.PodReadinessGate{{ConditionType: "tailscale.com/connected"}}},
+		{
+			name:     "appended",
+			value:    "tailscale.com/connected",
+			existing: []corev1.PodReadinessGate{{ConditionType: "example.com/ready"}},
+			want:     []corev1.PodReadinessGate{{ConditionType: "example.com/ready"}, {ConditionType: "tailscale.com/connected"}},
+		},
+		{
+			name:     "already declared",
+			value:    "tailscale.com/connected",
+			existing: []corev1.PodReadinessGate{{ConditionType: "tailscale.com/connected"}},
+			want:     []corev1.PodReadinessGate{{ConditionType: "tailscale.com/connected"}},
+		},
+		{name: "invalid", value: "not a condition", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_READINESS_GATE", tt.value)
+			conditionType, err := getReadinessGate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getReadinessGate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			pod := &corev1.Pod{Spec: corev1.PodSpec{ReadinessGates: tt.existing}}
+			patched := applyTestPatches(t, pod, addReadinessGatePatch(pod, conditionType))
+			if !reflect.DeepEqual(patched.Spec.ReadinessGates, tt.want) {
+				t.Errorf("patched readiness gates = %v, want %v", patched.Spec.ReadinessGates, tt.want)
+			}
+		})
+	}
+}
+
+func TestLivenessRestartable(t *testing.T) {
+	tests := []struct {
+		name          string
+		restartPolicy corev1.RestartPolicy
+		native        string
+		wantLiveness  bool
+	}{
+		{name: "always", restartPolicy: corev1.RestartPolicyAlways, wantLiveness: true},
+		{name: "on failure", restartPolicy: corev1.RestartPolicyOnFailure, wantLiveness: true},
+		{name: "never", restartPolicy: corev1.RestartPolicyNever},
+		{name: "never native", restartPolicy: corev1.RestartPolicyNever, native: "true", wantLiveness: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NATIVE_SIDECAR", tt.native)
+			pod := &corev1.Pod{Spec: corev1.PodSpec{RestartPolicy: tt.restartPolicy}}
+			container := &corev1.Container{}
+			applyHealthCheck(pod, container, 9003)
+			if (container.LivenessProbe != nil) != tt.wantLiveness {
+				t.Errorf("applyHealthCheck() liveness probe = %v, want %v", container.LivenessProbe != nil, tt.wantLiveness)
+			}
+			if container.ReadinessProbe == nil {
+				t.Error("applyHealthCheck() dropped the readiness probe")
+			}
+		})
+	}
+}
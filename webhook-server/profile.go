@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const annotationProfile = "tailscale.com/profile"
+
+// State modes for tailscaled. With "secret" the state is kept in the
+// TS_KUBE_SECRET secret, with "memory" it is lost when the sidecar restarts,
+// which suits ephemeral nodes.
+const (
+	stateModeSecret = "secret"
+	stateModeMemory = "memory"
+)
+
+// sidecarProfile is a named set of sidecar settings configured in
+// TS_PROFILES and selected with the tailscale.com/profile annotation or
+// TS_DEFAULT_PROFILE. Profile fields replace the global defaults, pod
+// annotations still take precedence over the profile.
+type sidecarProfile struct {
+	NetworkingMode  string                  `json:"networkingMode,omitempty"`
+	Image           string                  `json:"image,omitempty"`
+	Resources       string                  `json:"resources,omitempty"`
+	Privileged      *bool                   `json:"privileged,omitempty"`
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+	ExtraArgs       string                  `json:"extraArgs,omitempty"`
+	StateMode       string                  `json:"stateMode,omitempty"`
+	Socks5Server    string                  `json:"socks5Server,omitempty"`
+}
+
+// builtinProfiles are the injection strategies available without any
+// configuration, so that picking one with tailscale.com/profile sets
+// consistent networking, privilege, state and resource defaults. A profile of
+// the same name in TS_PROFILES replaces the built-in one.
+var builtinProfiles = map[string]sidecarProfile{
+	"kernel": {
+		NetworkingMode: networkingModeKernel,
+		Privileged:     boolPtr(true),
+		StateMode:      stateModeSecret,
+		Resources:      "requests.cpu=50m,requests.memory=64Mi",
+	},
+	"userspace": {
+		NetworkingMode: networkingModeUserspace,
+		Privileged:     boolPtr(false),
+		StateMode:      stateModeSecret,
+		Resources:      "requests.cpu=50m,requests.memory=64Mi",
+	},
+	"ephemeral": {
+		NetworkingMode: networkingModeUserspace,
+		Privileged:     boolPtr(false),
+		StateMode:      stateModeMemory,
+		Resources:      "requests.cpu=10m,requests.memory=32Mi",
+	},
+	// socks5 gives sandboxed apps outbound tailnet access through a SOCKS5
+	// proxy on localhost, from a sidecar without any capabilities.
+	"socks5": {
+		NetworkingMode: networkingModeUserspace,
+		Privileged:     boolPtr(false),
+		SecurityContext: &corev1.SecurityContext{
+			AllowPrivilegeEscalation: boolPtr(false),
+			Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		},
+		StateMode:    stateModeSecret,
+		Resources:    "requests.cpu=10m,requests.memory=32Mi",
+		Socks5Server: "localhost:1055",
+	},
+}
+
+// privileged returns the privilege set by the profile, from either the
+// privileged field or the security context, or nil when it is not set.
+func (p *sidecarProfile) privileged() *bool {
+	if p.Privileged != nil {
+		return p.Privileged
+	}
+	if p.SecurityContext != nil {
+		return p.SecurityContext.Privileged
+	}
+	return nil
+}
+
+// validate checks that the profile fields are valid and consistent with
+// each other.
+func (p *sidecarProfile) validate() error {
+	switch p.NetworkingMode {
+	case "", networkingModeKernel, networkingModeUserspace:
+	default:
+		return fmt.Errorf("invalid networkingMode %q: must be kernel or userspace", p.NetworkingMode)
+	}
+	switch p.StateMode {
+	case "", stateModeSecret, stateModeMemory:
+	default:
+		return fmt.Errorf("invalid stateMode %q: must be secret or memory", p.StateMode)
+	}
+	if p.Resources != "" {
+		if _, err := parseResourceSpec(p.Resources); err != nil {
+			return fmt.Errorf("invalid resources: %v", err)
+		}
+	}
+	if _, err := splitArgs(p.ExtraArgs); err != nil {
+		return fmt.Errorf("invalid extraArgs: %v", err)
+	}
+	if p.Socks5Server != "" {
+		_, port, err := net.SplitHostPort(p.Socks5Server)
+		if err != nil {
+			return fmt.Errorf("invalid socks5Server %q: must be host:port", p.Socks5Server)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid socks5Server %q: port must be a number between 1 and 65535", p.Socks5Server)
+		}
+		if p.NetworkingMode != networkingModeUserspace {
+			return fmt.Errorf("socks5Server requires userspace networking")
+		}
+	}
+
+	if p.Privileged != nil && p.SecurityContext != nil && p.SecurityContext.Privileged != nil && *p.Privileged != *p.SecurityContext.Privileged {
+		return fmt.Errorf("privileged and securityContext.privileged disagree")
+	}
+	if privileged := p.privileged(); privileged != nil && *privileged && p.NetworkingMode == networkingModeUserspace {
+		return fmt.Errorf("userspace networking does not need a privileged container, remove privileged or use kernel mode")
+	}
+	return nil
+}
+
+// loadProfiles parses and validates the TS_PROFILES JSON object of profile
+// name to profile, on top of the built-in profiles.
+func loadProfiles() (map[string]*sidecarProfile, error) {
+	var profiles map[string]*sidecarProfile
+	if value := getEnv("TS_PROFILES", ""); value != "" {
+		if err := json.Unmarshal([]byte(value), &profiles); err != nil {
+			return nil, fmt.Errorf("invalid TS_PROFILES: %v", err)
+		}
+	}
+	if profiles == nil {
+		profiles = map[string]*sidecarProfile{}
+	}
+	for name, builtin := range builtinProfiles {
+		if _, ok := profiles[name]; !ok {
+			profile := builtin
+			profiles[name] = &profile
+		}
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if profiles[name] == nil {
+			profiles[name] = &sidecarProfile{}
+		}
+		if err := profiles[name].validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %q: %v", name, err)
+		}
+	}
+
+	if name := getEnv("TS_DEFAULT_PROFILE", ""); name != "" && profiles[name] == nil {
+		return nil, fmt.Errorf("TS_DEFAULT_PROFILE %q is neither a built-in profile nor defined in TS_PROFILES", name)
+	}
+	return profiles, nil
+}
+
+// getProfile returns the profile selected for the pod, or an empty profile
+// when none is selected.
+func getProfile(pod *corev1.Pod) (*sidecarProfile, error) {
+	profiles, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+
+	name := getEnv("TS_DEFAULT_PROFILE", "")
+	value, fromAnnotation := pod.Annotations[annotationProfile]
+	if fromAnnotation {
+		name = strings.TrimSpace(value)
+	}
+	if name == "" {
+		return &sidecarProfile{}, nil
+	}
+
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, field.NotFound(annotationPath(annotationProfile), name)
+	}
+	return profile, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile sidecarProfile
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "kernel", profile: sidecarProfile{NetworkingMode: networkingModeKernel, Privileged: boolPtr(true), StateMode: stateModeSecret}},
+		{name: "invalid networking", profile: sidecarProfile{NetworkingMode: "tun"}, wantErr: true},
+		{name: "invalid state", profile: sidecarProfile{StateMode: "disk"}, wantErr: true},
+		{name: "invalid resources", profile: sidecarProfile{Resources: "cpu"}, wantErr: true},
+		{name: "invalid extra args", profile: sidecarProfile{ExtraArgs: "'--ssh"}, wantErr: true},
+		{
+			name:    "privileged disagrees",
+			profile: sidecarProfile{Privileged: boolPtr(true), SecurityContext: &corev1.SecurityContext{Privileged: boolPtr(false)}},
+			wantErr: true,
+		},
+		{name: "privileged userspace", profile: sidecarProfile{NetworkingMode: networkingModeUserspace, Privileged: boolPtr(true)}, wantErr: true},
+		{
+			name:    "privileged userspace from security context",
+			profile: sidecarProfile{NetworkingMode: networkingModeUserspace, SecurityContext: &corev1.SecurityContext{Privileged: boolPtr(true)}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetProfile(t *testing.T) {
+	profiles := `{"edge": {"networkingMode": "userspace", "extraArgs": "--accept-routes"}, "empty": null}`
+	tests := []struct {
+		name          string
+		profiles      string
+		defaultName   string
+		annotation    string
+		hasAnnotation bool
+		wantExtraArgs string
+		wantErr       bool
+	}{
+		{name: "none selected", profiles: profiles},
+		{name: "annotation", profiles: profiles, annotation: "edge", hasAnnotation: true, wantExtraArgs: "--accept-routes"},
+		{name: "default", profiles: profiles, defaultName: "edge", wantExtraArgs: "--accept-routes"},
+		{name: "annotation clears default", profiles: profiles, defaultName: "edge", hasAnnotation: true},
+		{name: "null profile", profiles: profiles, annotation: "empty", hasAnnotation: true},
+		{name: "unknown annotation", profiles: profiles, annotation: "core", hasAnnotation: true, wantErr: true},
+		{name: "unknown default", profiles: profiles, defaultName: "core", wantErr: true},
+		{name: "invalid json", profiles: `{"edge": `, wantErr: true},
+		{name: "invalid profile", profiles: `{"edge": {"stateMode": "disk"}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_PROFILES", tt.profiles)
+			t.Setenv("TS_DEFAULT_PROFILE", tt.defaultName)
+			pod := &corev1.Pod{}
+			if tt.hasAnnotation {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{annotationProfile: tt.annotation}}
+			}
+			got, err := getProfile(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got.ExtraArgs != tt.wantExtraArgs {
+				t.Errorf("getProfile() extraArgs = %q, want %q", got.ExtraArgs, tt.wantExtraArgs)
+			}
+		})
+	}
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	tests := []struct {
+		name           string
+		profiles       string
+		wantNetworking string
+		wantState      string
+	}{
+		{name: "kernel", wantNetworking: networkingModeKernel, wantState: stateModeSecret},
+		{name: "userspace", wantNetworking: networkingModeUserspace, wantState: stateModeSecret},
+		{name: "ephemeral", wantNetworking: networkingModeUserspace, wantState: stateModeMemory},
+		{name: "ephemeral", profiles: `{"ephemeral": {"networkingMode": "kernel", "stateMode": "secret"}}`, wantNetworking: networkingModeKernel, wantState: stateModeSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_PROFILES", tt.profiles)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annotationProfile: tt.name}}}
+			got, err := getProfile(pod)
+			if err != nil {
+				t.Fatalf("getProfile() error = %v", err)
+			}
+			if got.NetworkingMode != tt.wantNetworking || got.StateMode != tt.wantState {
+				t.Errorf("getProfile() = %s/%s, want %s/%s", got.NetworkingMode, got.StateMode, tt.wantNetworking, tt.wantState)
+			}
+		})
+	}
+
+	for name, profile := range builtinProfiles {
+		if err := profile.validate(); err != nil {
+			t.Errorf("built-in profile %q is invalid: %v", name, err)
+		}
+	}
+}
+
+func TestSocks5Profile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile sidecarProfile
+		wantErr bool
+	}{
+		{name: "userspace", profile: sidecarProfile{NetworkingMode: networkingModeUserspace, Socks5Server: "localhost:1055"}},
+		{name: "kernel", profile: sidecarProfile{NetworkingMode: networkingModeKernel, Socks5Server: "localhost:1055"}, wantErr: true},
+		{name: "no port", profile: sidecarProfile{NetworkingMode: networkingModeUserspace, Socks5Server: "localhost"}, wantErr: true},
+		{name: "invalid port", profile: sidecarProfile{NetworkingMode: networkingModeUserspace, Socks5Server: "localhost:0"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.profile.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	pod := testInjectedPod()
+	pod.Annotations[annotationProfile] = "socks5"
+	delete(pod.Annotations, annotationForward)
+	patches, _, err := generateSidecarPatch(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("generateSidecarPatch() error = %v", err)
+	}
+	sidecar, _ := sidecarFromPatch(patches)
+	env := map[string]string{}
+	for _, e := range sidecar.Env {
+		env[e.Name] = e.Value
+	}
+	if env["TS_SOCKS5_SERVER"] != "localhost:1055" || env["TS_USERSPACE"] != "true" {
+		t.Errorf("socks5 sidecar env = %v, want TS_SOCKS5_SERVER=localhost:1055 and TS_USERSPACE=true", env)
+	}
+	if sc := sidecar.SecurityContext; sc == nil || sc.Capabilities == nil || len(sc.Capabilities.Add) != 0 || (sc.Privileged != nil && *sc.Privileged) {
+		t.Errorf("socks5 sidecar security context = %+v, want no capabilities or privilege", sc)
+	}
+}
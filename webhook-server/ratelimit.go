@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// injectLimiter throttles successful injections so that scale events do not
+// flood the control server with node registrations. It is nil unless
+// TS_INJECT_RATE is set.
+var injectLimiter *rate.Limiter
+
+// getInjectRate returns the TS_INJECT_RATE injections per second (0 for
+// unlimited), the TS_INJECT_BURST bucket size (default: the rate rounded up)
+// and TS_INJECT_RATE_TIMEOUT, how long a request may wait for a token
+// (default: 5s).
+func getInjectRate() (rate.Limit, int, time.Duration, error) {
+	value := getEnv("TS_INJECT_RATE", "")
+	if value == "" {
+		return 0, 0, 0, nil
+	}
+	perSecond, err := strconv.ParseFloat(value, 64)
+	if err != nil || perSecond <= 0 || math.IsInf(perSecond, 0) {
+		return 0, 0, 0, fmt.Errorf("invalid TS_INJECT_RATE %q: must be a positive number of injections per second", value)
+	}
+	burst := int(math.Ceil(perSecond))
+	if value := getEnv("TS_INJECT_BURST", ""); value != "" {
+		burst, err = strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return 0, 0, 0, fmt.Errorf("invalid TS_INJECT_BURST %q: must be a positive integer", value)
+		}
+	}
+	timeout, err := time.ParseDuration(getEnv("TS_INJECT_RATE_TIMEOUT", "5s"))
+	if err != nil || timeout < 0 {
+		return 0, 0, 0, fmt.Errorf("invalid TS_INJECT_RATE_TIMEOUT %q: must be a non-negative duration", getEnv("TS_INJECT_RATE_TIMEOUT", "5s"))
+	}
+	return rate.Limit(perSecond), burst, timeout, nil
+}
+
+func initInjectLimiter() {
+	limit, burst, _, err := getInjectRate()
+	if err != nil || limit == 0 {
+		return
+	}
+	injectLimiter = rate.NewLimiter(limit, burst)
+	log.Printf("Limiting injections to %g per second (burst %d)", float64(limit), burst)
+}
+
+// waitForInjection blocks until the pod may be injected. It returns false
+// when no token became available within TS_INJECT_RATE_TIMEOUT or before
+// the request was cancelled, leaving the pod to the injection error policy.
+func waitForInjection(ctx context.Context, limiter *rate.Limiter) bool {
+	if limiter == nil {
+		return true
+	}
+	_, _, timeout, _ := getInjectRate()
+	if timeout == 0 {
+		return limiter.Allow()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return limiter.Wait(ctx) == nil
+}
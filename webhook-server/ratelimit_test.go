@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestGetInjectRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		rate        string
+		burst       string
+		timeout     string
+		wantLimit   rate.Limit
+		wantBurst   int
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "burst from rate", rate: "2.5", wantLimit: 2.5, wantBurst: 3, wantTimeout: 5 * time.Second},
+		{name: "explicit", rate: "10", burst: "50", timeout: "0s", wantLimit: 10, wantBurst: 50},
+		{name: "zero rate", rate: "0", wantErr: true},
+		{name: "infinite rate", rate: "+Inf", wantErr: true},
+		{name: "invalid burst", rate: "1", burst: "0", wantErr: true},
+		{name: "invalid timeout", rate: "1", timeout: "-1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_INJECT_RATE", tt.rate)
+			t.Setenv("TS_INJECT_BURST", tt.burst)
+			t.Setenv("TS_INJECT_RATE_TIMEOUT", tt.timeout)
+			limit, burst, timeout, err := getInjectRate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getInjectRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if limit != tt.wantLimit || burst != tt.wantBurst || timeout != tt.wantTimeout {
+				t.Errorf("getInjectRate() = %v, %d, %v, want %v, %d, %v", limit, burst, timeout, tt.wantLimit, tt.wantBurst, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestWaitForInjection(t *testing.T) {
+	if !waitForInjection(context.Background(), nil) {
+		t.Fatal("waitForInjection() without a limiter = false")
+	}
+
+	t.Setenv("TS_INJECT_RATE", "1")
+	t.Setenv("TS_INJECT_RATE_TIMEOUT", "0s")
+	limiter := rate.NewLimiter(1, 1)
+	if !waitForInjection(context.Background(), limiter) {
+		t.Fatal("waitForInjection() with a token = false")
+	}
+	if waitForInjection(context.Background(), limiter) {
+		t.Fatal("waitForInjection() without a token and no timeout = true")
+	}
+
+	t.Setenv("TS_INJECT_RATE_TIMEOUT", "2s")
+	limiter = rate.NewLimiter(20, 1)
+	limiter.Allow()
+	if !waitForInjection(context.Background(), limiter) {
+		t.Fatal("waitForInjection() = false, want it to wait for the next token")
+	}
+	limiter = rate.NewLimiter(rate.Every(time.Hour), 1)
+	limiter.Allow()
+	if waitForInjection(context.Background(), limiter) {
+		t.Fatal("waitForInjection() = true for a token beyond the timeout")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Outcomes recorded for injection decisions.
+const (
+	outcomeInjected = "injected"
+	outcomeSkipped  = "skipped"
+	outcomeDenied   = "denied"
+)
+
+// recentDecision is a single admission outcome kept for troubleshooting.
+type recentDecision struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Outcome   string    `json:"outcome"`
+	Reason    string    `json:"reason"`
+}
+
+// decisionBuffer is a fixed size, thread-safe ring buffer of decisions.
+type decisionBuffer struct {
+	mu      sync.Mutex
+	entries []recentDecision
+	next    int
+	full    bool
+}
+
+func newDecisionBuffer(size int) *decisionBuffer {
+	return &decisionBuffer{entries: make([]recentDecision, size)}
+}
+
+// add records a decision, overwriting the oldest one when the buffer is full.
+func (b *decisionBuffer) add(d recentDecision) {
+	if b == nil || len(b.entries) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[b.next] = d
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// list returns the recorded decisions, oldest first.
+func (b *decisionBuffer) list() []recentDecision {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.full {
+		return append([]recentDecision(nil), b.entries[:b.next]...)
+	}
+	return append(append([]recentDecision(nil), b.entries[b.next:]...), b.entries[:b.next]...)
+}
+
+// recentDecisions holds the last RECENT_BUFFER_SIZE decisions. It is nil,
+// and recording is a no-op, until initRecentDecisions runs.
+var recentDecisions *decisionBuffer
+
+func initRecentDecisions() {
+	size, err := strconv.Atoi(getEnv("RECENT_BUFFER_SIZE", "100"))
+	if err != nil || size < 0 {
+		log.Fatalf("Invalid RECENT_BUFFER_SIZE: %q", getEnv("RECENT_BUFFER_SIZE", ""))
+	}
+	recentDecisions = newDecisionBuffer(size)
+}
+
+func recordDecision(pod *corev1.Pod, outcome, reason string) {
+	name := pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+	recentDecisions.add(recentDecision{
+		Time:      time.Now().UTC(),
+		Namespace: pod.Namespace,
+		Pod:       name,
+		Outcome:   outcome,
+		Reason:    reason,
+	})
+}
+
+// recentHandler serves the recent decisions as JSON. Like per-request debug
+// logging it requires the X-TS-Debug-Token header to match DEBUG_TOKEN.
+func recentHandler(w http.ResponseWriter, r *http.Request) {
+	if !debugTokenValid(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recentDecisions.list())
+}
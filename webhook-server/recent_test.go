@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDecisionBufferRollover(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []string
+	}{
+		{name: "empty", size: 3},
+		{name: "partial", size: 3, added: 2, want: []string{"pod-0", "pod-1"}},
+		{name: "exactly full", size: 3, added: 3, want: []string{"pod-0", "pod-1", "pod-2"}},
+		{name: "rolled over", size: 3, added: 5, want: []string{"pod-2", "pod-3", "pod-4"}},
+		{name: "rolled over twice", size: 3, added: 7, want: []string{"pod-4", "pod-5", "pod-6"}},
+		{name: "disabled", size: 0, added: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newDecisionBuffer(tt.size)
+			for i := 0; i < tt.added; i++ {
+				b.add(recentDecision{Pod: fmt.Sprintf("pod-%d", i)})
+			}
+			got := b.list()
+			if len(got) != len(tt.want) {
+				t.Fatalf("list() = %v, want pods %v", got, tt.want)
+			}
+			for i, d := range got {
+				if d.Pod != tt.want[i] {
+					t.Errorf("list()[%d] = %s, want %s", i, d.Pod, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecisionBufferNil(t *testing.T) {
+	var b *decisionBuffer
+	b.add(recentDecision{Pod: "web"})
+	if got := b.list(); got != nil {
+		t.Errorf("list() = %v, want nil", got)
+	}
+}
+
+func TestDecisionBufferConcurrent(t *testing.T) {
+	const size, writers, perWriter = 16, 8, 100
+	b := newDecisionBuffer(size)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				b.add(recentDecision{Pod: fmt.Sprintf("pod-%d-%d", w, i)})
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				if got := len(b.list()); got > size {
+					t.Errorf("list() has %d entries, more than the size %d", got, size)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := b.list()
+	if len(got) != size {
+		t.Fatalf("list() has %d entries, want %d", len(got), size)
+	}
+	seen := map[string]bool{}
+	for _, d := range got {
+		if d.Pod == "" || seen[d.Pod] {
+			t.Errorf("list() has an empty or duplicate entry %q", d.Pod)
+		}
+		seen[d.Pod] = true
+	}
+}
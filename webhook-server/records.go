@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Behaviors for record annotations the pod already sets
+// (RECORD_ANNOTATION_COLLISION).
+const (
+	recordCollisionKeep      = "keep"
+	recordCollisionOverwrite = "overwrite"
+)
+
+func getRecordCollisionPolicy() (string, error) {
+	policy := getEnv("RECORD_ANNOTATION_COLLISION", recordCollisionKeep)
+	switch policy {
+	case recordCollisionKeep, recordCollisionOverwrite:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid RECORD_ANNOTATION_COLLISION %q: must be %s or %s", policy, recordCollisionKeep, recordCollisionOverwrite)
+}
+
+// addRecordAnnotations adds the annotations recording how the pod was
+// injected to annotations. They only document the injection, so by default
+// a value the pod already has under the same key is kept rather than
+// overwritten; RECORD_ANNOTATION_COLLISION=overwrite stamps them regardless.
+func addRecordAnnotations(pod *corev1.Pod, annotations, records map[string]string) error {
+	policy, err := getRecordCollisionPolicy()
+	if err != nil {
+		return err
+	}
+	for key, value := range records {
+		if existing, ok := pod.Annotations[key]; ok && existing != value && policy == recordCollisionKeep {
+			log.Printf("Pod %s/%s already sets %s=%q, not recording %q", pod.Namespace, pod.Name, key, existing, value)
+			continue
+		}
+		annotations[key] = value
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAddRecordAnnotations(t *testing.T) {
+	existing := map[string]string{annotationWebhookVersion: "custom", "tailscale.com/hostname-record": "web-prod"}
+	records := map[string]string{annotationWebhookVersion: "v2", "tailscale.com/hostname-record": "web-prod", "tailscale.com/new": "x"}
+	tests := []struct {
+		name    string
+		policy  string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "keep",
+			want: map[string]string{"tailscale.com/hostname-record": "web-prod", "tailscale.com/new": "x"},
+		},
+		{
+			name:   "overwrite",
+			policy: recordCollisionOverwrite,
+			want:   map[string]string{annotationWebhookVersion: "v2", "tailscale.com/hostname-record": "web-prod", "tailscale.com/new": "x"},
+		},
+		{name: "invalid", policy: "merge", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RECORD_ANNOTATION_COLLISION", tt.policy)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: existing}}
+			annotations := map[string]string{}
+			err := addRecordAnnotations(pod, annotations, records)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addRecordAnnotations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(annotations, tt.want) {
+				t.Errorf("addRecordAnnotations() = %v, want %v", annotations, tt.want)
+			}
+		})
+	}
+}
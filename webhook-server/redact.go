@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const redacted = "[redacted]"
+
+// defaultRedactedAnnotations may reveal credentials or whole manifests.
+var defaultRedactedAnnotations = []string{
+	annotationAuthKeySecret,
+	annotationAuthKeySecretUsed,
+	"kubectl.kubernetes.io/last-applied-configuration",
+}
+
+// redactionEnabled reports whether LOG_REDACTION is on.
+func redactionEnabled() bool {
+	return getEnv("LOG_REDACTION", "true") != "false"
+}
+
+// redactedAnnotations returns the annotation keys whose values are hidden in
+// logs, the defaults plus LOG_REDACT_ANNOTATIONS.
+func redactedAnnotations() map[string]bool {
+	keys := map[string]bool{}
+	for _, key := range defaultRedactedAnnotations {
+		keys[key] = true
+	}
+	for _, key := range strings.Split(getEnv("LOG_REDACT_ANNOTATIONS", ""), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// sensitiveEnvSuffixes mark env vars whose values are never logged.
+var sensitiveEnvSuffixes = []string{"AUTHKEY", "AUTH_KEY", "_SECRET", "_TOKEN", "_PASSWORD"}
+
+// isSensitiveEnv reports whether an env var carries a credential, such as
+// TS_AUTHKEY or an OAuth client secret.
+func isSensitiveEnv(name string) bool {
+	name = strings.ToUpper(name)
+	for _, suffix := range sensitiveEnvSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor scrubs an unmarshaled JSON document in place.
+type redactor struct {
+	// secretRefs also hides referenced secret names and sensitive
+	// annotations, as configured by LOG_REDACTION.
+	secretRefs  bool
+	annotations map[string]bool
+}
+
+// redactForLog marshals a pod-derived structure, such as a pod, a container,
+// or a patch, for logging. Values of sensitive env vars are always replaced.
+// With LOG_REDACTION on, secret names referenced from env vars, envFrom, and
+// volumes, and the values of sensitive annotations are replaced too.
+func redactForLog(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return string(data)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return redacted
+	}
+	r := redactor{secretRefs: redactionEnabled()}
+	if r.secretRefs {
+		r.annotations = redactedAnnotations()
+	}
+	r.redact(doc)
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return redacted
+	}
+	return string(data)
+}
+
+// hidesEnv reports whether the value of the named env var is redacted.
+// TS_KUBE_SECRET holds a secret name rather than a credential.
+func (r redactor) hidesEnv(name string) bool {
+	if name == "TS_KUBE_SECRET" {
+		return r.secretRefs
+	}
+	return isSensitiveEnv(name)
+}
+
+func (r redactor) redact(v interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			r.redact(item)
+		}
+	case map[string]interface{}:
+		// Env vars
+		if name, ok := v["name"].(string); ok && r.hidesEnv(name) {
+			if _, ok := v["value"]; ok {
+				v["value"] = redacted
+			}
+		}
+		// Patch operations on a single annotation
+		if path, ok := v["path"].(string); ok && strings.HasPrefix(path, "/metadata/annotations/") {
+			key := strings.TrimPrefix(path, "/metadata/annotations/")
+			key = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+			if r.annotations[key] {
+				v["value"] = redacted
+			}
+		}
+		for key, value := range v {
+			if r.secretRefs {
+				switch key {
+				case "secretKeyRef", "secretRef":
+					if ref, ok := value.(map[string]interface{}); ok {
+						ref["name"] = redacted
+					}
+				case "secret":
+					if source, ok := value.(map[string]interface{}); ok {
+						source["secretName"] = redacted
+					}
+				case "annotations":
+					if entries, ok := value.(map[string]interface{}); ok {
+						for name := range entries {
+							if r.annotations[name] {
+								entries[name] = redacted
+							}
+						}
+					}
+				}
+			}
+			r.redact(value)
+		}
+	}
+}
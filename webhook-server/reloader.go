@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	configReloaderName = "ts-config-reloader"
+	configVolumeName   = "ts-config"
+)
+
+// getConfigReloader returns the shared config volume when
+// TS_CONFIG_RELOADER=true, or nil otherwise. The config comes from the
+// TS_CONFIG_CONFIGMAP ConfigMap and is mounted at TS_CONFIG_DIR. tailscaled
+// watches TS_EXPERIMENTAL_VERSIONED_CONFIG_DIR itself, so the kubelet
+// updating the ConfigMap volume is enough to reload the config; a companion
+// container is only returned when TS_CONFIG_RELOADER_COMMAND is set, e.g. to
+// render the config from another source.
+func getConfigReloader() (*corev1.Container, *corev1.Volume, error) {
+	if getEnv("TS_CONFIG_RELOADER", "false") != "true" {
+		return nil, nil, nil
+	}
+
+	command, err := splitArgs(getEnv("TS_CONFIG_RELOADER_COMMAND", ""))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid TS_CONFIG_RELOADER_COMMAND: %v", err)
+	}
+	configDir := getEnv("TS_CONFIG_DIR", "/etc/tailscale/config")
+
+	volume := &corev1.Volume{
+		Name: configVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: getEnv("TS_CONFIG_CONFIGMAP", "tailscale-config"),
+				},
+			},
+		},
+	}
+	if len(command) == 0 {
+		return nil, volume, nil
+	}
+	reloader := &corev1.Container{
+		Name:    configReloaderName,
+		Image:   getEnv("TS_CONFIG_RELOADER_IMAGE", "busybox:1.36"),
+		Command: command,
+		Env: []corev1.EnvVar{
+			{Name: "TS_CONFIG_DIR", Value: configDir},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: configVolumeName, MountPath: configDir, ReadOnly: true},
+		},
+	}
+	return reloader, volume, nil
+}
+
+// applyConfigReloader points the sidecar at the shared file based config.
+func applyConfigReloader(sidecar *corev1.Container) {
+	configDir := getEnv("TS_CONFIG_DIR", "/etc/tailscale/config")
+	setEnvVar(sidecar, "TS_EXPERIMENTAL_VERSIONED_CONFIG_DIR", configDir)
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      configVolumeName,
+		MountPath: configDir,
+		ReadOnly:  true,
+	})
+}
+
+// configReloaderSharesProcesses reports whether
+// TS_CONFIG_RELOADER_SHARE_PROCESS_NAMESPACE=true, for companion commands
+// signaling tailscaled. Sharing the process namespace exposes tailscaled to
+// every container of the pod, so it is never enabled implicitly.
+func configReloaderSharesProcesses() bool {
+	return getEnv("TS_CONFIG_RELOADER_SHARE_PROCESS_NAMESPACE", "false") == "true"
+}
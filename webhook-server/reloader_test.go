@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetConfigReloader(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		wantVolume    bool
+		wantCompanion []string
+		wantErr       bool
+	}{
+		{name: "disabled"},
+		{
+			name:       "volume only by default",
+			env:        map[string]string{"TS_CONFIG_RELOADER": "true"},
+			wantVolume: true,
+		},
+		{
+			name:          "companion with command",
+			env:           map[string]string{"TS_CONFIG_RELOADER": "true", "TS_CONFIG_RELOADER_COMMAND": "sh -c 'render-config'"},
+			wantVolume:    true,
+			wantCompanion: []string{"sh", "-c", "render-config"},
+		},
+		{
+			name:    "invalid command",
+			env:     map[string]string{"TS_CONFIG_RELOADER": "true", "TS_CONFIG_RELOADER_COMMAND": "sh -c 'unterminated"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_CONFIG_RELOADER", "false")
+			t.Setenv("TS_CONFIG_RELOADER_COMMAND", "")
+			t.Setenv("TS_CONFIG_CONFIGMAP", "my-config")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			reloader, volume, err := getConfigReloader()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getConfigReloader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (volume != nil) != tt.wantVolume {
+				t.Fatalf("volume = %v, want volume %v", volume, tt.wantVolume)
+			}
+			if volume != nil && (volume.Name != configVolumeName || volume.ConfigMap == nil || volume.ConfigMap.Name != "my-config") {
+				t.Errorf("volume = %+v, want ConfigMap my-config named %s", volume, configVolumeName)
+			}
+			if tt.wantCompanion == nil {
+				if reloader != nil {
+					t.Errorf("reloader = %+v, want none", reloader)
+				}
+				return
+			}
+			if reloader == nil {
+				t.Fatal("reloader = nil, want a companion")
+			}
+			if !reflect.DeepEqual(reloader.Command, tt.wantCompanion) {
+				t.Errorf("reloader command = %q, want %q", reloader.Command, tt.wantCompanion)
+			}
+			if len(reloader.VolumeMounts) != 1 || reloader.VolumeMounts[0].Name != configVolumeName || !reloader.VolumeMounts[0].ReadOnly {
+				t.Errorf("reloader mounts = %+v, want the config volume read-only", reloader.VolumeMounts)
+			}
+		})
+	}
+}
+
+func TestConfigReloaderProcessNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		share     string
+		wantShare bool
+	}{
+		{name: "no companion"},
+		{name: "companion", command: "render-config"},
+		{name: "companion sharing processes", command: "render-config", share: "true", wantShare: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_CONFIG_RELOADER", "true")
+			t.Setenv("TS_CONFIG_RELOADER_COMMAND", tt.command)
+			t.Setenv("TS_CONFIG_RELOADER_SHARE_PROCESS_NAMESPACE", tt.share)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}},
+			}
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var shared, companion bool
+			for _, patch := range patches {
+				if patch.Path == "/spec/shareProcessNamespace" {
+					shared = true
+				}
+				if container, ok := patch.Value.(corev1.Container); ok && container.Name == configReloaderName {
+					companion = true
+				}
+			}
+			if shared != tt.wantShare {
+				t.Errorf("shareProcessNamespace patched = %v, want %v", shared, tt.wantShare)
+			}
+			if companion != (tt.command != "") {
+				t.Errorf("companion injected = %v, want %v", companion, tt.command != "")
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// parseResourceSpec parses a comma separated resource spec such as
+// "requests.cpu=50m,requests.memory=64Mi,limits.memory=256Mi".
+func parseResourceSpec(spec string) (corev1.ResourceRequirements, error) {
+	resources := corev1.ResourceRequirements{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return resources, fmt.Errorf("invalid resource entry %q: expected <requests|limits>.<resource>=<quantity>", item)
+		}
+		kind, name, ok := strings.Cut(strings.TrimSpace(key), ".")
+		if !ok || name == "" {
+			return resources, fmt.Errorf("invalid resource key %q: expected <requests|limits>.<resource>", key)
+		}
+		quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+		if err != nil {
+			return resources, fmt.Errorf("invalid quantity for %s: %v", key, err)
+		}
+		switch kind {
+		case "requests":
+			if resources.Requests == nil {
+				resources.Requests = corev1.ResourceList{}
+			}
+			resources.Requests[corev1.ResourceName(name)] = quantity
+		case "limits":
+			if resources.Limits == nil {
+				resources.Limits = corev1.ResourceList{}
+			}
+			resources.Limits[corev1.ResourceName(name)] = quantity
+		default:
+			return resources, fmt.Errorf("invalid resource key %q: must start with requests. or limits.", key)
+		}
+	}
+	return resources, nil
+}
+
+// getSidecarResources returns the sidecar resources for the networking mode.
+// The profile resources take precedence over TS_RESOURCES_KERNEL and
+// TS_RESOURCES_USERSPACE, which take precedence over the mode independent
+// TS_RESOURCES. With TS_GUARANTEED_QOS=true the requests of limited resources
+// are set to match the limits so the sidecar qualifies for the Guaranteed QoS
+// class, which needs both a cpu and a memory limit.
+func getSidecarResources(mode string, profile *sidecarProfile) (corev1.ResourceRequirements, error) {
+	source := "TS_RESOURCES_" + strings.ToUpper(mode)
+	spec := os.Getenv(source)
+	if spec == "" {
+		source = "TS_RESOURCES"
+		spec = getEnv(source, "")
+	}
+	if profile != nil && profile.Resources != "" {
+		source = "profile resources"
+		spec = profile.Resources
+	}
+
+	resources, err := parseResourceSpec(spec)
+	if err != nil {
+		return resources, fmt.Errorf("invalid %s: %v", source, err)
+	}
+
+	if getEnv("TS_GUARANTEED_QOS", "false") == "true" {
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := resources.Limits[name]; !ok {
+				return resources, fmt.Errorf("TS_GUARANTEED_QOS requires a %s limit in %s, the sidecar is not Guaranteed without one", name, source)
+			}
+		}
+		// Requests without a limit, such as ephemeral-storage, are kept
+		if resources.Requests == nil {
+			resources.Requests = corev1.ResourceList{}
+		}
+		for name, limit := range resources.Limits {
+			resources.Requests[name] = limit.DeepCopy()
+		}
+	}
+	return resources, nil
+}
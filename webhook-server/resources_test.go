@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestGetSidecarResourcesGuaranteedQoS(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec         string
+		guaranteed   string
+		wantRequests map[corev1.ResourceName]string
+		wantErr      bool
+	}{
+		{
+			name:         "requests kept without guaranteed QoS",
+			spec:         "requests.cpu=50m,limits.cpu=200m",
+			guaranteed:   "false",
+			wantRequests: map[corev1.ResourceName]string{corev1.ResourceCPU: "50m"},
+		},
+		{
+			name:         "requests raised to limits",
+			spec:         "requests.cpu=50m,limits.cpu=200m,limits.memory=256Mi",
+			guaranteed:   "true",
+			wantRequests: map[corev1.ResourceName]string{corev1.ResourceCPU: "200m", corev1.ResourceMemory: "256Mi"},
+		},
+		{
+			name:       "requests without limit kept",
+			spec:       "requests.ephemeral-storage=1Gi,limits.cpu=200m,limits.memory=256Mi",
+			guaranteed: "true",
+			wantRequests: map[corev1.ResourceName]string{
+				corev1.ResourceEphemeralStorage: "1Gi",
+				corev1.ResourceCPU:              "200m",
+				corev1.ResourceMemory:           "256Mi",
+			},
+		},
+		{
+			name:       "cpu limit only",
+			spec:       "requests.cpu=50m,limits.cpu=200m",
+			guaranteed: "true",
+			wantErr:    true,
+		},
+		{
+			name:       "memory limit only",
+			spec:       "limits.memory=256Mi",
+			guaranteed: "true",
+			wantErr:    true,
+		},
+		{
+			name:       "limits required",
+			spec:       "requests.cpu=50m",
+			guaranteed: "true",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_RESOURCES", tt.spec)
+			t.Setenv("TS_GUARANTEED_QOS", tt.guaranteed)
+			resources, err := getSidecarResources(networkingModeKernel, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getSidecarResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(resources.Requests) != len(tt.wantRequests) {
+				t.Errorf("requests = %v, want %v", resources.Requests, tt.wantRequests)
+			}
+			for name, want := range tt.wantRequests {
+				got, ok := resources.Requests[name]
+				if !ok || got.Cmp(resource.MustParse(want)) != 0 {
+					t.Errorf("requests[%s] = %s, want %s", name, got.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetSidecarResourcesByMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		global    string
+		kernel    string
+		userspace string
+		profile   string
+		wantCPU   string
+		wantErr   bool
+	}{
+		{name: "unset", mode: networkingModeKernel},
+		{name: "global kernel", mode: networkingModeKernel, global: "requests.cpu=50m", wantCPU: "50m"},
+		{name: "global userspace", mode: networkingModeUserspace, global: "requests.cpu=50m", wantCPU: "50m"},
+		{name: "kernel overrides global", mode: networkingModeKernel, global: "requests.cpu=50m", kernel: "requests.cpu=100m", userspace: "requests.cpu=200m", wantCPU: "100m"},
+		{name: "userspace overrides global", mode: networkingModeUserspace, global: "requests.cpu=50m", kernel: "requests.cpu=100m", userspace: "requests.cpu=200m", wantCPU: "200m"},
+		{name: "other mode ignored", mode: networkingModeKernel, global: "requests.cpu=50m", userspace: "requests.cpu=200m", wantCPU: "50m"},
+		{name: "profile overrides mode", mode: networkingModeUserspace, userspace: "requests.cpu=200m", profile: "requests.cpu=10m", wantCPU: "10m"},
+		{name: "invalid mode spec", mode: networkingModeKernel, global: "requests.cpu=50m", kernel: "cpu=100m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_RESOURCES", tt.global)
+			t.Setenv("TS_RESOURCES_KERNEL", tt.kernel)
+			t.Setenv("TS_RESOURCES_USERSPACE", tt.userspace)
+			t.Setenv("TS_GUARANTEED_QOS", "false")
+			resources, err := getSidecarResources(tt.mode, &sidecarProfile{Resources: tt.profile})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getSidecarResources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			got, ok := resources.Requests[corev1.ResourceCPU]
+			if tt.wantCPU == "" {
+				if ok {
+					t.Errorf("requests.cpu = %s, want unset", got.String())
+				}
+				return
+			}
+			if !ok || got.Cmp(resource.MustParse(tt.wantCPU)) != 0 {
+				t.Errorf("requests.cpu = %s, want %s", got.String(), tt.wantCPU)
+			}
+		})
+	}
+}
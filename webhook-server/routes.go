@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const annotationAdvertiseRoutes = "tailscale.com/advertise-routes"
+
+// getAdvertiseRoutes parses the comma separated CIDRs from the
+// tailscale.com/advertise-routes annotation. Every route must be a valid
+// CIDR, otherwise the pod is denied with the annotation as the field path.
+func getAdvertiseRoutes(pod *corev1.Pod) ([]string, error) {
+	value := pod.Annotations[annotationAdvertiseRoutes]
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var routes []string
+	for _, route := range strings.Split(value, ",") {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(route)
+		if err != nil {
+			return nil, field.Invalid(annotationPath(annotationAdvertiseRoutes), route, "must be a valid CIDR, e.g. 10.0.0.0/24")
+		}
+		if ipNet.String() != route {
+			return nil, field.Invalid(annotationPath(annotationAdvertiseRoutes), route, fmt.Sprintf("host bits must be zero, did you mean %s?", ipNet))
+		}
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// getMaxRoutes returns TS_MAX_ROUTES, the most subnet routes a pod may
+// advertise (0 for unlimited), and whether TS_MAX_ROUTES_POLICY=truncate
+// drops the excess routes instead of rejecting the pod.
+func getMaxRoutes() (int, bool, error) {
+	value := getEnv("TS_MAX_ROUTES", "0")
+	max, err := strconv.Atoi(value)
+	if err != nil || max < 0 {
+		return 0, false, fmt.Errorf("invalid TS_MAX_ROUTES %q: must be a non-negative integer", value)
+	}
+	switch policy := getEnv("TS_MAX_ROUTES_POLICY", "reject"); policy {
+	case "reject":
+		return max, false, nil
+	case "truncate":
+		return max, true, nil
+	default:
+		return 0, false, fmt.Errorf("invalid TS_MAX_ROUTES_POLICY %q: must be reject or truncate", policy)
+	}
+}
+
+// limitRoutes enforces TS_MAX_ROUTES on routes, so that a single pod cannot
+// bloat the control server with subnet routes. Over the cap, the pod is
+// rejected or, with the truncate policy, the first routes are kept and a
+// warning is returned.
+func limitRoutes(routes []string) ([]string, string, error) {
+	max, truncate, err := getMaxRoutes()
+	if err != nil {
+		return nil, "", err
+	}
+	if max == 0 || len(routes) <= max {
+		return routes, "", nil
+	}
+	if !truncate {
+		return nil, "", field.TooMany(annotationPath(annotationAdvertiseRoutes), len(routes), max)
+	}
+	log.Printf("Truncating %d advertised routes to TS_MAX_ROUTES=%d", len(routes), max)
+	return routes[:max], fmt.Sprintf("only the first %d of %d routes in %s are advertised (TS_MAX_ROUTES)", max, len(routes), annotationAdvertiseRoutes), nil
+}
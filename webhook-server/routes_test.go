@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetAdvertiseRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "blank", value: "  "},
+		{name: "routes", value: "10.0.0.0/24, fd00::/64,", want: []string{"10.0.0.0/24", "fd00::/64"}},
+		{name: "not a CIDR", value: "10.0.0.0", wantErr: true},
+		{name: "host bits", value: "10.0.0.1/24", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annotationAdvertiseRoutes: tt.value}}}
+			got, err := getAdvertiseRoutes(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAdvertiseRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getAdvertiseRoutes() = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr {
+				causes := statusCauses(err)
+				if len(causes) != 1 || causes[0].Field != "metadata.annotations[tailscale.com/advertise-routes]" {
+					t.Errorf("statusCauses() = %+v, want the advertise-routes annotation", causes)
+				}
+			}
+		})
+	}
+}
+
+func TestLimitRoutes(t *testing.T) {
+	routes := []string{"10.0.0.0/24", "10.0.1.0/24", "10.0.2.0/24"}
+	tests := []struct {
+		name        string
+		max         string
+		policy      string
+		want        []string
+		wantWarning bool
+		wantErr     bool
+	}{
+		{name: "unlimited", want: routes},
+		{name: "within cap", max: "3", want: routes},
+		{name: "reject", max: "2", wantErr: true},
+		{name: "truncate", max: "2", policy: "truncate", want: routes[:2], wantWarning: true},
+		{name: "invalid max", max: "-1", wantErr: true},
+		{name: "invalid policy", max: "2", policy: "drop", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_MAX_ROUTES", tt.max)
+			t.Setenv("TS_MAX_ROUTES_POLICY", tt.policy)
+			got, warning, err := limitRoutes(routes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("limitRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("limitRoutes() = %q, want %q", got, tt.want)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("limitRoutes() warning = %q, want %v", warning, tt.wantWarning)
+			}
+		})
+	}
+}
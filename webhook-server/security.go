@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	annotationPrivileged            = "tailscale.com/privileged"
+	annotationAcknowledgePrivileged = "tailscale.com/acknowledge-privileged"
+)
+
+// Behaviors for pods whose pod-level security context rules out a root,
+// privileged sidecar (TS_RESTRICTED_POD_MODE).
+const (
+	restrictedPodWarn     = "warn"
+	restrictedPodFallback = "fallback"
+)
+
+// Behaviors for pods sharing the node's PID or IPC namespace
+// (HOST_NAMESPACE_POLICY).
+const (
+	hostNamespaceAllow = "allow"
+	hostNamespaceWarn  = "warn"
+	hostNamespaceDeny  = "deny"
+)
+
+// hasRestrictiveSecurityContext reports whether the pod-level security
+// context forces containers to run as non-root. The pod-level settings also
+// apply to the sidecar, so a kernel mode tailscaled would fail to start.
+func hasRestrictiveSecurityContext(pod *corev1.Pod) bool {
+	sc := pod.Spec.SecurityContext
+	if sc == nil {
+		return false
+	}
+	if sc.RunAsNonRoot != nil && *sc.RunAsNonRoot {
+		return true
+	}
+	return sc.RunAsUser != nil && *sc.RunAsUser != 0
+}
+
+// resolveRestrictedMode adjusts the networking mode for pods with a
+// restrictive security context. With TS_RESTRICTED_POD_MODE=fallback a
+// kernel mode sidecar is switched to userspace unless the pod explicitly
+// asked for kernel mode; otherwise a warning is logged.
+func resolveRestrictedMode(pod *corev1.Pod, mode string) string {
+	if mode != networkingModeKernel || !hasRestrictiveSecurityContext(pod) {
+		return mode
+	}
+
+	_, explicitMode := pod.Annotations[annotationNetworkingMode]
+	_, explicitUserspace := pod.Annotations[annotationUserspace]
+	explicit := explicitMode || explicitUserspace
+	if getEnv("TS_RESTRICTED_POD_MODE", restrictedPodWarn) == restrictedPodFallback && !explicit {
+		log.Printf("Pod %s/%s runs as non-root, falling back to userspace networking", pod.Namespace, pod.Name)
+		return networkingModeUserspace
+	}
+	log.Printf("Warning: pod %s/%s runs as non-root, the privileged kernel mode sidecar may fail to start", pod.Namespace, pod.Name)
+	return mode
+}
+
+// checkPrivilegedAllowed denies privileged sidecars, which kernel mode needs,
+// when ALLOW_PRIVILEGED=false. Clusters enforcing restricted pod security
+// would reject such pods anyway, so fail early with guidance.
+func checkPrivilegedAllowed(privileged bool) error {
+	if !privileged || getEnv("ALLOW_PRIVILEGED", "true") != "false" {
+		return nil
+	}
+	return fmt.Errorf("privileged sidecars are not allowed in this cluster, set the %s annotation to %s to use unprivileged userspace networking", annotationNetworkingMode, networkingModeUserspace)
+}
+
+// privilegedWarning returns the admission warning for a privileged sidecar
+// when WARN_PRIVILEGED=true. Pods annotated with
+// tailscale.com/acknowledge-privileged=true get no warning, which is logged at
+// debug level so the suppression stays auditable.
+func privilegedWarning(pod *corev1.Pod) string {
+	if getEnv("WARN_PRIVILEGED", "false") != "true" {
+		return ""
+	}
+	if pod.Annotations[annotationAcknowledgePrivileged] == "true" {
+		debugf("Pod %s/%s acknowledged the privileged sidecar, not warning", pod.Namespace, pod.Name)
+		return ""
+	}
+	log.Printf("Warning: injecting a privileged sidecar into pod %s/%s", pod.Namespace, pod.Name)
+	return fmt.Sprintf("the Tailscale sidecar runs privileged, set %s=%s for an unprivileged sidecar or %s=true to acknowledge", annotationNetworkingMode, networkingModeUserspace, annotationAcknowledgePrivileged)
+}
+
+// sharedProcessNamespaceWarning returns an admission warning when the pod
+// shares its process namespace. Every container shares the pod's network
+// namespace regardless, but with a shared process namespace the app
+// containers also see tailscaled and, for a privileged sidecar, can reach
+// its root filesystem through /proc.
+func sharedProcessNamespaceWarning(pod *corev1.Pod, privileged bool) string {
+	if pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace {
+		return ""
+	}
+	log.Printf("Pod %s/%s shares its process namespace, tailscaled is visible to all of its containers", pod.Namespace, pod.Name)
+	if privileged {
+		return "the pod sets shareProcessNamespace, so its containers can see the privileged tailscaled process and its filesystem through /proc"
+	}
+	return "the pod sets shareProcessNamespace, so its containers can see the tailscaled process"
+}
+
+func getHostNamespacePolicy() (string, error) {
+	policy := getEnv("HOST_NAMESPACE_POLICY", hostNamespaceAllow)
+	switch policy {
+	case hostNamespaceAllow, hostNamespaceWarn, hostNamespaceDeny:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid HOST_NAMESPACE_POLICY %q: must be %s, %s, or %s", policy, hostNamespaceAllow, hostNamespaceWarn, hostNamespaceDeny)
+}
+
+// hostNamespaces returns the node namespaces the pod shares, "hostPID" and
+// "hostIPC", in that order.
+func hostNamespaces(pod *corev1.Pod) []string {
+	var shared []string
+	if pod.Spec.HostPID {
+		shared = append(shared, "hostPID")
+	}
+	if pod.Spec.HostIPC {
+		shared = append(shared, "hostIPC")
+	}
+	return shared
+}
+
+// checkHostNamespaces applies HOST_NAMESPACE_POLICY to pods that share the
+// node's PID or IPC namespace, where a sidecar, privileged in kernel mode,
+// can see and signal every process on the node. It returns an admission
+// warning with the warn policy and an error with the deny policy.
+func checkHostNamespaces(pod *corev1.Pod) (string, error) {
+	shared := hostNamespaces(pod)
+	if len(shared) == 0 {
+		return "", nil
+	}
+	policy, err := getHostNamespacePolicy()
+	if err != nil {
+		return "", err
+	}
+	switch policy {
+	case hostNamespaceWarn:
+		log.Printf("Warning: pod %s/%s sets %s, the sidecar shares the node's namespaces", pod.Namespace, pod.Name, strings.Join(shared, " and "))
+		return fmt.Sprintf("the pod sets %s, so the Tailscale sidecar shares the node's namespaces", strings.Join(shared, " and ")), nil
+	case hostNamespaceDeny:
+		var errs field.ErrorList
+		for _, name := range shared {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", name), "the Tailscale sidecar is not injected into pods sharing the node's namespaces, ask an administrator to allow them with HOST_NAMESPACE_POLICY"))
+		}
+		return "", errs.ToAggregate()
+	}
+	return "", nil
+}
+
+// getPrivileged decides whether the sidecar container is privileged,
+// independently of the networking mode: the tailscale.com/privileged
+// annotation wins, then the profile, and by default kernel mode is privileged
+// and userspace mode is not.
+func getPrivileged(pod *corev1.Pod, profile *sidecarProfile, userspace bool) (bool, error) {
+	if value, ok := pod.Annotations[annotationPrivileged]; ok {
+		privileged, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return false, field.Invalid(annotationPath(annotationPrivileged), value, "must be true or false")
+		}
+		return privileged, nil
+	}
+	if value := profile.privileged(); value != nil {
+		return *value, nil
+	}
+	return !userspace, nil
+}
+
+// getSeccompProfile parses TS_SECCOMP_PROFILE: RuntimeDefault, Unconfined, or
+// Localhost/<profile path>. It returns nil when unset.
+func getSeccompProfile() (*corev1.SeccompProfile, error) {
+	value := getEnv("TS_SECCOMP_PROFILE", "")
+	if value == "" {
+		return nil, nil
+	}
+	profileType, path, _ := strings.Cut(value, "/")
+	switch corev1.SeccompProfileType(profileType) {
+	case corev1.SeccompProfileTypeRuntimeDefault, corev1.SeccompProfileTypeUnconfined:
+		if path != "" {
+			return nil, fmt.Errorf("invalid TS_SECCOMP_PROFILE %q: only Localhost profiles take a path", value)
+		}
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileType(profileType)}, nil
+	case corev1.SeccompProfileTypeLocalhost:
+		if path == "" {
+			return nil, fmt.Errorf("invalid TS_SECCOMP_PROFILE %q: Localhost requires a profile path, e.g. Localhost/profiles/tailscale.json", value)
+		}
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeLocalhost, LocalhostProfile: &path}, nil
+	}
+	return nil, fmt.Errorf("invalid TS_SECCOMP_PROFILE %q: must be RuntimeDefault, Unconfined, or Localhost/<path>", value)
+}
+
+// getSecurityContext builds the sidecar security context from the profile.
+// An unprivileged kernel mode sidecar gets NET_ADMIN so tailscaled can still
+// configure the TUN device and routes, provided /dev/net/tun is available.
+// Unprivileged sidecars also get the seccomp profile, unless the profile
+// sets one; privileged containers are not confined by seccomp anyway.
+func getSecurityContext(profile *sidecarProfile, userspace, privileged bool, seccomp *corev1.SeccompProfile) *corev1.SecurityContext {
+	securityContext := &corev1.SecurityContext{}
+	if profile.SecurityContext != nil {
+		securityContext = profile.SecurityContext.DeepCopy()
+	}
+	securityContext.Privileged = boolPtr(privileged)
+	if !userspace && !privileged {
+		if securityContext.Capabilities == nil {
+			securityContext.Capabilities = &corev1.Capabilities{}
+		}
+		if !hasCapability(securityContext.Capabilities.Add, "NET_ADMIN") {
+			securityContext.Capabilities.Add = append(securityContext.Capabilities.Add, "NET_ADMIN")
+		}
+	}
+	if !privileged && seccomp != nil && securityContext.SeccompProfile == nil {
+		securityContext.SeccompProfile = seccomp.DeepCopy()
+	}
+	return securityContext
+}
+
+func hasCapability(capabilities []corev1.Capability, capability corev1.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
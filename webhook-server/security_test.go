@@ -0,0 +1,276 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveRestrictedMode(t *testing.T) {
+	nonRoot := &corev1.PodSecurityContext{RunAsNonRoot: boolPtr(true)}
+	uid := int64(1000)
+	tests := []struct {
+		name        string
+		policy      string
+		mode        string
+		sc          *corev1.PodSecurityContext
+		annotations map[string]string
+		want        string
+	}{
+		{name: "root pod", policy: restrictedPodFallback, mode: networkingModeKernel, want: networkingModeKernel},
+		{name: "warn", mode: networkingModeKernel, sc: nonRoot, want: networkingModeKernel},
+		{name: "fallback", policy: restrictedPodFallback, mode: networkingModeKernel, sc: nonRoot, want: networkingModeUserspace},
+		{name: "fallback run as user", policy: restrictedPodFallback, mode: networkingModeKernel, sc: &corev1.PodSecurityContext{RunAsUser: &uid}, want: networkingModeUserspace},
+		{
+			name:        "explicit kernel",
+			policy:      restrictedPodFallback,
+			mode:        networkingModeKernel,
+			sc:          nonRoot,
+			annotations: map[string]string{annotationNetworkingMode: networkingModeKernel},
+			want:        networkingModeKernel,
+		},
+		{name: "already userspace", policy: restrictedPodFallback, mode: networkingModeUserspace, sc: nonRoot, want: networkingModeUserspace},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_RESTRICTED_POD_MODE", tt.policy)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{SecurityContext: tt.sc},
+			}
+			if got := resolveRestrictedMode(pod, tt.mode); got != tt.want {
+				t.Errorf("resolveRestrictedMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPrivilegedAllowed(t *testing.T) {
+	tests := []struct {
+		allow      string
+		privileged bool
+		wantErr    bool
+	}{
+		{privileged: true},
+		{allow: "true", privileged: true},
+		{allow: "false", privileged: true, wantErr: true},
+		{allow: "false"},
+	}
+	for _, tt := range tests {
+		t.Setenv("ALLOW_PRIVILEGED", tt.allow)
+		if err := checkPrivilegedAllowed(tt.privileged); (err != nil) != tt.wantErr {
+			t.Errorf("checkPrivilegedAllowed(%v) with ALLOW_PRIVILEGED=%q error = %v, wantErr %v", tt.privileged, tt.allow, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGetPrivileged(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		profile     sidecarProfile
+		userspace   bool
+		want        bool
+		wantErr     bool
+	}{
+		{name: "kernel default", want: true},
+		{name: "userspace default", userspace: true},
+		{name: "annotation", annotations: map[string]string{annotationPrivileged: "false"}},
+		{name: "annotation wins over profile", annotations: map[string]string{annotationPrivileged: "true"}, profile: sidecarProfile{Privileged: boolPtr(false)}, userspace: true, want: true},
+		{name: "profile", profile: sidecarProfile{Privileged: boolPtr(false)}},
+		{name: "profile security context", profile: sidecarProfile{SecurityContext: &corev1.SecurityContext{Privileged: boolPtr(false)}}},
+		{name: "invalid annotation", annotations: map[string]string{annotationPrivileged: "sometimes"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getPrivileged(pod, &tt.profile, tt.userspace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPrivileged() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getPrivileged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSecurityContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		profile      sidecarProfile
+		userspace    bool
+		privileged   bool
+		wantNetAdmin bool
+	}{
+		{name: "privileged kernel", privileged: true},
+		{name: "unprivileged kernel", wantNetAdmin: true},
+		{name: "userspace", userspace: true},
+		{
+			name:         "profile capabilities kept",
+			profile:      sidecarProfile{SecurityContext: &corev1.SecurityContext{Capabilities: &corev1.Capabilities{Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"}}}},
+			wantNetAdmin: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := getSecurityContext(&tt.profile, tt.userspace, tt.privileged, nil)
+			if sc.Privileged == nil || *sc.Privileged != tt.privileged {
+				t.Errorf("getSecurityContext() privileged = %v, want %v", sc.Privileged, tt.privileged)
+			}
+			netAdmin := 0
+			if sc.Capabilities != nil {
+				for _, c := range sc.Capabilities.Add {
+					if c == "NET_ADMIN" {
+						netAdmin++
+					}
+				}
+			}
+			if want := map[bool]int{true: 1, false: 0}[tt.wantNetAdmin]; netAdmin != want {
+				t.Errorf("getSecurityContext() adds NET_ADMIN %d times, want %d", netAdmin, want)
+			}
+			if tt.profile.SecurityContext != nil && tt.profile.SecurityContext.Privileged != nil {
+				t.Error("getSecurityContext() modified the profile")
+			}
+		})
+	}
+}
+
+func TestPrivilegedWarning(t *testing.T) {
+	tests := []struct {
+		name        string
+		warn        string
+		annotations map[string]string
+		wantWarning bool
+	}{
+		{name: "disabled"},
+		{name: "warns", warn: "true", wantWarning: true},
+		{name: "acknowledged", warn: "true", annotations: map[string]string{annotationAcknowledgePrivileged: "true"}},
+		{name: "not acknowledged", warn: "true", annotations: map[string]string{annotationAcknowledgePrivileged: "yes"}, wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WARN_PRIVILEGED", tt.warn)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			if got := privilegedWarning(pod); (got != "") != tt.wantWarning {
+				t.Errorf("privilegedWarning() = %q, want warning %v", got, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestGetSeccompProfile(t *testing.T) {
+	tests := []struct {
+		value     string
+		wantType  corev1.SeccompProfileType
+		wantLocal string
+		wantErr   bool
+	}{
+		{value: ""},
+		{value: "RuntimeDefault", wantType: corev1.SeccompProfileTypeRuntimeDefault},
+		{value: "Unconfined", wantType: corev1.SeccompProfileTypeUnconfined},
+		{value: "Localhost/profiles/tailscale.json", wantType: corev1.SeccompProfileTypeLocalhost, wantLocal: "profiles/tailscale.json"},
+		{value: "Localhost", wantErr: true},
+		{value: "RuntimeDefault/x.json", wantErr: true},
+		{value: "runtime/default", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TS_SECCOMP_PROFILE", tt.value)
+			got, err := getSeccompProfile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getSeccompProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantType == "" {
+				if got != nil {
+					t.Errorf("getSeccompProfile() = %+v, want nil", got)
+				}
+				return
+			}
+			if got.Type != tt.wantType || (tt.wantLocal != "" && (got.LocalhostProfile == nil || *got.LocalhostProfile != tt.wantLocal)) {
+				t.Errorf("getSeccompProfile() = %+v, want %s %s", got, tt.wantType, tt.wantLocal)
+			}
+		})
+	}
+
+	seccomp := &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	if sc := getSecurityContext(&sidecarProfile{}, true, false, seccomp); sc.SeccompProfile == nil || sc.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("unprivileged sidecar seccomp = %+v, want RuntimeDefault", sc.SeccompProfile)
+	}
+	if sc := getSecurityContext(&sidecarProfile{}, false, true, seccomp); sc.SeccompProfile != nil {
+		t.Errorf("privileged sidecar seccomp = %+v, want none", sc.SeccompProfile)
+	}
+	own := &sidecarProfile{SecurityContext: &corev1.SecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}}}
+	if sc := getSecurityContext(own, true, false, seccomp); sc.SeccompProfile.Type != corev1.SeccompProfileTypeUnconfined {
+		t.Errorf("profile seccomp = %+v, want the profile's Unconfined", sc.SeccompProfile)
+	}
+}
+
+func TestSharedProcessNamespaceWarning(t *testing.T) {
+	tests := []struct {
+		name       string
+		share      *bool
+		privileged bool
+		wantProc   bool
+		wantAny    bool
+	}{
+		{name: "unset", privileged: true},
+		{name: "not shared", share: boolPtr(false), privileged: true},
+		{name: "shared", share: boolPtr(true), wantAny: true},
+		{name: "shared privileged", share: boolPtr(true), privileged: true, wantAny: true, wantProc: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{ShareProcessNamespace: tt.share}}
+			got := sharedProcessNamespaceWarning(pod, tt.privileged)
+			if (got != "") != tt.wantAny {
+				t.Fatalf("sharedProcessNamespaceWarning() = %q, want warning %v", got, tt.wantAny)
+			}
+			if strings.Contains(got, "/proc") != tt.wantProc {
+				t.Errorf("sharedProcessNamespaceWarning() = %q, want /proc mentioned %v", got, tt.wantProc)
+			}
+		})
+	}
+}
+
+func TestCheckHostNamespaces(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		hostPID     bool
+		hostIPC     bool
+		wantWarning bool
+		wantFields  []string
+		wantErr     bool
+	}{
+		{name: "not shared", policy: hostNamespaceDeny},
+		{name: "allow", hostPID: true},
+		{name: "warn", policy: hostNamespaceWarn, hostIPC: true, wantWarning: true},
+		{name: "deny", policy: hostNamespaceDeny, hostPID: true, hostIPC: true, wantErr: true, wantFields: []string{"spec.hostPID", "spec.hostIPC"}},
+		{name: "invalid policy", policy: "audit", hostPID: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HOST_NAMESPACE_POLICY", tt.policy)
+			pod := &corev1.Pod{Spec: corev1.PodSpec{HostPID: tt.hostPID, HostIPC: tt.hostIPC}}
+			warning, err := checkHostNamespaces(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkHostNamespaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("checkHostNamespaces() warning = %q, want %v", warning, tt.wantWarning)
+			}
+			causes := statusCauses(err)
+			if len(causes) != len(tt.wantFields) {
+				t.Fatalf("statusCauses() = %+v, want fields %q", causes, tt.wantFields)
+			}
+			for i, cause := range causes {
+				if cause.Field != tt.wantFields[i] {
+					t.Errorf("statusCauses()[%d].Field = %s, want %s", i, cause.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
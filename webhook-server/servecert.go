@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// annotationServeCertSecret names a kubernetes.io/tls Secret in the pod's
+	// namespace mounted into the sidecar, for custom images serving with
+	// their own certificate. Stock tailscale only serves with the
+	// certificates it provisions, and neither containerboot nor the serve
+	// config read a certificate file.
+	annotationServeCertSecret = "tailscale.com/serve-cert-secret"
+
+	serveCertVolumeName = "ts-serve-cert"
+	serveCertDir        = "/etc/tailscale/certs"
+)
+
+// getServeCertSecret returns the secret named by
+// tailscale.com/serve-cert-secret, or "" when unset.
+func getServeCertSecret(pod *corev1.Pod) (string, error) {
+	value, ok := pod.Annotations[annotationServeCertSecret]
+	if !ok {
+		return "", nil
+	}
+	name := strings.TrimSpace(value)
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", field.Invalid(annotationPath(annotationServeCertSecret), value, strings.Join(errs, "; "))
+	}
+	return name, nil
+}
+
+// serveCertVolume mounts the certificate and key of secret. Only the
+// kubernetes.io/tls keys are projected, so the sidecar never sees other
+// entries of the secret.
+func serveCertVolume(secret string) corev1.Volume {
+	return corev1.Volume{
+		Name: serveCertVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: secret,
+				Items: []corev1.KeyToPath{
+					{Key: corev1.TLSCertKey, Path: corev1.TLSCertKey},
+					{Key: corev1.TLSPrivateKeyKey, Path: corev1.TLSPrivateKeyKey},
+				},
+			},
+		},
+	}
+}
+
+// applyServeCert mounts the serve certificate into the sidecar at
+// serveCertDir.
+func applyServeCert(sidecar *corev1.Container) {
+	sidecar.VolumeMounts = append(sidecar.VolumeMounts, corev1.VolumeMount{
+		Name:      serveCertVolumeName,
+		MountPath: serveCertDir,
+		ReadOnly:  true,
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetServeCertSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        string
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "valid", annotations: map[string]string{annotationServeCertSecret: " web-tls "}, want: "web-tls"},
+		{name: "invalid", annotations: map[string]string{annotationServeCertSecret: "Web_TLS"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getServeCertSecret(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getServeCertSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getServeCertSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeCertMount(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantSecret  string
+	}{
+		{name: "no annotation"},
+		{name: "mounted", annotations: map[string]string{annotationServeCertSecret: "web-tls"}, wantSecret: "web-tls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", Annotations: tt.annotations},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}},
+			}
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var volume *corev1.Volume
+			var sidecar *corev1.Container
+			for _, patch := range patches {
+				switch value := patch.Value.(type) {
+				case []corev1.Volume:
+					for i := range value {
+						if value[i].Name == serveCertVolumeName {
+							volume = &value[i]
+						}
+					}
+				case corev1.Volume:
+					if value.Name == serveCertVolumeName {
+						volume = &value
+					}
+				case corev1.Container:
+					if isInjectedContainer(value.Name) && value.Name != configReloaderName {
+						sidecar = &value
+					}
+				}
+			}
+			if sidecar == nil {
+				t.Fatal("no sidecar in patch")
+			}
+			var mount *corev1.VolumeMount
+			for i := range sidecar.VolumeMounts {
+				if sidecar.VolumeMounts[i].Name == serveCertVolumeName {
+					mount = &sidecar.VolumeMounts[i]
+				}
+			}
+
+			if tt.wantSecret == "" {
+				if volume != nil || mount != nil {
+					t.Errorf("serve cert volume %v or mount %v patched without annotation", volume, mount)
+				}
+				return
+			}
+			if volume == nil || volume.Secret == nil || volume.Secret.SecretName != tt.wantSecret {
+				t.Fatalf("volume = %+v, want secret %s", volume, tt.wantSecret)
+			}
+			if len(volume.Secret.Items) != 2 || volume.Secret.Items[0].Key != corev1.TLSCertKey || volume.Secret.Items[1].Key != corev1.TLSPrivateKeyKey {
+				t.Errorf("volume items = %+v, want only %s and %s", volume.Secret.Items, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+			}
+			if mount == nil || mount.MountPath != serveCertDir || !mount.ReadOnly {
+				t.Errorf("mount = %+v, want read-only at %s", mount, serveCertDir)
+			}
+		})
+	}
+}
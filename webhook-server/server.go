@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// serverConfig holds the HTTP server tuning read from the environment.
+type serverConfig struct {
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+	keepAlives   bool
+}
+
+// getServerConfig returns READ_TIMEOUT (default: 10s), WRITE_TIMEOUT
+// (default: 30s, the longest timeout an admission webhook can have),
+// IDLE_TIMEOUT (default: 120s) and HTTP_KEEPALIVES (default: true). The API
+// server reuses connections to the webhook, so keep-alives with a generous
+// idle timeout avoid a TLS handshake per admission. A zero timeout disables
+// it.
+func getServerConfig() (serverConfig, error) {
+	var config serverConfig
+	for _, setting := range []struct {
+		name     string
+		fallback string
+		dst      *time.Duration
+	}{
+		{"READ_TIMEOUT", "10s", &config.readTimeout},
+		{"WRITE_TIMEOUT", "30s", &config.writeTimeout},
+		{"IDLE_TIMEOUT", "120s", &config.idleTimeout},
+	} {
+		value := getEnv(setting.name, setting.fallback)
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return serverConfig{}, fmt.Errorf("invalid %s %q: must be a non-negative duration", setting.name, value)
+		}
+		*setting.dst = timeout
+	}
+	value := getEnv("HTTP_KEEPALIVES", "true")
+	keepAlives, err := strconv.ParseBool(value)
+	if err != nil {
+		return serverConfig{}, fmt.Errorf("invalid HTTP_KEEPALIVES %q: must be true or false", value)
+	}
+	config.keepAlives = keepAlives
+	return config, nil
+}
+
+// newServer builds the webhook's HTTP server from getServerConfig.
+func newServer(addr string, handler http.Handler, tlsConfig *tls.Config) (*http.Server, error) {
+	config, err := getServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		TLSConfig:    tlsConfig,
+		ReadTimeout:  config.readTimeout,
+		WriteTimeout: config.writeTimeout,
+		IdleTimeout:  config.idleTimeout,
+	}
+	server.SetKeepAlivesEnabled(config.keepAlives)
+	if http2Disabled() {
+		// net/http adds h2 to the ALPN protocols unless TLSNextProto is
+		// non-nil, so the TLS config alone does not turn HTTP/2 off
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server, nil
+}
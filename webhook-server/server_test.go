@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetServerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    serverConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: serverConfig{readTimeout: 10 * time.Second, writeTimeout: 30 * time.Second, idleTimeout: 120 * time.Second, keepAlives: true},
+		},
+		{
+			name: "overrides",
+			env:  map[string]string{"READ_TIMEOUT": "5s", "WRITE_TIMEOUT": "0", "IDLE_TIMEOUT": "1m", "HTTP_KEEPALIVES": "false"},
+			want: serverConfig{readTimeout: 5 * time.Second, idleTimeout: time.Minute},
+		},
+		{name: "invalid duration", env: map[string]string{"READ_TIMEOUT": "soon"}, wantErr: true},
+		{name: "negative duration", env: map[string]string{"IDLE_TIMEOUT": "-1s"}, wantErr: true},
+		{name: "invalid keep-alives", env: map[string]string{"HTTP_KEEPALIVES": "sometimes"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "HTTP_KEEPALIVES"} {
+				t.Setenv(name, tt.env[name])
+			}
+			got, err := getServerConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getServerConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getServerConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	t.Setenv("READ_TIMEOUT", "5s")
+	server, err := newServer(":8443", http.NewServeMux(), nil)
+	if err != nil {
+		t.Fatalf("newServer() error = %v", err)
+	}
+	if server.Addr != ":8443" || server.ReadTimeout != 5*time.Second || server.WriteTimeout != 30*time.Second {
+		t.Errorf("newServer() = addr %s, read timeout %v, write timeout %v", server.Addr, server.ReadTimeout, server.WriteTimeout)
+	}
+
+	t.Setenv("WRITE_TIMEOUT", "never")
+	if _, err := newServer(":8443", http.NewServeMux(), nil); err == nil {
+		t.Error("newServer() with an invalid WRITE_TIMEOUT succeeded, want error")
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// versionMismatches counts admission requests rejected because the
+// AdmissionReview apiVersion or kind is not supported.
+var versionMismatches atomic.Int64
+
+// metricsHandler serves the webhook's own counters in the Prometheus text
+// format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP tailscale_webhook_admission_version_mismatch_total Admission requests with an unsupported AdmissionReview apiVersion or kind.")
+	fmt.Fprintln(w, "# TYPE tailscale_webhook_admission_version_mismatch_total counter")
+	fmt.Fprintf(w, "tailscale_webhook_admission_version_mismatch_total %d\n", versionMismatches.Load())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckReviewVersion(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		want       bool
+		wantFields []string
+	}{
+		{name: "v1", body: `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview"}`, want: true},
+		{name: "not json", body: `not json`, want: true},
+		{name: "v1beta1", body: `{"apiVersion":"admission.k8s.io/v1beta1","kind":"AdmissionReview"}`, wantFields: []string{"apiVersion"}},
+		{name: "wrong kind", body: `{"apiVersion":"admission.k8s.io/v1","kind":"Pod"}`, wantFields: []string{"kind"}},
+		{name: "empty", body: `{}`, wantFields: []string{"apiVersion", "kind"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := versionMismatches.Load()
+			w := httptest.NewRecorder()
+			if got := checkReviewVersion(w, []byte(tt.body)); got != tt.want {
+				t.Fatalf("checkReviewVersion() = %v, want %v", got, tt.want)
+			}
+			if tt.want {
+				if versionMismatches.Load() != before {
+					t.Error("checkReviewVersion() counted a supported review as a mismatch")
+				}
+				return
+			}
+			if versionMismatches.Load() != before+1 {
+				t.Errorf("versionMismatches = %d, want %d", versionMismatches.Load(), before+1)
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status code = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			var status metav1.Status
+			if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+				t.Fatalf("decoding status: %v", err)
+			}
+			var fields []string
+			for _, cause := range status.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("status causes = %q, want %q", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	checkReviewVersion(httptest.NewRecorder(), []byte(`{}`))
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	want := "tailscale_webhook_admission_version_mismatch_total " + strconv.FormatInt(versionMismatches.Load(), 10) + "\n"
+	if !strings.HasSuffix(w.Body.String(), want) {
+		t.Errorf("metricsHandler() = %q, want suffix %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const annotationShutdownDelay = "tailscale.com/shutdown-delay"
+
+// defaultTerminationGracePeriod is the pod terminationGracePeriodSeconds
+// Kubernetes applies when the pod does not set one.
+const defaultTerminationGracePeriod = 30
+
+// parseShutdownDelay parses a non-negative number of seconds.
+func parseShutdownDelay(value string) (int64, bool) {
+	delay, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return delay, err == nil && delay >= 0
+}
+
+// getDefaultShutdownDelay returns TS_SHUTDOWN_DELAY (default: 0, disabled).
+// It is only checked against the grace period of each pod, which may be
+// longer than the Kubernetes default.
+func getDefaultShutdownDelay() (int64, error) {
+	value := getEnv("TS_SHUTDOWN_DELAY", "0")
+	delay, ok := parseShutdownDelay(value)
+	if !ok {
+		return 0, fmt.Errorf("invalid TS_SHUTDOWN_DELAY %q: must be a non-negative number of seconds", value)
+	}
+	return delay, nil
+}
+
+// getShutdownDelay returns how many seconds tailscaled keeps running after
+// the pod starts terminating, so the tunnel stays up while the app's preStop
+// hook and graceful shutdown run. The tailscale.com/shutdown-delay annotation
+// overrides TS_SHUTDOWN_DELAY. The delay must leave time within the pod's
+// termination grace period for tailscaled to log out.
+func getShutdownDelay(pod *corev1.Pod) (int64, error) {
+	value, fromAnnotation := pod.Annotations[annotationShutdownDelay]
+	var delay int64
+	if fromAnnotation {
+		var ok bool
+		if delay, ok = parseShutdownDelay(value); !ok {
+			return 0, field.Invalid(annotationPath(annotationShutdownDelay), value, "must be a non-negative number of seconds")
+		}
+	} else {
+		var err error
+		if delay, err = getDefaultShutdownDelay(); err != nil {
+			return 0, err
+		}
+	}
+
+	grace := int64(defaultTerminationGracePeriod)
+	if pod.Spec.TerminationGracePeriodSeconds != nil {
+		grace = *pod.Spec.TerminationGracePeriodSeconds
+	}
+	if delay > 0 && delay >= grace {
+		msg := fmt.Sprintf("must be less than the pod's terminationGracePeriodSeconds (%d)", grace)
+		if fromAnnotation {
+			return 0, field.Invalid(annotationPath(annotationShutdownDelay), value, msg)
+		}
+		return 0, field.Invalid(field.NewPath("spec", "terminationGracePeriodSeconds"), grace, "TS_SHUTDOWN_DELAY "+msg)
+	}
+	return delay, nil
+}
+
+// applyShutdownDelay delays the termination signal to tailscaled with a
+// preStop sleep. Regular containers are all signalled at once, so without it
+// the tunnel can drop while the app is still draining connections. Native
+// sidecars do not need it: the kubelet only stops them once every regular
+// container has exited, and the sidecar is the first init container, so it
+// is also the last one stopped.
+func applyShutdownDelay(container *corev1.Container, delay int64) {
+	if delay == 0 {
+		return
+	}
+	if container.Lifecycle == nil {
+		container.Lifecycle = &corev1.Lifecycle{}
+	}
+	container.Lifecycle.PreStop = &corev1.LifecycleHandler{
+		Exec: &corev1.ExecAction{Command: []string{"sleep", strconv.FormatInt(delay, 10)}},
+	}
+}
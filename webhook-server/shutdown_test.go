@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetDefaultShutdownDelay(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "10", want: 10},
+		// Only checked against each pod's grace period, not the default
+		{value: "45", want: 45},
+		{value: "-1", wantErr: true},
+		{value: "5s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TS_SHUTDOWN_DELAY", tt.value)
+			got, err := getDefaultShutdownDelay()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getDefaultShutdownDelay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getDefaultShutdownDelay() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetShutdownDelay(t *testing.T) {
+	grace := func(seconds int64) *int64 { return &seconds }
+	tests := []struct {
+		name       string
+		env        string
+		annotation string
+		grace      *int64
+		want       int64
+		wantErr    bool
+	}{
+		{name: "disabled"},
+		{name: "default within default grace", env: "10", want: 10},
+		{name: "default exceeds default grace", env: "45", wantErr: true},
+		{name: "default within longer grace", env: "45", grace: grace(60), want: 45},
+		{name: "annotation overrides", env: "45", annotation: "5", want: 5},
+		{name: "annotation exceeds grace", annotation: "20", grace: grace(20), wantErr: true},
+		{name: "invalid annotation", annotation: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_SHUTDOWN_DELAY", tt.env)
+			pod := &corev1.Pod{Spec: corev1.PodSpec{TerminationGracePeriodSeconds: tt.grace}}
+			if tt.annotation != "" {
+				pod.ObjectMeta = metav1.ObjectMeta{Annotations: map[string]string{annotationShutdownDelay: tt.annotation}}
+			}
+			got, err := getShutdownDelay(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getShutdownDelay() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getShutdownDelay() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyShutdownDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		delay     int64
+		lifecycle *corev1.Lifecycle
+		want      []string
+	}{
+		{name: "disabled"},
+		{name: "delay", delay: 15, want: []string{"sleep", "15"}},
+		{
+			name:      "keeps postStart",
+			delay:     5,
+			lifecycle: &corev1.Lifecycle{PostStart: &corev1.LifecycleHandler{Exec: &corev1.ExecAction{Command: []string{"true"}}}},
+			want:      []string{"sleep", "5"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := &corev1.Container{Lifecycle: tt.lifecycle}
+			applyShutdownDelay(container, tt.delay)
+			if tt.want == nil {
+				if container.Lifecycle != nil && container.Lifecycle.PreStop != nil {
+					t.Errorf("applyShutdownDelay() preStop = %v, want none", container.Lifecycle.PreStop)
+				}
+				return
+			}
+			if container.Lifecycle == nil || container.Lifecycle.PreStop == nil || container.Lifecycle.PreStop.Exec == nil {
+				t.Fatalf("applyShutdownDelay() lifecycle = %v, want a preStop exec hook", container.Lifecycle)
+			}
+			if got := container.Lifecycle.PreStop.Exec.Command; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyShutdownDelay() preStop = %q, want %q", got, tt.want)
+			}
+			if tt.lifecycle != nil && container.Lifecycle.PostStart == nil {
+				t.Error("applyShutdownDelay() dropped the postStart hook")
+			}
+		})
+	}
+}
+
+func TestShutdownDelaySidecarMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		native      string
+		initCount   int
+		wantPath    string
+		wantPreStop bool
+	}{
+		{name: "regular", native: "false", wantPath: "/spec/containers/-", wantPreStop: true},
+		{name: "native", native: "true", wantPath: "/spec/initContainers"},
+		{name: "native before app init containers", native: "true", initCount: 1, wantPath: "/spec/initContainers/0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_NATIVE_SIDECAR", tt.native)
+			pod := testInjectedPod()
+			pod.Annotations[annotationShutdownDelay] = "10"
+			for i := 0; i < tt.initCount; i++ {
+				pod.Spec.InitContainers = append(pod.Spec.InitContainers, corev1.Container{Name: "migrate", Image: "migrate"})
+			}
+			patches, _, err := generateSidecarPatch(context.Background(), pod)
+			if err != nil {
+				t.Fatalf("generateSidecarPatch() error = %v", err)
+			}
+			var path string
+			var sidecar corev1.Container
+			for _, patch := range patches {
+				if container, ok := sidecarFromPatch([]patchOperation{patch}); ok {
+					path, sidecar = patch.Path, container
+				}
+			}
+			if path != tt.wantPath {
+				t.Errorf("sidecar added at %q, want %q", path, tt.wantPath)
+			}
+			hasPreStop := sidecar.Lifecycle != nil && sidecar.Lifecycle.PreStop != nil
+			if hasPreStop != tt.wantPreStop {
+				t.Errorf("sidecar preStop hook = %v, want %v", hasPreStop, tt.wantPreStop)
+			}
+		})
+	}
+}
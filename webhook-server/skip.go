@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// skipReason is a stable, machine-readable code for why a pod was admitted
+// without a sidecar. The values are part of the webhook's interface and must
+// not change.
+type skipReason string
+
+const (
+	skipOperationNotHandled  skipReason = "OPERATION_NOT_HANDLED"
+	skipMirrorPod            skipReason = "MIRROR_POD"
+	skipNoInjectLabel        skipReason = "NO_INJECT_LABEL"
+	skipUnsupportedOS        skipReason = "UNSUPPORTED_OS"
+	skipAlreadyInjected      skipReason = "ALREADY_INJECTED"
+	skipUpdate               skipReason = "UPDATE_NOT_INJECTED"
+	skipNamespaceTerminating skipReason = "NAMESPACE_TERMINATING"
+	skipPolicy               skipReason = "POLICY_SKIPPED"
+	skipLatencyBudget        skipReason = "LATENCY_BUDGET_EXCEEDED"
+	skipInjectionError       skipReason = "INJECTION_ERROR"
+	skipRateLimited          skipReason = "RATE_LIMITED"
+	skipConcurrencyLimited   skipReason = "CONCURRENCY_LIMITED"
+)
+
+// auditSkipReason is the audit annotation carrying the skip reason. The API
+// server prefixes it with the webhook name, e.g.
+// tailscale-injector.tailscale.com/skip-reason.
+const auditSkipReason = "skip-reason"
+
+// skip admits the pod unchanged, recording reason as an audit annotation
+// and in /debug/recent.
+func skip(w http.ResponseWriter, admissionReview *admissionv1.AdmissionReview, pod *corev1.Pod, reason skipReason, message string, warnings []string) {
+	response := newAdmissionResponse(admissionReview, nil, true, message, nil, warnings)
+	response.AuditAnnotations = map[string]string{auditSkipReason: string(reason)}
+	recordDecision(pod, outcomeSkipped, string(reason)+": "+message)
+	writeAdmissionResponse(w, admissionReview, response)
+}
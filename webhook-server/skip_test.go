@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSkipReason(t *testing.T) {
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want skipReason
+	}{
+		{
+			name: "mirror pod",
+			pod: &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name: "etcd", Namespace: "kube-system",
+				Labels:      map[string]string{"tailscale.com/inject": "true"},
+				Annotations: map[string]string{corev1.MirrorPodAnnotationKey: "hash"},
+			}},
+			want: skipMirrorPod,
+		},
+		{
+			name: "no inject label",
+			pod:  &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"}},
+			want: skipNoInjectLabel,
+		},
+	}
+	saved := recentDecisions
+	t.Cleanup(func() { recentDecisions = saved })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recentDecisions = newDecisionBuffer(1)
+			response := reviewPod(t, mutateHandler, tt.pod)
+			if !response.Allowed || response.Patch != nil {
+				t.Errorf("response allowed = %v with patch %s, want allowed without patch", response.Allowed, response.Patch)
+			}
+			if got := response.AuditAnnotations[auditSkipReason]; got != string(tt.want) {
+				t.Errorf("audit annotation %s = %q, want %q", auditSkipReason, got, tt.want)
+			}
+			decisions := recentDecisions.list()
+			if len(decisions) != 1 || decisions[0].Outcome != outcomeSkipped || !strings.HasPrefix(decisions[0].Reason, string(tt.want)+": ") {
+				t.Errorf("recent decisions = %+v, want one skipped with reason %s", decisions, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipConcurrencyLimited(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		wantAllowed bool
+		wantReason  string
+	}{
+		{name: "deny", policy: "deny"},
+		{name: "skip", policy: "skip", wantAllowed: true, wantReason: string(skipConcurrencyLimited)},
+	}
+	saved := mutationSlots
+	t.Cleanup(func() { mutationSlots = saved })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INJECTION_ERROR_POLICY", tt.policy)
+			t.Setenv("MUTATION_QUEUE_TIMEOUT", "1ms")
+			mutationSlots = make(chan struct{}, 1)
+			mutationSlots <- struct{}{}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name: "web", Namespace: "prod",
+				Labels: map[string]string{"tailscale.com/inject": "true"},
+			}}
+			response := reviewPod(t, mutateHandler, pod)
+			if response.Allowed != tt.wantAllowed {
+				t.Errorf("response allowed = %v, want %v", response.Allowed, tt.wantAllowed)
+			}
+			if got := response.AuditAnnotations[auditSkipReason]; got != tt.wantReason {
+				t.Errorf("audit annotation %s = %q, want %q", auditSkipReason, got, tt.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// annotationStateSecret names a pre-created secret the sidecar keeps its
+	// state in, overriding TS_KUBE_SECRET.
+	annotationStateSecret = "tailscale.com/state-secret"
+	// annotationStateSecretName records the secret the sidecar keeps its
+	// state in. The secret is created by the sidecar after admission, so it
+	// cannot be labeled here; instead a garbage collector can delete the
+	// state secrets no live pod references.
+	annotationStateSecretName = "tailscale.com/state-secret-name"
+
+	// stateSecretPodUIDKey is the state secret key containerboot records the
+	// POD_UID of the pod using the secret in.
+	stateSecretPodUIDKey = "pod_uid"
+)
+
+// Behaviors for state secrets still used by another live pod
+// (STATE_SECRET_OWNER_POLICY).
+const (
+	stateOwnerAllow = "allow"
+	stateOwnerWarn  = "warn"
+	stateOwnerDeny  = "deny"
+)
+
+// getStateSecret returns the state secret requested by the
+// tailscale.com/state-secret annotation, "<name>" or "<namespace>/<name>",
+// or "" when not set. tailscaled can only use secrets in the pod's own
+// namespace, so any other namespace is denied.
+func getStateSecret(pod *corev1.Pod, profile *sidecarProfile) (string, error) {
+	value, ok := pod.Annotations[annotationStateSecret]
+	if !ok {
+		return "", nil
+	}
+	path := annotationPath(annotationStateSecret)
+	name := strings.TrimSpace(value)
+	if namespace, secretName, found := strings.Cut(name, "/"); found {
+		if namespace != pod.Namespace {
+			return "", field.Invalid(path, value, fmt.Sprintf("the state secret must be in the pod's namespace %s, secrets in other namespaces cannot be used", pod.Namespace))
+		}
+		name = secretName
+	}
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", field.Invalid(path, value, strings.Join(errs, "; "))
+	}
+	if err := stateBackendConflict(pod, profile); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// stateSecretAnnotations returns the annotation recording the state secret
+// name when TS_STATE_SECRET_GC is set. $(POD_NAME) and $(POD_NAMESPACE) are
+// expanded; names only known at runtime, such as those of pods created from
+// generateName, are not recorded.
+func stateSecretAnnotations(pod *corev1.Pod, name string) map[string]string {
+	if getEnv("TS_STATE_SECRET_GC", "false") != "true" || name == "" {
+		return nil
+	}
+	name, ok := expandStateSecretName(pod, name)
+	if !ok {
+		return nil
+	}
+	return map[string]string{annotationStateSecretName: name}
+}
+
+// expandStateSecretName expands $(POD_NAME) and $(POD_NAMESPACE) in the
+// state secret name, reporting false when the name is only known at runtime.
+func expandStateSecretName(pod *corev1.Pod, name string) (string, bool) {
+	if pod.Name != "" {
+		name = strings.ReplaceAll(name, "$(POD_NAME)", pod.Name)
+	}
+	name = strings.ReplaceAll(name, "$(POD_NAMESPACE)", pod.Namespace)
+	if strings.Contains(name, "$(") || strings.HasSuffix(name, "-") {
+		return "", false
+	}
+	return name, true
+}
+
+// checkStateBackend reports a pod requesting more than one state backend.
+// The mutating webhook finds the same conflict only once it injects, so the
+// validating webhook denies such pods up front, including those admitted
+// while the mutating webhook was unavailable.
+func checkStateBackend(pod *corev1.Pod) error {
+	profile, err := getProfile(pod)
+	if err != nil {
+		// An unknown profile is reported by the mutating webhook
+		return nil
+	}
+	return stateBackendConflict(pod, profile)
+}
+
+// stateBackendConflict denies a tailscale.com/state-secret next to a profile
+// keeping state in memory rather than silently picking one of the two.
+func stateBackendConflict(pod *corev1.Pod, profile *sidecarProfile) error {
+	value, ok := pod.Annotations[annotationStateSecret]
+	if !ok || profile.StateMode != stateModeMemory {
+		return nil
+	}
+	return field.Invalid(annotationPath(annotationStateSecret), value, "conflicts with the pod's profile, which keeps state in memory")
+}
+
+func getStateOwnerPolicy() (string, error) {
+	policy := getEnv("STATE_SECRET_OWNER_POLICY", stateOwnerAllow)
+	switch policy {
+	case stateOwnerAllow, stateOwnerWarn, stateOwnerDeny:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid STATE_SECRET_OWNER_POLICY %q: must be %s, %s, or %s", policy, stateOwnerAllow, stateOwnerWarn, stateOwnerDeny)
+}
+
+// stateSecretOwner returns the name of the live pod other than pod recorded
+// as using the state secret, or "" when there is none. A secret left behind
+// by a deleted or finished pod, such as the previous incarnation of a
+// StatefulSet pod, is free to reuse. Lookup failures are logged and treated
+// as no owner, so the API server being slow does not block admissions.
+func stateSecretOwner(ctx context.Context, pod *corev1.Pod, name string) string {
+	secret, err := kubeClient.CoreV1().Secrets(pod.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return ""
+	}
+	if err != nil {
+		log.Printf("Error reading state secret %s/%s, not checking its owner: %v", pod.Namespace, name, err)
+		return ""
+	}
+	uid := string(secret.Data[stateSecretPodUIDKey])
+	if uid == "" || uid == string(pod.UID) {
+		return ""
+	}
+
+	pods, err := kubeClient.CoreV1().Pods(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("Error listing pods in %s, not checking the owner of state secret %s: %v", pod.Namespace, name, err)
+		return ""
+	}
+	for _, other := range pods.Items {
+		if string(other.UID) != uid {
+			continue
+		}
+		if other.Status.Phase == corev1.PodSucceeded || other.Status.Phase == corev1.PodFailed {
+			return ""
+		}
+		return other.Name
+	}
+	return ""
+}
+
+// checkStateSecretOwner applies STATE_SECRET_OWNER_POLICY to a state secret
+// already used by another live pod. Two tailscaled instances sharing one
+// state secret overwrite each other's node key and corrupt the state. It
+// returns an admission warning with the warn policy and an error with the
+// deny policy.
+func checkStateSecretOwner(ctx context.Context, pod *corev1.Pod, name string) (string, error) {
+	policy, err := getStateOwnerPolicy()
+	if err != nil {
+		return "", err
+	}
+	if policy == stateOwnerAllow || kubeClient == nil || name == "" {
+		return "", nil
+	}
+	name, ok := expandStateSecretName(pod, name)
+	if !ok {
+		debugf("State secret of pod %s/%s is only known at runtime, not checking its owner", pod.Namespace, pod.Name)
+		return "", nil
+	}
+	owner := stateSecretOwner(ctx, pod, name)
+	if owner == "" {
+		return "", nil
+	}
+	message := fmt.Sprintf("state secret %s is in use by live pod %s", name, owner)
+	if policy == stateOwnerWarn {
+		log.Printf("Warning: pod %s/%s: %s", pod.Namespace, pod.Name, message)
+		return "the Tailscale " + message + ", sharing it corrupts the state of both sidecars", nil
+	}
+	if value, ok := pod.Annotations[annotationStateSecret]; ok {
+		return "", field.Invalid(annotationPath(annotationStateSecret), value, message)
+	}
+	return "", fmt.Errorf("%s, set %s to a secret of its own or delete the other pod", message, annotationStateSecret)
+}
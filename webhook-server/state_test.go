@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetStateSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   *string
+		want    string
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "name", value: stringPtr(" ts-state "), want: "ts-state"},
+		{name: "own namespace", value: stringPtr("prod/ts-state"), want: "ts-state"},
+		{name: "other namespace", value: stringPtr("kube-system/ts-state"), wantErr: true},
+		{name: "invalid name", value: stringPtr("TS_State"), wantErr: true},
+		{name: "empty", value: stringPtr(""), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Annotations: map[string]string{}}}
+			if tt.value != nil {
+				pod.Annotations[annotationStateSecret] = *tt.value
+			}
+			got, err := getStateSecret(pod, &sidecarProfile{StateMode: stateModeSecret})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getStateSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getStateSecret() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestStateSecretAnnotations(t *testing.T) {
+	tests := []struct {
+		name       string
+		gc         string
+		podName    string
+		secretName string
+		want       string
+	}{
+		{name: "disabled", podName: "web", secretName: "ts-state"},
+		{name: "no secret", gc: "true", podName: "web"},
+		{name: "fixed name", gc: "true", podName: "web", secretName: "ts-state", want: "ts-state"},
+		{name: "expanded", gc: "true", podName: "web", secretName: "$(POD_NAMESPACE)-$(POD_NAME)-ts", want: "prod-web-ts"},
+		{name: "generated name", gc: "true", secretName: "$(POD_NAME)-ts"},
+		{name: "generated name suffix", gc: "true", secretName: "ts-$(POD_NAME)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_STATE_SECRET_GC", tt.gc)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: tt.podName, GenerateName: "web-", Namespace: "prod"}}
+			got := stateSecretAnnotations(pod, tt.secretName)[annotationStateSecretName]
+			if got != tt.want {
+				t.Errorf("stateSecretAnnotations(%q) = %q, want %q", tt.secretName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStateBackend(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantErr     bool
+	}{
+		{name: "no state secret", annotations: map[string]string{annotationProfile: "ephemeral"}},
+		{name: "secret profile", annotations: map[string]string{annotationProfile: "userspace", annotationStateSecret: "ts-state"}},
+		{name: "memory profile", annotations: map[string]string{annotationProfile: "ephemeral", annotationStateSecret: "ts-state"}, wantErr: true},
+		{name: "unknown profile", annotations: map[string]string{annotationProfile: "nope", annotationStateSecret: "ts-state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Annotations: tt.annotations}}
+			err := checkStateBackend(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkStateBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if causes := statusCauses(err); tt.wantErr && (len(causes) != 1 || causes[0].Field != "metadata.annotations[tailscale.com/state-secret]") {
+				t.Errorf("statusCauses() = %+v, want the state secret annotation", causes)
+			}
+		})
+	}
+}
+
+func TestCheckStateSecretOwner(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		secretName  string
+		annotated   bool
+		ownerPhase  corev1.PodPhase
+		wantWarning bool
+		wantErr     bool
+	}{
+		{name: "allow", secretName: "ts-state"},
+		{name: "warn", policy: stateOwnerWarn, secretName: "ts-state", wantWarning: true},
+		{name: "deny annotation", policy: stateOwnerDeny, secretName: "ts-state", annotated: true, wantErr: true},
+		{name: "deny default secret", policy: stateOwnerDeny, secretName: "$(POD_NAME)-state", wantErr: true},
+		{name: "finished owner", policy: stateOwnerDeny, secretName: "ts-state", ownerPhase: corev1.PodSucceeded},
+		{name: "missing secret", policy: stateOwnerDeny, secretName: "other-state"},
+		{name: "own secret", policy: stateOwnerDeny, secretName: "own-state"},
+		{name: "runtime name", policy: stateOwnerDeny, secretName: "$(HOSTNAME)-state"},
+		{name: "invalid policy", policy: "block", secretName: "ts-state", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATE_SECRET_OWNER_POLICY", tt.policy)
+			owner := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "web-old", Namespace: "prod", UID: "old"},
+				Status:     corev1.PodStatus{Phase: tt.ownerPhase},
+			}
+			withKubeClient(t, owner,
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ts-state", Namespace: "prod"}, Data: map[string][]byte{stateSecretPodUIDKey: []byte("old")}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "web-state", Namespace: "prod"}, Data: map[string][]byte{stateSecretPodUIDKey: []byte("old")}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "own-state", Namespace: "prod"}, Data: map[string][]byte{stateSecretPodUIDKey: []byte("new")}},
+			)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod", UID: "new", Annotations: map[string]string{}}}
+			if tt.annotated {
+				pod.Annotations[annotationStateSecret] = tt.secretName
+			}
+			warning, err := checkStateSecretOwner(context.Background(), pod, tt.secretName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkStateSecretOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("checkStateSecretOwner() warning = %q, want %v", warning, tt.wantWarning)
+			}
+			if causes := statusCauses(err); tt.annotated && (len(causes) != 1 || causes[0].Field != "metadata.annotations[tailscale.com/state-secret]") {
+				t.Errorf("statusCauses() = %+v, want the state secret annotation", causes)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const annotationTags = "tailscale.com/tags"
+
+// tagPattern matches a Tailscale ACL tag such as tag:k8s-sidecar.
+var tagPattern = regexp.MustCompile(`^tag:[a-zA-Z][a-zA-Z0-9-]*$`)
+
+// parseTags splits a comma separated list of ACL tags. It returns the first
+// invalid tag, if any, so callers can attach it to the right field.
+func parseTags(value string) ([]string, string) {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, tag
+		}
+		tags = append(tags, tag)
+	}
+	return tags, ""
+}
+
+// getTags returns the ACL tags to advertise, from the tailscale.com/tags
+// annotation or TS_TAGS.
+func getTags(pod *corev1.Pod) ([]string, error) {
+	if value, ok := pod.Annotations[annotationTags]; ok {
+		tags, invalid := parseTags(value)
+		if invalid != "" {
+			return nil, field.Invalid(annotationPath(annotationTags), invalid, "must be an ACL tag, e.g. tag:k8s")
+		}
+		return tags, nil
+	}
+	tags, invalid := parseTags(getEnv("TS_TAGS", ""))
+	if invalid != "" {
+		return nil, fmt.Errorf("invalid TS_TAGS entry %q: must be an ACL tag, e.g. tag:k8s", invalid)
+	}
+	return tags, nil
+}
+
+// hasAdvertiseTagsArg reports whether args already pass --advertise-tags,
+// for example through TS_EXTRA_ARGS or a profile.
+func hasAdvertiseTagsArg(args string) bool {
+	fields, err := splitArgs(args)
+	if err != nil {
+		return false
+	}
+	for _, arg := range fields {
+		if arg == "--advertise-tags" || strings.HasPrefix(arg, "--advertise-tags=") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTagsRequired denies untagged nodes when REQUIRE_TAGS is set.
+func checkTagsRequired(tags []string, args string) error {
+	if getEnv("REQUIRE_TAGS", "false") != "true" || len(tags) > 0 || hasAdvertiseTagsArg(args) {
+		return nil
+	}
+	return field.Required(annotationPath(annotationTags), "REQUIRE_TAGS is set, the node must be tagged via this annotation, TS_TAGS, or --advertise-tags")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetTags(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		env         string
+		want        []string
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{name: "env", env: "tag:k8s, tag:web", want: []string{"tag:k8s", "tag:web"}},
+		{name: "annotation wins", annotations: map[string]string{annotationTags: "tag:db,"}, env: "tag:k8s", want: []string{"tag:db"}},
+		{name: "empty annotation clears env", annotations: map[string]string{annotationTags: ""}, env: "tag:k8s"},
+		{name: "invalid annotation", annotations: map[string]string{annotationTags: "tag:db,web"}, wantErr: true},
+		{name: "invalid env", env: "tag:1st", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_TAGS", tt.env)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			got, err := getTags(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTagsRequired(t *testing.T) {
+	tests := []struct {
+		name    string
+		require string
+		tags    []string
+		args    string
+		wantErr bool
+	}{
+		{name: "not required"},
+		{name: "tagged", require: "true", tags: []string{"tag:k8s"}},
+		{name: "tagged by flag", require: "true", args: "--accept-routes --advertise-tags=tag:k8s"},
+		{name: "tagged by separate flag", require: "true", args: "--advertise-tags tag:k8s"},
+		{name: "untagged", require: "true", args: "--accept-routes", wantErr: true},
+		{name: "unparsable args", require: "true", args: "--advertise-tags 'tag:k8s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REQUIRE_TAGS", tt.require)
+			if err := checkTagsRequired(tt.tags, tt.args); (err != nil) != tt.wantErr {
+				t.Errorf("checkTagsRequired() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// annotationTailnet selects one of the tailnets configured in TS_TAILNETS,
+// for clusters bridging several tailnets with their own control servers.
+const annotationTailnet = "tailscale.com/tailnet"
+
+// tailnetConfig is a named tailnet from TS_TAILNETS: the control server the
+// sidecar logs in to and the secret holding auth keys for it.
+type tailnetConfig struct {
+	LoginServer   string `json:"loginServer"`
+	AuthKeySecret string `json:"authKeySecret"`
+}
+
+func (t *tailnetConfig) validate() error {
+	u, err := url.Parse(t.LoginServer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid loginServer %q: must be an http or https URL", t.LoginServer)
+	}
+	if errs := validation.IsDNS1123Subdomain(t.AuthKeySecret); len(errs) > 0 {
+		return fmt.Errorf("invalid authKeySecret %q: %s", t.AuthKeySecret, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// loadTailnets parses and validates the TS_TAILNETS JSON object of tailnet
+// name to tailnet config.
+func loadTailnets() (map[string]*tailnetConfig, error) {
+	value := getEnv("TS_TAILNETS", "")
+	if value == "" {
+		return nil, nil
+	}
+	var tailnets map[string]*tailnetConfig
+	if err := json.Unmarshal([]byte(value), &tailnets); err != nil {
+		return nil, fmt.Errorf("invalid TS_TAILNETS: %v", err)
+	}
+	for _, name := range sortedTailnetNames(tailnets) {
+		if tailnets[name] == nil {
+			return nil, fmt.Errorf("invalid tailnet %q: loginServer and authKeySecret are required", name)
+		}
+		if err := tailnets[name].validate(); err != nil {
+			return nil, fmt.Errorf("invalid tailnet %q: %v", name, err)
+		}
+	}
+	return tailnets, nil
+}
+
+func sortedTailnetNames(tailnets map[string]*tailnetConfig) []string {
+	names := make([]string, 0, len(tailnets))
+	for name := range tailnets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getTailnet returns the tailnet selected by the tailscale.com/tailnet
+// annotation, or nil when the pod selects none and joins the default tailnet.
+func getTailnet(pod *corev1.Pod) (*tailnetConfig, error) {
+	value, ok := pod.Annotations[annotationTailnet]
+	if !ok {
+		return nil, nil
+	}
+	tailnets, err := loadTailnets()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(value)
+	tailnet, ok := tailnets[name]
+	if !ok {
+		return nil, field.NotSupported(annotationPath(annotationTailnet), value, sortedTailnetNames(tailnets))
+	}
+	return tailnet, nil
+}
+
+// withLoginServer replaces any --login-server flag in the TS_EXTRA_ARGS
+// string args with one pointing at server.
+func withLoginServer(args, server string) (string, error) {
+	split, err := splitArgs(args)
+	if err != nil {
+		return "", fmt.Errorf("invalid TS_EXTRA_ARGS: %v", err)
+	}
+	kept := make([]string, 0, len(split)+1)
+	for i := 0; i < len(split); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(split[i], "-"), "=")
+		if strings.HasPrefix(split[i], "-") && name == "login-server" {
+			if !hasValue && i+1 < len(split) && !strings.HasPrefix(split[i+1], "-") {
+				i++
+			}
+			continue
+		}
+		kept = append(kept, split[i])
+	}
+	kept = append(kept, "--login-server="+server)
+	return joinArgs(kept), nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetTailnet(t *testing.T) {
+	const tailnets = `{
+		"corp": {"loginServer": "https://login.corp.example", "authKeySecret": "corp-authkey"},
+		"lab": {"loginServer": "http://headscale.lab:8080", "authKeySecret": "lab-authkey"}
+	}`
+	tests := []struct {
+		name       string
+		tailnets   string
+		annotation *string
+		wantServer string
+		wantErr    bool
+	}{
+		{name: "unset", tailnets: tailnets},
+		{name: "unset without tailnets", tailnets: "not json"},
+		{name: "selected", tailnets: tailnets, annotation: stringPtr(" lab "), wantServer: "http://headscale.lab:8080"},
+		{name: "unknown", tailnets: tailnets, annotation: stringPtr("home"), wantErr: true},
+		{name: "none configured", annotation: stringPtr("corp"), wantErr: true},
+		{name: "invalid json", tailnets: "not json", annotation: stringPtr("corp"), wantErr: true},
+		{name: "null tailnet", tailnets: `{"corp": null}`, annotation: stringPtr("corp"), wantErr: true},
+		{name: "invalid login server", tailnets: `{"corp": {"loginServer": "login.corp.example", "authKeySecret": "corp-authkey"}}`, annotation: stringPtr("corp"), wantErr: true},
+		{name: "invalid secret", tailnets: `{"corp": {"loginServer": "https://login.corp.example", "authKeySecret": "Corp_Key"}}`, annotation: stringPtr("corp"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_TAILNETS", tt.tailnets)
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if tt.annotation != nil {
+				pod.Annotations[annotationTailnet] = *tt.annotation
+			}
+			got, err := getTailnet(pod)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getTailnet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var server string
+			if got != nil {
+				server = got.LoginServer
+			}
+			if server != tt.wantServer {
+				t.Errorf("getTailnet() login server = %q, want %q", server, tt.wantServer)
+			}
+		})
+	}
+}
+
+func TestWithLoginServer(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    string
+		want    string
+		wantErr bool
+	}{
+		{name: "empty", want: "--login-server=https://login.corp.example"},
+		{name: "appended", args: "--accept-routes", want: "--accept-routes --login-server=https://login.corp.example"},
+		{name: "replaces inline", args: "--login-server=https://old --accept-routes", want: "--accept-routes --login-server=https://login.corp.example"},
+		{name: "replaces separate", args: "--login-server https://old --accept-routes", want: "--accept-routes --login-server=https://login.corp.example"},
+		{name: "single dash", args: "-login-server https://old", want: "--login-server=https://login.corp.example"},
+		{name: "invalid", args: "--hostname 'web", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := withLoginServer(tt.args, "https://login.corp.example")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("withLoginServer(%q) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("withLoginServer(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// tlsCurves are the curve preferences accepted in TLS_CURVE_PREFERENCES.
+var tlsCurves = map[string]tls.CurveID{
+	"X25519":    tls.X25519,
+	"CurveP256": tls.CurveP256,
+	"CurveP384": tls.CurveP384,
+	"CurveP521": tls.CurveP521,
+}
+
+// parseCipherSuites parses a comma separated list of cipher suite names as
+// named by Go, e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Only secure
+// TLS 1.2 suites are accepted, Go does not allow configuring TLS 1.3 suites.
+func parseCipherSuites(value string) ([]uint16, error) {
+	known := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite
+	}
+	insecure := map[string]bool{}
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if insecure[name] {
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		}
+		suite, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		if !supportsTLS12(suite) {
+			return nil, fmt.Errorf("cipher suite %s is TLS 1.3 only and cannot be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCurvePreferences parses a comma separated list of curve names, e.g.
+// X25519,CurveP256.
+func parseCurvePreferences(value string) ([]tls.CurveID, error) {
+	var curves []tls.CurveID
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		curve, ok := tlsCurves[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %s", name)
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+// http2Disabled reports whether DISABLE_HTTP2=true, which limits the server
+// to HTTP/1.1, e.g. to rule out HTTP/2 rapid reset attacks.
+func http2Disabled() bool {
+	return getEnv("DISABLE_HTTP2", "false") == "true"
+}
+
+// getTLSConfig returns the server TLS config. Unset TLS_CIPHER_SUITES and
+// TLS_CURVE_PREFERENCES keep Go's secure defaults. With DISABLE_HTTP2 only
+// http/1.1 is offered during ALPN.
+func getTLSConfig() (*tls.Config, error) {
+	cipherSuites, err := parseCipherSuites(getEnv("TLS_CIPHER_SUITES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS_CIPHER_SUITES: %v", err)
+	}
+	curves, err := parseCurvePreferences(getEnv("TLS_CURVE_PREFERENCES", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS_CURVE_PREFERENCES: %v", err)
+	}
+	config := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     cipherSuites,
+		CurvePreferences: curves,
+	}
+	if http2Disabled() {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseCipherSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []uint16
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{
+			name:  "tls 1.2 suites",
+			value: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,",
+			want:  []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+		},
+		{name: "insecure", value: "TLS_RSA_WITH_RC4_128_SHA", wantErr: true},
+		{name: "tls 1.3 only", value: "TLS_AES_128_GCM_SHA256", wantErr: true},
+		{name: "unknown", value: "TLS_FAKE", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCipherSuites(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCipherSuites(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCipherSuites(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCurvePreferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []tls.CurveID
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "curves", value: "X25519, CurveP256", want: []tls.CurveID{tls.X25519, tls.CurveP256}},
+		{name: "unknown", value: "P256", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCurvePreferences(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCurvePreferences(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCurvePreferences(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTLSConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		ciphers string
+		curves  string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "configured", ciphers: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", curves: "CurveP384"},
+		{name: "invalid ciphers", ciphers: "TLS_FAKE", wantErr: true},
+		{name: "invalid curves", curves: "P384", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TLS_CIPHER_SUITES", tt.ciphers)
+			t.Setenv("TLS_CURVE_PREFERENCES", tt.curves)
+			config, err := getTLSConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("getTLSConfig().MinVersion = %x, want TLS 1.2", config.MinVersion)
+			}
+		})
+	}
+}
+
+func TestDisableHTTP2(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantHTTP2 bool
+	}{
+		{name: "unset", wantHTTP2: true},
+		{name: "false", value: "false", wantHTTP2: true},
+		{name: "true", value: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DISABLE_HTTP2", tt.value)
+			config, err := getTLSConfig()
+			if err != nil {
+				t.Fatalf("getTLSConfig() error = %v", err)
+			}
+			if got := len(config.NextProtos) == 0; got != tt.wantHTTP2 {
+				t.Errorf("getTLSConfig().NextProtos = %q, want HTTP/2 %v", config.NextProtos, tt.wantHTTP2)
+			}
+			server, err := newServer(":8443", http.NewServeMux(), config)
+			if err != nil {
+				t.Fatalf("newServer() error = %v", err)
+			}
+			if got := server.TLSNextProto == nil; got != tt.wantHTTP2 {
+				t.Errorf("newServer().TLSNextProto = %v, want HTTP/2 %v", server.TLSNextProto, tt.wantHTTP2)
+			}
+		})
+	}
+}
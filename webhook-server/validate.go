@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// getRequiredAnnotations returns the annotation keys from
+// TS_REQUIRED_ANNOTATIONS that every pod requesting injection must carry.
+func getRequiredAnnotations() []string {
+	var keys []string
+	for _, key := range strings.Split(getEnv("TS_REQUIRED_ANNOTATIONS", ""), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// missingRequiredAnnotations returns the required annotations the pod lacks.
+func missingRequiredAnnotations(pod *corev1.Pod) []string {
+	var missing []string
+	for _, key := range getRequiredAnnotations() {
+		if _, ok := pod.Annotations[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// validateHandler enforces org-wide policy and rejects conflicting
+// annotations on pods requesting injection. It
+// never mutates, so it is served separately from /mutate and registered in a
+// ValidatingWebhookConfiguration.
+func validateHandler(w http.ResponseWriter, r *http.Request) {
+	admissionReview, pod, ok := readPodReview(w, r)
+	if !ok {
+		return
+	}
+
+	if !requestsInjection(r.Context(), pod) {
+		sendAdmissionResponse(w, admissionReview, nil, true, "Pod does not require sidecar injection", nil, nil)
+		return
+	}
+
+	var errs field.ErrorList
+	var problems []string
+	report := func(problem string, err error) {
+		errs = append(errs, fieldErrors(err)...)
+		problems = append(problems, problem+err.Error())
+	}
+	if missing := missingRequiredAnnotations(pod); len(missing) > 0 {
+		for _, key := range missing {
+			errs = append(errs, field.Required(annotationPath(key), "required for pods requesting Tailscale injection"))
+		}
+		problems = append(problems, "is missing required annotations: "+strings.Join(missing, ", "))
+	}
+	if _, err := getEgressOnly(pod); err != nil {
+		report("has an invalid egress-only setting: ", err)
+	}
+	if routes, err := getAdvertiseRoutes(pod); err == nil {
+		if _, _, err := limitRoutes(routes); err != nil {
+			report("advertises too many routes: ", err)
+		}
+	}
+	if err := checkDeniedFlags(pod); err != nil {
+		report("passes a denied tailscale flag: ", err)
+	}
+	if err := checkStateBackend(pod); err != nil {
+		report("requests conflicting state backends: ", err)
+	}
+	if len(problems) == 0 {
+		sendAdmissionResponse(w, admissionReview, nil, true, "", nil, nil)
+		return
+	}
+
+	message := "Pod requests Tailscale injection but " + strings.Join(problems, "; ")
+	log.Printf("Denying pod %s/%s: %s", pod.Namespace, pod.Name, message)
+	sendAdmissionResponse(w, admissionReview, nil, false, message, statusCauses(errs.ToAggregate()), nil)
+}
+
+// fieldErrors returns the field errors in err, which may be an aggregate.
+// Errors not tied to a field are wrapped in field.InternalError so that
+// every failure shows up in the status causes.
+func fieldErrors(err error) field.ErrorList {
+	errs := []error{err}
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		errs = aggregate.Errors()
+	}
+	var list field.ErrorList
+	for _, e := range errs {
+		var fieldErr *field.Error
+		if errors.As(e, &fieldErr) {
+			list = append(list, fieldErr)
+		} else {
+			list = append(list, field.InternalError(field.NewPath("metadata", "annotations"), e))
+		}
+	}
+	return list
+}
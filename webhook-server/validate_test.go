@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// reviewPod sends pod in an admission review to handler and returns the
+// response.
+func reviewPod(t *testing.T, handler http.HandlerFunc, pod *corev1.Pod) *admissionv1.AdmissionResponse {
+	t.Helper()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := admissionv1.AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"},
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID("test"),
+			Namespace: pod.Namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/validate", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var response admissionv1.AdmissionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Response == nil {
+		t.Fatalf("review has no response: %s", w.Body)
+	}
+	return response.Response
+}
+
+func TestValidateRequiredAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		wantAllowed bool
+		wantCauses  []string
+	}{
+		{
+			name:        "present",
+			annotations: map[string]string{"example.com/owner": "infra", "example.com/cost-center": "42"},
+			wantAllowed: true,
+		},
+		{
+			name:        "one missing",
+			annotations: map[string]string{"example.com/owner": "infra"},
+			wantCauses:  []string{"metadata.annotations[example.com/cost-center]"},
+		},
+		{
+			name:       "all missing",
+			wantCauses: []string{"metadata.annotations[example.com/owner]", "metadata.annotations[example.com/cost-center]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_REQUIRED_ANNOTATIONS", "example.com/owner, example.com/cost-center")
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:        "web",
+				Namespace:   "prod",
+				Labels:      map[string]string{"tailscale.com/inject": "true"},
+				Annotations: tt.annotations,
+			}}
+			response := reviewPod(t, validateHandler, pod)
+			if response.Allowed != tt.wantAllowed {
+				t.Fatalf("allowed = %v, want %v: %+v", response.Allowed, tt.wantAllowed, response.Result)
+			}
+			if tt.wantAllowed {
+				return
+			}
+			var fields []string
+			for _, cause := range response.Result.Details.Causes {
+				fields = append(fields, cause.Field)
+			}
+			if len(fields) != len(tt.wantCauses) {
+				t.Fatalf("causes = %v, want %v", fields, tt.wantCauses)
+			}
+			for i := range fields {
+				if fields[i] != tt.wantCauses[i] {
+					t.Errorf("cause %d = %s, want %s", i, fields[i], tt.wantCauses[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	invalid := field.Invalid(annotationPath(annotationEgressOnly), "maybe", "must be true or false")
+	tests := []struct {
+		name      string
+		err       error
+		wantTypes []field.ErrorType
+	}{
+		{name: "field error", err: invalid, wantTypes: []field.ErrorType{field.ErrorTypeInvalid}},
+		{name: "plain error", err: errors.New("lookup failed"), wantTypes: []field.ErrorType{field.ErrorTypeInternal}},
+		{
+			name:      "aggregate",
+			err:       field.ErrorList{invalid, field.Forbidden(field.NewPath("spec", "hostPID"), "denied")}.ToAggregate(),
+			wantTypes: []field.ErrorType{field.ErrorTypeInvalid, field.ErrorTypeForbidden},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := fieldErrors(tt.err)
+			if len(errs) != len(tt.wantTypes) {
+				t.Fatalf("fieldErrors() = %v, want types %v", errs, tt.wantTypes)
+			}
+			for i, err := range errs {
+				if err.Type != tt.wantTypes[i] {
+					t.Errorf("error %d type = %s, want %s", i, err.Type, tt.wantTypes[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var annotationsPath = field.NewPath("metadata", "annotations")
+
+// annotationPath returns the field path of a pod annotation, e.g.
+// metadata.annotations[tailscale.com/hostname].
+func annotationPath(key string) *field.Path {
+	return annotationsPath.Key(key)
+}
+
+// settingError reports an invalid setting. Values coming from a pod
+// annotation are reported as field errors so denials carry the offending
+// field path, values coming from the environment are configuration errors.
+func settingError(pod *corev1.Pod, annotation, envName, value, detail string) error {
+	if _, ok := pod.Annotations[annotation]; ok {
+		return field.Invalid(annotationPath(annotation), value, detail)
+	}
+	return fmt.Errorf("invalid %s %q: %s", envName, value, detail)
+}
+
+// statusCauses converts field errors into status causes for the admission
+// response. Errors that are not tied to a field yield no causes.
+func statusCauses(err error) []metav1.StatusCause {
+	var errs []error
+	var aggregate utilerrors.Aggregate
+	if errors.As(err, &aggregate) {
+		errs = aggregate.Errors()
+	} else {
+		errs = []error{err}
+	}
+
+	var causes []metav1.StatusCause
+	for _, e := range errs {
+		var fieldErr *field.Error
+		if errors.As(e, &fieldErr) {
+			causes = append(causes, metav1.StatusCause{
+				Type:    metav1.CauseType(fieldErr.Type),
+				Field:   fieldErr.Field,
+				Message: fieldErr.ErrorBody(),
+			})
+		}
+	}
+	return causes
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestStatusCauses(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantFields []string
+	}{
+		{name: "plain error", err: errors.New("boom")},
+		{name: "field error", err: field.Invalid(annotationPath(annotationHostname), "Web", "invalid"), wantFields: []string{"metadata.annotations[tailscale.com/hostname]"}},
+		{
+			name: "aggregate",
+			err: utilerrors.NewAggregate([]error{
+				field.Required(annotationPath("team"), ""),
+				errors.New("boom"),
+				field.TooMany(annotationPath(annotationAdvertiseRoutes), 5, 2),
+			}),
+			wantFields: []string{"metadata.annotations[team]", "metadata.annotations[tailscale.com/advertise-routes]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			causes := statusCauses(tt.err)
+			if len(causes) != len(tt.wantFields) {
+				t.Fatalf("statusCauses() = %+v, want fields %q", causes, tt.wantFields)
+			}
+			for i, cause := range causes {
+				if cause.Field != tt.wantFields[i] || cause.Message == "" {
+					t.Errorf("statusCauses()[%d] = %+v, want field %s", i, cause, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSettingError(t *testing.T) {
+	withAnnotation := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{annotationHostname: "Web"}}}
+	var fieldErr *field.Error
+	if err := settingError(withAnnotation, annotationHostname, "TS_HOSTNAME", "Web", "invalid"); !errors.As(err, &fieldErr) {
+		t.Errorf("settingError() from an annotation = %v, want a field error", err)
+	}
+	if err := settingError(&corev1.Pod{}, annotationHostname, "TS_HOSTNAME", "Web", "invalid"); err == nil || errors.As(err, &fieldErr) {
+		t.Errorf("settingError() from the environment = %v, want a plain error", err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// verifyPatchEnabled reports whether TS_VERIFY_PATCH is set, applying the
+// patch to the pod before answering and checking the result decodes as a
+// Pod and its containers and volumes are consistent.
+func verifyPatchEnabled() bool {
+	return getEnv("TS_VERIFY_PATCH", "false") == "true"
+}
+
+// verifyPatchedPod applies patches to a copy of pod and validates the result:
+// it must decode as a core/v1 Pod (catching malformed quantities and wrongly
+// typed fields), container and volume names must be unique, and the injected
+// containers must pass validateSidecarContainer against the patched volumes.
+// Field errors keep their paths so they surface as status causes.
+func verifyPatchedPod(pod *corev1.Pod, patches []patchOperation) error {
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		return err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	for _, patch := range patches {
+		if doc, err = applyAddPatch(doc, patch); err != nil {
+			return fmt.Errorf("applying patch %s %s: %v", patch.Op, patch.Path, err)
+		}
+	}
+	if raw, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	patched := &corev1.Pod{}
+	if err := json.Unmarshal(raw, patched); err != nil {
+		return fmt.Errorf("patched pod is not a valid Pod: %v", err)
+	}
+
+	var errs field.ErrorList
+	names := sets.New[string]()
+	for _, group := range []struct {
+		path       *field.Path
+		containers []corev1.Container
+	}{
+		{field.NewPath("spec", "initContainers"), patched.Spec.InitContainers},
+		{field.NewPath("spec", "containers"), patched.Spec.Containers},
+	} {
+		for i, container := range group.containers {
+			path := group.path.Index(i)
+			if names.Has(container.Name) {
+				errs = append(errs, field.Duplicate(path.Child("name"), container.Name))
+			}
+			names.Insert(container.Name)
+			if !isInjectedContainer(container.Name) {
+				continue
+			}
+			var aggregate utilerrors.Aggregate
+			if err := validateSidecarContainer(patched, container, nil, path); errors.As(err, &aggregate) {
+				for _, e := range aggregate.Errors() {
+					var fieldErr *field.Error
+					if errors.As(e, &fieldErr) {
+						errs = append(errs, fieldErr)
+					}
+				}
+			}
+		}
+	}
+	volumes := sets.New[string]()
+	for i, volume := range patched.Spec.Volumes {
+		if volumes.Has(volume.Name) {
+			errs = append(errs, field.Duplicate(field.NewPath("spec", "volumes").Index(i).Child("name"), volume.Name))
+		}
+		volumes.Insert(volume.Name)
+	}
+	return errs.ToAggregate()
+}
+
+// applyAddPatch applies a JSON patch "add" operation (RFC 6902) to doc, a
+// decoded JSON document, and returns the updated document. The webhook only
+// emits add operations, so no other operation is supported.
+func applyAddPatch(doc interface{}, patch patchOperation) (interface{}, error) {
+	if patch.Op != "add" {
+		return nil, fmt.Errorf("unsupported operation")
+	}
+	raw, err := json.Marshal(patch.Value)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	if patch.Path == "" {
+		return value, nil
+	}
+	if !strings.HasPrefix(patch.Path, "/") {
+		return nil, fmt.Errorf("path must start with /")
+	}
+	tokens := strings.Split(patch.Path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return addAt(doc, tokens, value)
+}
+
+// addAt adds value at the location tokens in doc, returning the updated doc.
+func addAt(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	token, last := tokens[0], len(tokens) == 1
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if last {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%q does not exist", token)
+		}
+		updated, err := addAt(child, tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+	case []interface{}:
+		index := len(node)
+		if token != "-" {
+			var err error
+			if index, err = strconv.Atoi(token); err != nil || index < 0 || index > len(node) {
+				return nil, fmt.Errorf("invalid array index %q", token)
+			}
+		}
+		if last {
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		if index == len(node) {
+			return nil, fmt.Errorf("array index %q out of range", token)
+		}
+		updated, err := addAt(node[index], tokens[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		node[index] = updated
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot add below %q, parent is not an object or array", token)
+	}
+}
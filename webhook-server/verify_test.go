@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyAddPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   patchOperation
+		want    string
+		wantErr bool
+	}{
+		{name: "object member", doc: `{"a":{}}`, patch: patchOperation{Op: "add", Path: "/a/b", Value: 1}, want: `{"a":{"b":1}}`},
+		{name: "escaped key", doc: `{"a":{}}`, patch: patchOperation{Op: "add", Path: "/a/x~1y~0z", Value: "v"}, want: `{"a":{"x/y~z":"v"}}`},
+		{name: "append", doc: `{"a":[1]}`, patch: patchOperation{Op: "add", Path: "/a/-", Value: 2}, want: `{"a":[1,2]}`},
+		{name: "insert", doc: `{"a":[1,3]}`, patch: patchOperation{Op: "add", Path: "/a/1", Value: 2}, want: `{"a":[1,2,3]}`},
+		{name: "nested in array", doc: `{"a":[{"b":[]}]}`, patch: patchOperation{Op: "add", Path: "/a/0/b/-", Value: "c"}, want: `{"a":[{"b":["c"]}]}`},
+		{name: "whole document", doc: `{}`, patch: patchOperation{Op: "add", Path: "", Value: []int{1}}, want: `[1]`},
+		{name: "unsupported op", doc: `{}`, patch: patchOperation{Op: "remove", Path: "/a"}, wantErr: true},
+		{name: "relative path", doc: `{}`, patch: patchOperation{Op: "add", Path: "a", Value: 1}, wantErr: true},
+		{name: "missing parent", doc: `{}`, patch: patchOperation{Op: "add", Path: "/a/b", Value: 1}, wantErr: true},
+		{name: "index out of range", doc: `{"a":[]}`, patch: patchOperation{Op: "add", Path: "/a/2", Value: 1}, wantErr: true},
+		{name: "invalid index", doc: `{"a":[]}`, patch: patchOperation{Op: "add", Path: "/a/x", Value: 1}, wantErr: true},
+		{name: "below a scalar", doc: `{"a":1}`, patch: patchOperation{Op: "add", Path: "/a/b", Value: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc interface{}
+			if err := json.Unmarshal([]byte(tt.doc), &doc); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyAddPatch(doc, tt.patch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyAddPatch(%s) error = %v, wantErr %v", tt.patch.Path, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			raw, err := json.Marshal(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(raw) != tt.want {
+				t.Errorf("applyAddPatch(%s) = %s, want %s", tt.patch.Path, raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPatchedPod(t *testing.T) {
+	tests := []struct {
+		name       string
+		patches    []patchOperation
+		wantErr    bool
+		wantFields []string
+	}{
+		{name: "no patches"},
+		{
+			name:       "duplicate container",
+			patches:    []patchOperation{{Op: "add", Path: "/spec/containers/-", Value: corev1.Container{Name: "app", Image: "nginx"}}},
+			wantErr:    true,
+			wantFields: []string{"spec.containers[1].name"},
+		},
+		{
+			name: "duplicate volume",
+			patches: []patchOperation{
+				{Op: "add", Path: "/spec/volumes", Value: []corev1.Volume{{Name: "data"}}},
+				{Op: "add", Path: "/spec/volumes/-", Value: corev1.Volume{Name: "data"}},
+			},
+			wantErr:    true,
+			wantFields: []string{"spec.volumes[1].name"},
+		},
+		{
+			name:    "not a pod",
+			patches: []patchOperation{{Op: "add", Path: "/spec/containers/0/resources", Value: map[string]interface{}{"limits": map[string]string{"cpu": "lots"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "patch does not apply",
+			patches: []patchOperation{{Op: "add", Path: "/spec/initContainers/-", Value: corev1.Container{Name: "init"}}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app", Image: "nginx"}}}}
+			err := verifyPatchedPod(pod, tt.patches)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyPatchedPod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			causes := statusCauses(err)
+			if tt.wantFields == nil {
+				return
+			}
+			if len(causes) != len(tt.wantFields) {
+				t.Fatalf("statusCauses() = %+v, want fields %q", causes, tt.wantFields)
+			}
+			for i, cause := range causes {
+				if cause.Field != tt.wantFields[i] {
+					t.Errorf("statusCauses()[%d].Field = %s, want %s", i, cause.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyGeneratedPatch(t *testing.T) {
+	pod := testInjectedPod()
+	patches, _, err := generateSidecarPatch(context.Background(), pod)
+	if err != nil {
+		t.Fatalf("generateSidecarPatch() error = %v", err)
+	}
+	if err := verifyPatchedPod(pod, patches); err != nil {
+		t.Errorf("verifyPatchedPod() of the generated patch = %v", err)
+	}
+}
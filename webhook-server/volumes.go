@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// getExtraVolumes parses the JSON lists of volumes and sidecar volume mounts
+// from TS_EXTRA_VOLUMES and TS_EXTRA_VOLUME_MOUNTS.
+func getExtraVolumes() ([]corev1.Volume, []corev1.VolumeMount, error) {
+	var volumes []corev1.Volume
+	if value := getEnv("TS_EXTRA_VOLUMES", ""); value != "" {
+		if err := json.Unmarshal([]byte(value), &volumes); err != nil {
+			return nil, nil, fmt.Errorf("invalid TS_EXTRA_VOLUMES: %v", err)
+		}
+	}
+	var mounts []corev1.VolumeMount
+	if value := getEnv("TS_EXTRA_VOLUME_MOUNTS", ""); value != "" {
+		if err := json.Unmarshal([]byte(value), &mounts); err != nil {
+			return nil, nil, fmt.Errorf("invalid TS_EXTRA_VOLUME_MOUNTS: %v", err)
+		}
+	}
+	return volumes, mounts, nil
+}
+
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, volume := range volumes {
+		if volume.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addVolumesPatch returns the patch operations adding volumes to the pod.
+// A volume whose name is already used by the pod is not added; the sidecar
+// mounts the pod's volume instead, which is what sharing a directory with the
+// app container needs.
+func addVolumesPatch(pod *corev1.Pod, volumes []corev1.Volume) []patchOperation {
+	patches := []patchOperation{}
+	hasVolumes := len(pod.Spec.Volumes) > 0
+	for _, volume := range volumes {
+		if hasVolume(pod.Spec.Volumes, volume.Name) {
+			log.Printf("Pod %s/%s already has volume %s, sharing it with the sidecar", pod.Namespace, pod.Name, volume.Name)
+			continue
+		}
+		if !hasVolumes {
+			patches = append(patches, patchOperation{
+				Op:    "add",
+				Path:  "/spec/volumes",
+				Value: []corev1.Volume{volume},
+			})
+			hasVolumes = true
+			continue
+		}
+		patches = append(patches, patchOperation{
+			Op:    "add",
+			Path:  "/spec/volumes/-",
+			Value: volume,
+		})
+	}
+	return patches
+}
+
+// checkVolumeMounts verifies that every sidecar mount refers to a volume that
+// is either added by the webhook or already defined by the pod.
+func checkVolumeMounts(pod *corev1.Pod, volumes []corev1.Volume, mounts []corev1.VolumeMount) error {
+	for _, mount := range mounts {
+		if !hasVolume(volumes, mount.Name) && !hasVolume(pod.Spec.Volumes, mount.Name) {
+			return fmt.Errorf("sidecar volume mount %s refers to unknown volume %s", mount.MountPath, mount.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGetExtraVolumes(t *testing.T) {
+	tests := []struct {
+		name        string
+		volumes     string
+		mounts      string
+		wantVolumes int
+		wantMounts  int
+		wantErr     bool
+	}{
+		{name: "unset"},
+		{
+			name:        "set",
+			volumes:     `[{"name":"certs","secret":{"secretName":"certs"}},{"name":"cache","emptyDir":{}}]`,
+			mounts:      `[{"name":"certs","mountPath":"/etc/certs","readOnly":true}]`,
+			wantVolumes: 2,
+			wantMounts:  1,
+		},
+		{name: "invalid volumes", volumes: `{"name":"certs"}`, wantErr: true},
+		{name: "invalid mounts", mounts: `[{"name":1}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TS_EXTRA_VOLUMES", tt.volumes)
+			t.Setenv("TS_EXTRA_VOLUME_MOUNTS", tt.mounts)
+			volumes, mounts, err := getExtraVolumes()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getExtraVolumes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(volumes) != tt.wantVolumes || len(mounts) != tt.wantMounts {
+				t.Errorf("getExtraVolumes() = %d volumes, %d mounts, want %d, %d", len(volumes), len(mounts), tt.wantVolumes, tt.wantMounts)
+			}
+		})
+	}
+}
+
+func TestAddVolumesPatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []corev1.Volume
+		volumes   []corev1.Volume
+		wantPaths []string
+	}{
+		{name: "none"},
+		{
+			name:      "first volumes",
+			volumes:   []corev1.Volume{{Name: "certs"}, {Name: "cache"}},
+			wantPaths: []string{"/spec/volumes", "/spec/volumes/-"},
+		},
+		{
+			name:      "appended",
+			existing:  []corev1.Volume{{Name: "data"}},
+			volumes:   []corev1.Volume{{Name: "certs"}},
+			wantPaths: []string{"/spec/volumes/-"},
+		},
+		{
+			name:      "shared with the pod",
+			existing:  []corev1.Volume{{Name: "data"}},
+			volumes:   []corev1.Volume{{Name: "data"}, {Name: "certs"}},
+			wantPaths: []string{"/spec/volumes/-"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: tt.existing}}
+			patches := addVolumesPatch(pod, tt.volumes)
+			if len(patches) != len(tt.wantPaths) {
+				t.Fatalf("addVolumesPatch() = %+v, want paths %q", patches, tt.wantPaths)
+			}
+			for i, patch := range patches {
+				if patch.Op != "add" || patch.Path != tt.wantPaths[i] {
+					t.Errorf("addVolumesPatch()[%d] = %s %s, want add %s", i, patch.Op, patch.Path, tt.wantPaths[i])
+				}
+			}
+			patched := applyTestPatches(t, pod, patches)
+			if want := len(tt.existing) + len(patches); len(patched.Spec.Volumes) != want {
+				t.Errorf("patched pod has %d volumes, want %d", len(patched.Spec.Volumes), want)
+			}
+		})
+	}
+}
+
+func TestCheckVolumeMounts(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "data"}}}}
+	volumes := []corev1.Volume{{Name: "certs"}}
+	tests := []struct {
+		name    string
+		mounts  []corev1.VolumeMount
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "added volume", mounts: []corev1.VolumeMount{{Name: "certs", MountPath: "/etc/certs"}}},
+		{name: "pod volume", mounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}},
+		{name: "unknown volume", mounts: []corev1.VolumeMount{{Name: "certs", MountPath: "/etc/certs"}, {Name: "cache", MountPath: "/cache"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkVolumeMounts(pod, volumes, tt.mounts); (err != nil) != tt.wantErr {
+				t.Errorf("checkVolumeMounts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}